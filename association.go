@@ -0,0 +1,283 @@
+package theory
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/wilburhimself/theory/model"
+)
+
+// Association manages the records associated with a model through one of
+// its relationship fields. Has-many associations are linked through the
+// foreign key on the associated table, which must be nullable for Delete,
+// Replace and Clear. Many-to-many associations are linked through rows in
+// the join table.
+type Association struct {
+	db       *DB
+	ctx      context.Context
+	owner    reflect.Value
+	ownerPK  interface{}
+	rel      *model.Relationship
+	metadata *model.Metadata
+	err      error
+}
+
+// Association returns the association held by the named relationship field
+// of m, which must be a pointer to a saved model. Errors are reported by the
+// Association's methods.
+func (db *DB) Association(ctx context.Context, m interface{}, field string) *Association {
+	a := &Association{db: db.inContextTx(ctx), ctx: ctx}
+
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		a.err = fmt.Errorf("association owner must be a pointer to a struct")
+		return a
+	}
+	a.owner = v.Elem()
+
+	ownerMetadata, err := a.db.metadata(m)
+	if err != nil {
+		a.err = err
+		return a
+	}
+
+	rel, ok := ownerMetadata.Relationship(field)
+	if !ok {
+		a.err = fmt.Errorf("%s has no relationship field %s", a.owner.Type().Name(), field)
+		return a
+	}
+	a.rel = rel
+
+	// The foreign key usually references the owner's primary key
+	ref, ok := ownerMetadata.FieldByDBName(rel.References)
+	if !ok {
+		a.err = fmt.Errorf("%s has no column %s referenced by %s", a.owner.Type().Name(), rel.References, field)
+		return a
+	}
+	pkValue := a.owner.FieldByName(ref.Name)
+	if pkValue.IsZero() {
+		a.err = fmt.Errorf("association owner must be saved first")
+		return a
+	}
+	a.ownerPK = pkValue.Interface()
+
+	a.metadata, a.err = a.db.metadata(reflect.New(rel.Type).Interface())
+	return a
+}
+
+// Append associates values, which must be pointers to associated models.
+// Unsaved values are created. The values are also appended to the owner's
+// relationship field.
+func (a *Association) Append(values ...interface{}) error {
+	if a.err != nil {
+		return a.err
+	}
+
+	for _, value := range values {
+		v, err := a.value(value)
+		if err != nil {
+			return err
+		}
+
+		switch a.rel.Kind {
+		case model.HasMany:
+			if err := setField(v.Elem().FieldByName(a.fieldName(a.rel.ForeignKey)), a.ownerPK); err != nil {
+				return err
+			}
+			if a.primaryKey(v).IsZero() {
+				if err := a.db.Create(a.ctx, value); err != nil {
+					return err
+				}
+				break
+			}
+			sql := fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s = ?", a.metadata.TableName, a.rel.ForeignKey, a.pkColumn())
+			if _, err := a.db.exec(a.ctx, sql, a.ownerPK, a.primaryKey(v).Interface()); err != nil {
+				return wrapError("append", a.metadata.TableName, err)
+			}
+		case model.ManyToMany:
+			if a.primaryKey(v).IsZero() {
+				if err := a.db.Create(a.ctx, value); err != nil {
+					return err
+				}
+			}
+			sql := fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES (?, ?)", a.rel.JoinTable, a.rel.ForeignKey, a.rel.JoinForeignKey)
+			if _, err := a.db.exec(a.ctx, sql, a.ownerPK, a.primaryKey(v).Interface()); err != nil {
+				return wrapError("append", a.rel.JoinTable, err)
+			}
+		}
+
+		field := a.owner.FieldByName(a.rel.Name)
+		if field.Type().Elem().Kind() == reflect.Ptr {
+			field.Set(reflect.Append(field, v))
+		} else {
+			field.Set(reflect.Append(field, v.Elem()))
+		}
+	}
+
+	return nil
+}
+
+// Replace replaces all associations with values
+func (a *Association) Replace(values ...interface{}) error {
+	if err := a.Clear(); err != nil {
+		return err
+	}
+	return a.Append(values...)
+}
+
+// Delete removes the association with values. The associated records
+// themselves are kept.
+func (a *Association) Delete(values ...interface{}) error {
+	if a.err != nil {
+		return a.err
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	keys := make([]interface{}, 0, len(values))
+	placeholders := make([]string, 0, len(values))
+	for _, value := range values {
+		v, err := a.value(value)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, a.primaryKey(v).Interface())
+		placeholders = append(placeholders, "?")
+	}
+	in := strings.Join(placeholders, ", ")
+
+	var sql, table string
+	switch a.rel.Kind {
+	case model.HasMany:
+		table = a.metadata.TableName
+		sql = fmt.Sprintf("UPDATE %s SET %s = NULL WHERE %s = ? AND %s IN (%s)",
+			table, a.rel.ForeignKey, a.rel.ForeignKey, a.pkColumn(), in)
+	case model.ManyToMany:
+		table = a.rel.JoinTable
+		sql = fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND %s IN (%s)",
+			table, a.rel.ForeignKey, a.rel.JoinForeignKey, in)
+	}
+
+	if _, err := a.db.exec(a.ctx, sql, append([]interface{}{a.ownerPK}, keys...)...); err != nil {
+		return wrapError("delete association", table, err)
+	}
+	return nil
+}
+
+// Clear removes all associations. The associated records themselves are
+// kept, and the owner's relationship field is emptied.
+func (a *Association) Clear() error {
+	if a.err != nil {
+		return a.err
+	}
+
+	var sql, table string
+	switch a.rel.Kind {
+	case model.HasMany:
+		table = a.metadata.TableName
+		sql = fmt.Sprintf("UPDATE %s SET %s = NULL WHERE %s = ?", table, a.rel.ForeignKey, a.rel.ForeignKey)
+	case model.ManyToMany:
+		table = a.rel.JoinTable
+		sql = fmt.Sprintf("DELETE FROM %s WHERE %s = ?", table, a.rel.ForeignKey)
+	}
+
+	if _, err := a.db.exec(a.ctx, sql, a.ownerPK); err != nil {
+		return wrapError("clear association", table, err)
+	}
+
+	field := a.owner.FieldByName(a.rel.Name)
+	field.Set(reflect.MakeSlice(field.Type(), 0, 0))
+	return nil
+}
+
+// Count returns the number of associated records
+func (a *Association) Count() (int64, error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+
+	var count int64
+	sql := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", a.metadata.TableName, a.condition())
+	if err := a.db.queryRow(a.ctx, sql, []interface{}{a.ownerPK}, &count); err != nil {
+		return 0, wrapError("count", a.metadata.TableName, err)
+	}
+	return count, nil
+}
+
+// Find retrieves the associated records into dest, a pointer to a slice of
+// associated models
+func (a *Association) Find(dest interface{}) error {
+	if a.err != nil {
+		return a.err
+	}
+	return a.db.Find(a.ctx, dest, a.condition(), a.ownerPK)
+}
+
+// condition returns the WHERE condition selecting the associated records,
+// with a single placeholder for the owner's primary key
+func (a *Association) condition() string {
+	if a.rel.Kind == model.ManyToMany {
+		return fmt.Sprintf("%s IN (SELECT %s FROM %s WHERE %s = ?)",
+			a.pkColumn(), a.rel.JoinForeignKey, a.rel.JoinTable, a.rel.ForeignKey)
+	}
+	return fmt.Sprintf("%s = ?", a.rel.ForeignKey)
+}
+
+// value checks that value is a pointer to an associated model
+func (a *Association) value(value interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Type() != a.rel.Type {
+		return reflect.Value{}, fmt.Errorf("association values must be *%s, got %T", a.rel.Type.Name(), value)
+	}
+	return v, nil
+}
+
+// pkColumn returns the primary key column of the associated table
+func (a *Association) pkColumn() string {
+	if pk := a.metadata.PrimaryKey(); pk != nil {
+		return pk.DBName
+	}
+	return "id"
+}
+
+// primaryKey returns the primary key field of an associated model
+func (a *Association) primaryKey(v reflect.Value) reflect.Value {
+	return v.Elem().FieldByName(a.fieldName(a.pkColumn()))
+}
+
+// fieldName returns the struct field name of an associated table column
+func (a *Association) fieldName(column string) string {
+	if field, ok := a.metadata.FieldByDBName(column); ok {
+		return field.Name
+	}
+	return ""
+}
+
+// setField assigns value to field, allocating pointer fields and converting
+// between compatible types
+func setField(field reflect.Value, value interface{}) error {
+	if !field.IsValid() {
+		return fmt.Errorf("foreign key field not found")
+	}
+
+	v := reflect.ValueOf(value)
+	target := field.Type()
+	if target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+	if !v.Type().ConvertibleTo(target) {
+		return fmt.Errorf("cannot assign %s to %s", v.Type(), field.Type())
+	}
+	v = v.Convert(target)
+
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(target)
+		ptr.Elem().Set(v)
+		v = ptr
+	}
+	field.Set(v)
+	return nil
+}
@@ -0,0 +1,211 @@
+package theory
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/wilburhimself/theory/migration"
+)
+
+type TestOwner struct {
+	ID    int    `db:"id,pk,auto"`
+	Name  string `db:"name"`
+	Notes []TestNote
+	Tags  []*TestTag `theory:"many2many:test_owner_tags"`
+}
+
+type TestNote struct {
+	ID          int    `db:"id,pk,auto"`
+	Title       string `db:"title"`
+	TestOwnerID *int   `db:"test_owner_id,null"`
+}
+
+type TestTag struct {
+	ID   int    `db:"id,pk,auto"`
+	Name string `db:"name"`
+}
+
+func setupAssociationDB(t *testing.T) (*DB, *TestOwner) {
+	t.Helper()
+
+	db, cleanup := setupTestDB(t)
+	t.Cleanup(cleanup)
+
+	ctx := context.Background()
+	if err := db.AutoMigrate(ctx, &TestOwner{}, &TestNote{}, &TestTag{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	joinTable := &migration.CreateTable{
+		Name: "test_owner_tags",
+		Columns: []migration.Column{
+			{Name: "test_owner_id", Type: "INTEGER"},
+			{Name: "test_tag_id", Type: "INTEGER"},
+		},
+	}
+	if _, err := db.Primary().ExecContext(ctx, joinTable.SQL()); err != nil {
+		t.Fatalf("failed to create join table: %v", err)
+	}
+
+	owner := &TestOwner{Name: "Owner"}
+	if err := db.Create(ctx, owner); err != nil {
+		t.Fatalf("failed to create owner: %v", err)
+	}
+	return db, owner
+}
+
+// associationNames returns the sorted names or titles found by an association
+func associationNames(t *testing.T, a *Association, dest interface{}) []string {
+	t.Helper()
+
+	if err := a.Find(dest); err != nil {
+		t.Fatalf("failed to find associations: %v", err)
+	}
+
+	var names []string
+	switch d := dest.(type) {
+	case *[]TestNote:
+		for _, n := range *d {
+			names = append(names, n.Title)
+		}
+	case *[]TestTag:
+		for _, tag := range *d {
+			names = append(names, tag.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func assertAssociation(t *testing.T, a *Association, dest interface{}, want ...string) {
+	t.Helper()
+
+	count, err := a.Count()
+	if err != nil {
+		t.Fatalf("failed to count associations: %v", err)
+	}
+	if count != int64(len(want)) {
+		t.Errorf("Count() = %d, want %d", count, len(want))
+	}
+
+	got := associationNames(t, a, dest)
+	if len(got) != len(want) {
+		t.Fatalf("Find() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Find() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestAssociationHasMany(t *testing.T) {
+	db, owner := setupAssociationDB(t)
+	ctx := context.Background()
+
+	existing := &TestNote{Title: "existing"}
+	if err := db.Create(ctx, existing); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	notes := db.Association(ctx, owner, "Notes")
+	var dest []TestNote
+
+	// Append creates new records and links existing ones
+	a, b := &TestNote{Title: "a"}, &TestNote{Title: "b"}
+	if err := notes.Append(a, b, existing); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if a.ID == 0 || a.TestOwnerID == nil || *a.TestOwnerID != owner.ID {
+		t.Errorf("expected appended note to be saved with the owner key, got %+v", a)
+	}
+	if len(owner.Notes) != 3 {
+		t.Errorf("expected owner field to hold 3 notes, got %d", len(owner.Notes))
+	}
+	assertAssociation(t, notes, &dest, "a", "b", "existing")
+
+	// Delete unlinks records without removing them
+	if err := notes.Delete(existing); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	assertAssociation(t, notes, &dest, "a", "b")
+	var kept TestNote
+	if err := db.First(ctx, &kept, existing.ID); err != nil {
+		t.Errorf("expected deleted association to keep the record: %v", err)
+	}
+
+	if err := notes.Replace(existing); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	assertAssociation(t, notes, &dest, "existing")
+
+	if err := notes.Clear(); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	assertAssociation(t, notes, &dest)
+	if len(owner.Notes) != 0 {
+		t.Errorf("expected owner field to be cleared, got %d notes", len(owner.Notes))
+	}
+}
+
+func TestAssociationManyToMany(t *testing.T) {
+	db, owner := setupAssociationDB(t)
+	ctx := context.Background()
+
+	other := &TestOwner{Name: "Other"}
+	if err := db.Create(ctx, other); err != nil {
+		t.Fatalf("failed to create owner: %v", err)
+	}
+
+	tags := db.Association(ctx, owner, "Tags")
+	var dest []TestTag
+
+	red, blue := &TestTag{Name: "red"}, &TestTag{Name: "blue"}
+	if err := tags.Append(red, blue); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if red.ID == 0 {
+		t.Error("expected appended tag to be created")
+	}
+	assertAssociation(t, tags, &dest, "blue", "red")
+
+	// Tags can be shared between owners
+	if err := db.Association(ctx, other, "Tags").Append(red); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	assertAssociation(t, db.Association(ctx, other, "Tags"), &dest, "red")
+
+	if err := tags.Delete(red); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	assertAssociation(t, tags, &dest, "blue")
+	assertAssociation(t, db.Association(ctx, other, "Tags"), &dest, "red")
+
+	green := &TestTag{Name: "green"}
+	if err := tags.Replace(red, green); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	assertAssociation(t, tags, &dest, "green", "red")
+
+	if err := tags.Clear(); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	assertAssociation(t, tags, &dest)
+	assertAssociation(t, db.Association(ctx, other, "Tags"), &dest, "red")
+}
+
+func TestAssociationErrors(t *testing.T) {
+	db, owner := setupAssociationDB(t)
+	ctx := context.Background()
+
+	if err := db.Association(ctx, owner, "Missing").Append(&TestNote{}); err == nil {
+		t.Error("expected error for unknown relationship")
+	}
+	if _, err := db.Association(ctx, &TestOwner{}, "Notes").Count(); err == nil {
+		t.Error("expected error for unsaved owner")
+	}
+	if err := db.Association(ctx, owner, "Notes").Append(&TestTag{}); err == nil {
+		t.Error("expected error for value of the wrong type")
+	}
+}
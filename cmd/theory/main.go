@@ -0,0 +1,285 @@
+// Command theory is a helper tool for projects using Theory.
+//
+// The gen subcommand turns plain struct definitions into boilerplate models:
+//
+//	theory gen [-package name] [-plural] [-o file] [file]
+//
+// The structs are read from file, or from stdin when no file is given, and
+// may be a full Go file or just type declarations. Each struct is written
+// with db tags for its exported fields, a TableName method and stub hook
+// methods. Existing db tags are kept; a field named ID becomes an
+// auto-generated primary key and pointer fields become nullable.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/wilburhimself/theory/model"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "theory:", err)
+		os.Exit(1)
+	}
+}
+
+const usage = "usage: theory gen [-package name] [-plural] [-o file] [file]"
+
+// run executes the subcommand named by args[0]
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "gen" {
+		return errors.New(usage)
+	}
+
+	flags := flag.NewFlagSet("gen", flag.ContinueOnError)
+	pkg := flags.String("package", "models", "package name of the generated file")
+	plural := flags.Bool("plural", false, "pluralize table names")
+	output := flags.String("o", "", "file to write to instead of stdout")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		return errors.New(usage)
+	}
+
+	var src []byte
+	var err error
+	if flags.NArg() == 1 {
+		src, err = os.ReadFile(flags.Arg(0))
+	} else {
+		src, err = io.ReadAll(stdin)
+	}
+	if err != nil {
+		return err
+	}
+
+	var naming model.NamingStrategy = model.DefaultNamingStrategy{}
+	if *plural {
+		naming = model.PluralNamingStrategy{}
+	}
+
+	code, err := generate(src, *pkg, naming)
+	if err != nil {
+		return err
+	}
+
+	if *output != "" {
+		return os.WriteFile(*output, code, 0o644)
+	}
+	_, err = stdout.Write(code)
+	return err
+}
+
+// hooks are the stub hook methods generated for each model, with the doc
+// comment describing when they run
+var hooks = []struct {
+	name, doc string
+}{
+	{"BeforeCreate", "runs before the %s is inserted. Returning an error aborts the insert."},
+	{"AfterCreate", "runs after the %s is inserted"},
+	{"BeforeUpdate", "runs before the %s is updated. Returning an error aborts the update."},
+	{"AfterUpdate", "runs after the %s is updated"},
+	{"BeforeDelete", "runs before the %s is deleted. Returning an error aborts the delete."},
+	{"AfterDelete", "runs after the %s is deleted"},
+}
+
+// generate returns the formatted model file for the structs declared in src
+func generate(src []byte, pkg string, naming model.NamingStrategy) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		// Bare type declarations lack a package clause
+		var retryErr error
+		file, retryErr = parser.ParseFile(fset, "", append([]byte("package p\n"), src...), parser.ParseComments)
+		if retryErr != nil {
+			return nil, err
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	b.WriteString("import (\n\t\"context\"\n")
+	for _, imp := range usedImports(file) {
+		b.WriteString("\t" + imp + "\n")
+	}
+	b.WriteString("\n\t\"github.com/wilburhimself/theory/model\"\n)\n")
+
+	found := false
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			found = true
+
+			doc := ts.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+			if err := writeModel(&b, fset, ts.Name.Name, doc, st, naming); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no struct type declarations found")
+	}
+
+	code, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w", err)
+	}
+	return code, nil
+}
+
+// usedImports returns the import specs of file, such as "time", that field
+// types of its structs refer to. Imports without an explicit name are
+// assumed to be named after the last element of their path.
+func usedImports(file *ast.File) []string {
+	used := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if field, ok := n.(*ast.Field); ok {
+			ast.Inspect(field.Type, func(n ast.Node) bool {
+				if sel, ok := n.(*ast.SelectorExpr); ok {
+					if ident, ok := sel.X.(*ast.Ident); ok {
+						used[ident.Name] = true
+					}
+				}
+				return true
+			})
+		}
+		return true
+	})
+
+	var imports []string
+	for _, imp := range file.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || path == "context" {
+			continue
+		}
+		name := path[strings.LastIndex(path, "/")+1:]
+		spec := imp.Path.Value
+		if imp.Name != nil {
+			name = imp.Name.Name
+			spec = name + " " + spec
+		}
+		if used[name] {
+			imports = append(imports, spec)
+		}
+	}
+	return imports
+}
+
+// writeModel writes a struct with db tags and its methods
+func writeModel(b *bytes.Buffer, fset *token.FileSet, name string, doc *ast.CommentGroup, st *ast.StructType, naming model.NamingStrategy) error {
+	b.WriteString("\n")
+	if doc != nil {
+		for _, c := range doc.List {
+			b.WriteString(c.Text + "\n")
+		}
+	} else {
+		fmt.Fprintf(b, "// %s is a Theory model\n", name)
+	}
+
+	fmt.Fprintf(b, "type %s struct {\n", name)
+	for _, field := range st.Fields.List {
+		var typ bytes.Buffer
+		if err := format.Node(&typ, fset, field.Type); err != nil {
+			return err
+		}
+
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			unquoted, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return err
+			}
+			tag = reflect.StructTag(unquoted)
+		}
+
+		// Embedded fields are kept as they are
+		if len(field.Names) == 0 {
+			fmt.Fprintf(b, "\t%s %s\n", typ.String(), quoteTag(string(tag)))
+			continue
+		}
+
+		for _, ident := range field.Names {
+			fieldTag := string(tag)
+			if _, ok := tag.Lookup("db"); !ok && ident.IsExported() {
+				fieldTag = strings.TrimSpace(fmt.Sprintf("db:%q %s", dbTag(ident.Name, field.Type, naming), fieldTag))
+			}
+			fmt.Fprintf(b, "\t%s %s %s\n", ident.Name, typ.String(), quoteTag(fieldTag))
+		}
+	}
+	b.WriteString("}\n")
+
+	recv := string(unicode.ToLower([]rune(name)[0]))
+	fmt.Fprintf(b, "\n// TableName returns the name of the table %s records are stored in\n", name)
+	fmt.Fprintf(b, "func (%s *%s) TableName() string {\n\treturn %q\n}\n", recv, name, naming.TableName(snakeCase(name)))
+	b.WriteString("\n// PrimaryKey returns nil, so the primary key is taken from the db tags\n")
+	fmt.Fprintf(b, "func (%s *%s) PrimaryKey() *model.Field {\n\treturn nil\n}\n", recv, name)
+
+	for _, hook := range hooks {
+		fmt.Fprintf(b, "\n// %s "+hook.doc+"\n", hook.name, name)
+		fmt.Fprintf(b, "func (%s *%s) %s(ctx context.Context) error {\n\treturn nil\n}\n", recv, name, hook.name)
+	}
+	return nil
+}
+
+// dbTag returns the db tag of a field without one
+func dbTag(field string, typ ast.Expr, naming model.NamingStrategy) string {
+	tag := naming.ColumnName(snakeCase(field))
+	if field == "ID" {
+		tag += ",pk,auto"
+	} else if _, ok := typ.(*ast.StarExpr); ok {
+		tag += ",null"
+	}
+	return tag
+}
+
+// snakeCase converts a CamelCase name to snake_case, keeping initialisms
+// together: UserID becomes user_id and HTTPLog becomes http_log. The naming
+// strategies leave the result unchanged apart from pluralizing table names.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(!unicode.IsUpper(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// quoteTag returns tag as a raw string literal, or "" for an empty tag
+func quoteTag(tag string) string {
+	if tag == "" {
+		return ""
+	}
+	if strings.Contains(tag, "`") {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
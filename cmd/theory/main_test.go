@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wilburhimself/theory/model"
+)
+
+const input = `package input
+
+import "time"
+
+// User is a registered user
+type User struct {
+	ID        int
+	FirstName, LastName string
+	Email     *string ` + "`json:\"email\"`" + `
+	Code      string  ` + "`db:\"code,unique\"`" + `
+	CreatedAt time.Time
+	secret    string
+}
+
+type HTTPLog struct {
+	ID     string
+	UserID int
+}
+`
+
+func TestGenerate(t *testing.T) {
+	code, err := generate([]byte(input), "models", model.PluralNamingStrategy{})
+	if err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+
+	// Compare with alignment collapsed, as it depends on the longest field
+	collapsed := strings.Join(strings.Fields(string(code)), " ")
+	for _, want := range []string{
+		"package models",
+		"// User is a registered user",
+		`"time"`,
+		"ID int `db:\"id,pk,auto\"`",
+		"FirstName string `db:\"first_name\"`",
+		"LastName string `db:\"last_name\"`",
+		"Email *string `db:\"email,null\" json:\"email\"`",
+		"Code string `db:\"code,unique\"`",
+		"CreatedAt time.Time `db:\"created_at\"`",
+		"secret string }",
+		`return "users"`,
+		`return "http_logs"`,
+		"UserID int `db:\"user_id\"`",
+		"func (u *User) BeforeCreate(ctx context.Context) error {",
+		"func (h *HTTPLog) AfterDelete(ctx context.Context) error {",
+	} {
+		if !strings.Contains(collapsed, want) {
+			t.Errorf("expected generated code to contain %q, got:\n%s", want, code)
+		}
+	}
+
+	if _, err := generate([]byte("func main() {}"), "models", model.DefaultNamingStrategy{}); err == nil {
+		t.Error("expected error for input without structs")
+	}
+}
+
+// TestGenCompiles runs the gen subcommand in a subprocess and builds its
+// output in a module that uses this checkout of Theory
+func TestGenCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds binaries")
+	}
+
+	root, err := filepath.Abs("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "theory")
+	if out, err := exec.Command("go", "build", "-o", bin, ".").CombinedOutput(); err != nil {
+		t.Fatalf("failed to build theory: %v\n%s", err, out)
+	}
+
+	mod := filepath.Join(dir, "app")
+	if err := os.MkdirAll(mod, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	goMod := "module example.com/app\n\ngo 1.21\n\nrequire github.com/wilburhimself/theory v0.0.0\n\n" +
+		"replace github.com/wilburhimself/theory => " + root + "\n"
+	if err := os.WriteFile(filepath.Join(mod, "go.mod"), []byte(goMod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := exec.Command(bin, "gen", "-o", filepath.Join(mod, "models.go"))
+	gen.Stdin = strings.NewReader(input)
+	var stderr bytes.Buffer
+	gen.Stderr = &stderr
+	if err := gen.Run(); err != nil {
+		t.Fatalf("theory gen failed: %v\n%s", err, stderr.String())
+	}
+
+	build := exec.Command("go", "build", "./...")
+	build.Dir = mod
+	build.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	if out, err := build.CombinedOutput(); err != nil {
+		generated, _ := os.ReadFile(filepath.Join(mod, "models.go"))
+		t.Fatalf("generated code does not compile: %v\n%s\n%s", err, out, generated)
+	}
+}
@@ -0,0 +1,319 @@
+package theory
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wilburhimself/theory/model"
+	"github.com/wilburhimself/theory/query"
+)
+
+// maxCopyParams bounds the number of parameters in a single INSERT built by
+// CopyFrom, staying below SQLite's default limit of 999
+const maxCopyParams = 999
+
+// CopyFrom bulk loads CSV rows from r into the model's table and returns the
+// number of rows loaded. The header row names the database columns of the
+// remaining rows. Values are converted to the types of the matching fields;
+// empty values of pointer fields are loaded as NULL.
+//
+// On PostgreSQL the rows are streamed with COPY FROM STDIN, as supported by
+// lib/pq. Other databases get multi-row INSERT statements. Unless the DB is
+// already in a transaction, the load runs in one, so either all rows are
+// loaded or none are.
+func (db *DB) CopyFrom(ctx context.Context, m interface{}, r io.Reader) (int64, error) {
+	db = db.inContextTx(ctx)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	metadata, err := db.metadata(m)
+	if err != nil {
+		return 0, err
+	}
+	table := metadata.TableName
+
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return 0, wrapError("copy from", table, fmt.Errorf("missing header row"))
+	}
+	if err != nil {
+		return 0, wrapError("copy from", table, err)
+	}
+
+	columns := make([]string, len(header))
+	fields := make([]*model.Field, len(header))
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		field, ok := metadata.FieldByDBName(column)
+		if !ok {
+			return 0, wrapError("copy from", table, fmt.Errorf("unknown column %q in header", column))
+		}
+		columns[i] = column
+		fields[i] = field
+	}
+
+	src := &csvSource{reader: reader, columns: columns, fields: fields}
+	load := func(db *DB) (int64, error) {
+		if db.driver == "postgres" && !db.dryRun {
+			return db.copyIn(ctx, table, src)
+		}
+		return db.insertChunks(ctx, table, src)
+	}
+
+	if db.tx != nil || db.dryRun {
+		n, err := load(db)
+		return n, wrapError("copy from", table, err)
+	}
+
+	tx, err := db.Begin(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	// Rolling back after a successful commit is a no-op
+	defer tx.tx.Rollback()
+
+	n, err := load(tx.db)
+	if err != nil {
+		return 0, wrapError("copy from", table, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// CopyTo writes the model's records matching the condition to w as CSV,
+// ordered by primary key, and returns the number of records written. The
+// header row holds the database column names. Rows are streamed as they are
+// read; NULL is written as an empty value and times in RFC 3339 format, so
+// the output can be loaded back with CopyFrom. Soft-deleted records are
+// skipped.
+func (db *DB) CopyTo(ctx context.Context, w io.Writer, m interface{}, where string, args ...interface{}) (int64, error) {
+	db = db.inContextTx(ctx)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	metadata, err := db.metadata(m)
+	if err != nil {
+		return 0, err
+	}
+	table := metadata.TableName
+
+	columns := make([]string, len(metadata.Fields))
+	for i, field := range metadata.Fields {
+		columns[i] = field.DBName
+	}
+
+	builder := query.NewBuilder(table).Select(columns...)
+	field := metadata.SoftDeleteField()
+	if where != "" && field != nil {
+		builder.Where(parenthesize(where), args...)
+	} else if where != "" {
+		builder.Where(where, args...)
+	}
+	if field != nil {
+		builder.Where(fmt.Sprintf("%s IS NULL", field.DBName))
+	}
+	if pkField := metadata.PrimaryKey(); pkField != nil {
+		builder.OrderBy(pkField.DBName + " ASC")
+	}
+	sql, sqlArgs := builder.Build()
+
+	if db.dryRun {
+		db.logDryRun(sql, sqlArgs)
+		return 0, nil
+	}
+
+	rows, release, err := db.query(ctx, db.Replica(), sql, sqlArgs...)
+	if err != nil {
+		return 0, wrapError("copy to", table, err)
+	}
+	defer release()
+	defer rows.Close()
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(columns); err != nil {
+		return 0, wrapError("copy to", table, err)
+	}
+
+	values := make([]interface{}, len(columns))
+	scanDest := make([]interface{}, len(columns))
+	for i := range values {
+		scanDest[i] = &values[i]
+	}
+	record := make([]string, len(columns))
+
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(scanDest...); err != nil {
+			return n, wrapError("copy to", table, err)
+		}
+		for i, value := range values {
+			record[i] = csvText(value)
+		}
+		if err := writer.Write(record); err != nil {
+			return n, wrapError("copy to", table, err)
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, wrapError("copy to", table, err)
+	}
+
+	writer.Flush()
+	return n, wrapError("copy to", table, writer.Error())
+}
+
+// csvText formats a scanned column value as a CSV field
+func csvText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
+
+// copyIn streams rows with COPY FROM STDIN. The statement is prepared on the
+// transaction, each row is sent with Exec, and a final Exec without
+// arguments completes the copy.
+func (db *DB) copyIn(ctx context.Context, table string, src *csvSource) (int64, error) {
+	sql := fmt.Sprintf("COPY %s (%s) FROM STDIN", table, strings.Join(src.columns, ", "))
+
+	start := time.Now()
+	stmt, err := db.tx.PrepareContext(ctx, sql)
+	if err != nil {
+		db.logQuery(sql, nil, time.Since(start), err)
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var n int64
+	for {
+		values, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return 0, err
+		}
+		n++
+	}
+
+	_, err = stmt.ExecContext(ctx)
+	db.logQuery(sql, nil, time.Since(start), err)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// insertChunks loads rows with INSERT statements of as many rows as fit in
+// maxCopyParams parameters
+func (db *DB) insertChunks(ctx context.Context, table string, src *csvSource) (int64, error) {
+	chunkSize := maxCopyParams / len(src.columns)
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(src.columns)), ", ") + ")"
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", table, strings.Join(src.columns, ", "))
+
+	var n int64
+	for done := false; !done; {
+		var args []interface{}
+		rows := 0
+		for rows < chunkSize {
+			values, err := src.next()
+			if err == io.EOF {
+				done = true
+				break
+			}
+			if err != nil {
+				return 0, err
+			}
+			args = append(args, values...)
+			rows++
+		}
+		if rows == 0 {
+			break
+		}
+
+		sql := prefix + strings.TrimSuffix(strings.Repeat(placeholders+", ", rows), ", ")
+		if _, err := db.exec(ctx, sql, args...); err != nil {
+			return 0, err
+		}
+		n += int64(rows)
+	}
+	return n, nil
+}
+
+// csvSource reads CSV records and converts them to column values
+type csvSource struct {
+	reader  *csv.Reader
+	columns []string
+	fields  []*model.Field
+}
+
+// next returns the values of the next record, or io.EOF after the last one
+func (s *csvSource) next() ([]interface{}, error) {
+	record, err := s.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(record))
+	for i, text := range record {
+		value, err := csvValue(s.fields[i], text)
+		if err != nil {
+			line, _ := s.reader.FieldPos(i)
+			return nil, fmt.Errorf("line %d, column %s: %w", line, s.columns[i], err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// csvValue converts a CSV value to the type of the field it is loaded into
+func csvValue(field *model.Field, text string) (interface{}, error) {
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		if text == "" {
+			return nil, nil
+		}
+		t = t.Elem()
+	}
+	if field.IsJSON() && text == "" {
+		return nil, nil
+	}
+
+	if t == reflect.TypeOf(time.Time{}) {
+		return time.Parse(time.RFC3339, text)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return strconv.ParseBool(text)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(text, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(text, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(text, 64)
+	}
+	return text, nil
+}
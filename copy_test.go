@@ -0,0 +1,157 @@
+package theory
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCopyFrom(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	var csv strings.Builder
+	csv.WriteString("name,email\n")
+	for i := 1; i <= 1000; i++ {
+		fmt.Fprintf(&csv, "User %d,user%d@example.com\n", i, i)
+	}
+
+	ctx := context.Background()
+	n, err := db.CopyFrom(ctx, &TestUser{}, strings.NewReader(csv.String()))
+	if err != nil {
+		t.Fatalf("failed to copy rows: %v", err)
+	}
+	if n != 1000 {
+		t.Errorf("expected 1000 rows copied, got %d", n)
+	}
+
+	var count int
+	if err := db.Primary().QueryRowContext(ctx, "SELECT COUNT(*) FROM test_user").Scan(&count); err != nil {
+		t.Fatalf("failed to count users: %v", err)
+	}
+	if count != 1000 {
+		t.Errorf("expected 1000 users, got %d", count)
+	}
+
+	var user TestUser
+	if err := db.First(ctx, &user, 1000); err != nil {
+		t.Fatalf("failed to find user: %v", err)
+	}
+	if user.Name != "User 1000" || user.Email != "user1000@example.com" {
+		t.Errorf("unexpected user: %+v", user)
+	}
+}
+
+func TestCopyFromErrors(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if _, err := db.CopyFrom(ctx, &TestUser{}, strings.NewReader("name,phone\nAlice,555\n")); err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+
+	// A bad row rolls back the chunks inserted before it
+	var csv strings.Builder
+	csv.WriteString("id,name,email\n")
+	for i := 1; i <= 400; i++ {
+		fmt.Fprintf(&csv, "%d,User %d,user%d@example.com\n", i, i, i)
+	}
+	csv.WriteString("x,Bob,b@example.com\n")
+	_, err := db.CopyFrom(ctx, &TestUser{}, strings.NewReader(csv.String()))
+	if err == nil || !strings.Contains(err.Error(), "line 402, column id") {
+		t.Errorf("expected a conversion error on line 402, got %v", err)
+	}
+
+	var count int
+	if err := db.Primary().QueryRowContext(ctx, "SELECT COUNT(*) FROM test_user").Scan(&count); err != nil {
+		t.Fatalf("failed to count users: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("expected no users after a failed copy, got %d", count)
+	}
+}
+
+func TestCopyFromPostgres(t *testing.T) {
+	rec, dsn := newRecorder(t)
+	db, err := Connect(Config{Driver: "postgres", DSN: dsn})
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	n, err := db.CopyFrom(context.Background(), &TestUser{}, strings.NewReader("name,email\nAlice,a@example.com\nBob,b@example.com\n"))
+	if err != nil {
+		t.Fatalf("failed to copy rows: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 rows copied, got %d", n)
+	}
+
+	queries := rec.Queries()
+	copies := 0
+	for _, query := range queries {
+		if query == "COPY test_user (name, email) FROM STDIN" {
+			copies++
+		}
+	}
+	// One Exec per row and a final one to complete the copy
+	if copies != 3 {
+		t.Errorf("expected 3 COPY executions, got %d in %q", copies, queries)
+	}
+	if query, args := rec.LastQuery(); query != "COPY test_user (name, email) FROM STDIN" || len(args) != 0 {
+		t.Errorf("expected the final COPY without args, got %q %v", query, args)
+	}
+}
+
+func TestCopyTo(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	for i := 1; i <= 50; i++ {
+		user := &TestUser{Name: fmt.Sprintf("User %d", i), Email: fmt.Sprintf("user%d@example.com", i)}
+		if err := db.Create(ctx, user); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	n, err := db.CopyTo(ctx, &buf, &TestUser{}, "")
+	if err != nil {
+		t.Fatalf("failed to copy rows: %v", err)
+	}
+	if n != 50 {
+		t.Errorf("expected 50 rows written, got %d", n)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to parse CSV: %v", err)
+	}
+	if len(records) != 51 {
+		t.Fatalf("expected a header and 50 rows, got %d records", len(records))
+	}
+	if !reflect.DeepEqual(records[0], []string{"id", "name", "email"}) {
+		t.Errorf("unexpected header: %v", records[0])
+	}
+	for i, record := range records[1:] {
+		want := []string{fmt.Sprint(i + 1), fmt.Sprintf("User %d", i+1), fmt.Sprintf("user%d@example.com", i+1)}
+		if !reflect.DeepEqual(record, want) {
+			t.Errorf("row %d = %v, want %v", i+1, record, want)
+		}
+	}
+
+	buf.Reset()
+	n, err = db.CopyTo(ctx, &buf, &TestUser{}, "id > ?", 45)
+	if err != nil {
+		t.Fatalf("failed to copy rows: %v", err)
+	}
+	if n != 5 {
+		t.Errorf("expected 5 rows written, got %d", n)
+	}
+}
@@ -0,0 +1,151 @@
+package theory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wilburhimself/theory/migration"
+)
+
+// CreateIndex creates an index directly, without going through a migration
+func (db *DB) CreateIndex(ctx context.Context, op *migration.CreateIndex) error {
+	return db.execOperation(ctx, "create index", op.Table, op)
+}
+
+// DropIndex drops an index directly, without going through a migration
+func (db *DB) DropIndex(ctx context.Context, op *migration.DropIndex) error {
+	return db.execOperation(ctx, "drop index", op.Table, op)
+}
+
+// execOperation runs a single migration operation against the primary
+func (db *DB) execOperation(ctx context.Context, operation, table string, op migration.Operation) error {
+	db = db.inContextTx(ctx)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	exec, release, err := db.acquire(ctx, db.Primary())
+	if err != nil {
+		return wrapError(operation, table, err)
+	}
+	defer release()
+
+	_, err = exec.ExecContext(ctx, db.rebind(migration.DialectSQL(op, migration.DialectFromDriver(db.driver))), op.Args()...)
+	return wrapError(operation, table, err)
+}
+
+// AddForeignKey adds a foreign key constraint directly. SQLite cannot alter
+// constraints on existing tables without rebuilding them, so
+// ErrUnsupportedOperation is returned for SQLite databases.
+func (db *DB) AddForeignKey(ctx context.Context, op *migration.AddForeignKey) error {
+	if db.isSQLite() {
+		return wrapError("add foreign key", op.Table, ErrUnsupportedOperation)
+	}
+	return db.execOperation(ctx, "add foreign key", op.Table, op)
+}
+
+// DropForeignKey drops a foreign key constraint directly. Like AddForeignKey,
+// it returns ErrUnsupportedOperation for SQLite databases.
+func (db *DB) DropForeignKey(ctx context.Context, op *migration.DropForeignKey) error {
+	if db.isSQLite() {
+		return wrapError("drop foreign key", op.Table, ErrUnsupportedOperation)
+	}
+	return db.execOperation(ctx, "drop foreign key", op.Table, op)
+}
+
+// AddUniqueConstraint adds a unique constraint directly. Like AddForeignKey,
+// it returns ErrUnsupportedOperation for SQLite databases, where a unique
+// index created with CreateIndex serves the same purpose.
+func (db *DB) AddUniqueConstraint(ctx context.Context, op *migration.AddUniqueConstraint) error {
+	if db.isSQLite() {
+		return wrapError("add unique constraint", op.Table, ErrUnsupportedOperation)
+	}
+	return db.execOperation(ctx, "add unique constraint", op.Table, op)
+}
+
+// DropUniqueConstraint drops a unique constraint directly. It returns
+// ErrUnsupportedOperation for SQLite databases.
+func (db *DB) DropUniqueConstraint(ctx context.Context, op *migration.DropUniqueConstraint) error {
+	if db.isSQLite() {
+		return wrapError("drop unique constraint", op.Table, ErrUnsupportedOperation)
+	}
+	return db.execOperation(ctx, "drop unique constraint", op.Table, op)
+}
+
+// AlterColumn changes a column's type, nullability and default directly.
+// SQLite cannot alter columns, so ErrRequiresTableRebuild is returned for
+// SQLite databases, describing the steps to rebuild the table instead.
+func (db *DB) AlterColumn(ctx context.Context, op *migration.AlterColumn) error {
+	if db.isSQLite() {
+		return wrapError("alter column", op.Table, op.Validate(migration.DialectSQLite))
+	}
+	return db.execOperation(ctx, "alter column", op.Table, op)
+}
+
+// TruncateTable removes all rows from a table directly
+func (db *DB) TruncateTable(ctx context.Context, op *migration.TruncateTable) error {
+	return db.execOperation(ctx, "truncate table", op.Name, op)
+}
+
+// AddColumn adds a column to the model's table directly. Adding a NOT NULL
+// column to a table with rows fails on most databases, so new columns
+// usually need IsNull.
+func (db *DB) AddColumn(ctx context.Context, m interface{}, col migration.Column) error {
+	metadata, err := db.metadata(m)
+	if err != nil {
+		return err
+	}
+	return db.execOperation(ctx, "add column", metadata.TableName, &migration.AddColumn{Table: metadata.TableName, Column: col})
+}
+
+// DropColumn drops a column from the model's table directly. SQLite cannot
+// drop primary key or indexed columns, including those with a unique
+// constraint, so a descriptive error is returned for them up front.
+func (db *DB) DropColumn(ctx context.Context, m interface{}, column string) error {
+	db = db.inContextTx(ctx)
+	metadata, err := db.metadata(m)
+	if err != nil {
+		return err
+	}
+	table := metadata.TableName
+
+	if db.isSQLite() {
+		if err := db.checkDropColumn(ctx, table, column); err != nil {
+			return wrapError("drop column", table, err)
+		}
+	}
+
+	return db.execOperation(ctx, "drop column", table, &migration.DropColumn{Table: table, Column: column})
+}
+
+// checkDropColumn reports why SQLite would refuse to drop a column
+func (db *DB) checkDropColumn(ctx context.Context, table, column string) error {
+	columns, err := db.GetColumns(ctx, table)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, col := range columns {
+		if col.Name == column {
+			found = true
+			if col.IsPK {
+				return fmt.Errorf("cannot drop primary key column %s", column)
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("column %s does not exist", column)
+	}
+
+	var index string
+	err = db.queryRow(ctx,
+		"SELECT il.name FROM pragma_index_list(?) il JOIN pragma_index_info(il.name) ii WHERE ii.name = ?",
+		[]interface{}{table, column}, &index)
+	switch {
+	case err == ErrRecordNotFound:
+		return nil
+	case err != nil:
+		return err
+	}
+	return fmt.Errorf("cannot drop column %s: it is part of index %s; drop the index or unique constraint first", column, index)
+}
@@ -0,0 +1,435 @@
+package theory
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wilburhimself/theory/migration"
+)
+
+// indexNames returns the names of the indexes on a SQLite table
+func indexNames(t *testing.T, db *DB, table string) map[string]bool {
+	rows, err := db.Primary().Query("SELECT name FROM pragma_index_list(?)", table)
+	if err != nil {
+		t.Fatalf("failed to list indexes: %v", err)
+	}
+	defer rows.Close()
+
+	names := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("failed to scan index name: %v", err)
+		}
+		names[name] = true
+	}
+	return names
+}
+
+func TestCreateAndDropIndex(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	err := db.CreateIndex(ctx, &migration.CreateIndex{
+		Table: "test_user",
+		Index: migration.Index{
+			Name:    "idx_test_user_email",
+			Columns: []string{"email"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create index: %v", err)
+	}
+
+	if !indexNames(t, db, "test_user")["idx_test_user_email"] {
+		t.Fatal("expected idx_test_user_email to exist")
+	}
+
+	err = db.DropIndex(ctx, &migration.DropIndex{Table: "test_user", Name: "idx_test_user_email"})
+	if err != nil {
+		t.Fatalf("failed to drop index: %v", err)
+	}
+
+	if indexNames(t, db, "test_user")["idx_test_user_email"] {
+		t.Error("expected idx_test_user_email to be dropped")
+	}
+
+	err = db.DropIndex(ctx, &migration.DropIndex{Table: "test_user", Name: "idx_test_user_email"})
+	if err == nil {
+		t.Error("expected error when dropping a missing index")
+	}
+}
+
+func TestForeignKeyOperations(t *testing.T) {
+	addFK := &migration.AddForeignKey{
+		Table: "posts",
+		ForeignKey: migration.ForeignKey{
+			Columns:    []string{"user_id"},
+			RefTable:   "users",
+			RefColumns: []string{"id"},
+			OnDelete:   "CASCADE",
+		},
+	}
+	dropFK := &migration.DropForeignKey{Table: "posts", Name: "posts_user_id_fk"}
+
+	for _, driverName := range []string{"postgres", "mysql"} {
+		t.Run(driverName, func(t *testing.T) {
+			rec, dsn := newRecorder(t)
+			db, err := Connect(Config{Driver: driverName, DSN: dsn})
+			if err != nil {
+				t.Fatalf("failed to connect to database: %v", err)
+			}
+			defer db.Close()
+
+			ctx := context.Background()
+			if err := db.AddForeignKey(ctx, addFK); err != nil {
+				t.Fatalf("failed to add foreign key: %v", err)
+			}
+			if query, _ := rec.LastQuery(); query != addFK.SQL() {
+				t.Errorf("executed %q, want %q", query, addFK.SQL())
+			}
+
+			if err := db.DropForeignKey(ctx, dropFK); err != nil {
+				t.Fatalf("failed to drop foreign key: %v", err)
+			}
+			if query, _ := rec.LastQuery(); query != dropFK.SQL() {
+				t.Errorf("executed %q, want %q", query, dropFK.SQL())
+			}
+		})
+	}
+
+	t.Run("sqlite3", func(t *testing.T) {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+
+		ctx := context.Background()
+		if err := db.AddForeignKey(ctx, addFK); !errors.Is(err, ErrUnsupportedOperation) {
+			t.Errorf("AddForeignKey() error = %v, want %v", err, ErrUnsupportedOperation)
+		}
+		if err := db.DropForeignKey(ctx, dropFK); !errors.Is(err, ErrUnsupportedOperation) {
+			t.Errorf("DropForeignKey() error = %v, want %v", err, ErrUnsupportedOperation)
+		}
+	})
+}
+
+func TestMigratorForeignKeys(t *testing.T) {
+	addFK := &migration.AddForeignKey{
+		Table: "posts",
+		ForeignKey: migration.ForeignKey{
+			Columns:    []string{"user_id"},
+			RefTable:   "users",
+			RefColumns: []string{"id"},
+			OnDelete:   "SET NULL",
+			OnUpdate:   "CASCADE",
+		},
+	}
+	mig := migration.NewMigration("add_posts_user_fk")
+	mig.Up = []migration.Operation{addFK}
+	mig.Down = []migration.Operation{addFK.Drop()}
+
+	rec, dsn := newRecorder(t)
+	rec.result = func(query string) ([]string, [][]driver.Value) {
+		switch {
+		case strings.Contains(query, "MAX(batch)"):
+			return []string{"batch"}, [][]driver.Value{{int64(1)}}
+		case strings.Contains(query, "SELECT id, name") && strings.Contains(strings.Join(rec.Queries(), "\n"), "INSERT INTO migrations"):
+			now := time.Now().Unix()
+			return []string{"id", "name", "timestamp", "applied", "batch", "squashed_by"},
+				[][]driver.Value{{mig.ID, mig.Name, mig.Timestamp.Unix(), now, int64(1), nil}}
+		}
+		return nil, nil
+	}
+
+	db, err := Connect(Config{Driver: "postgres", DSN: dsn})
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	db.Migrator().Add(mig)
+	if _, err := db.Migrator().Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if _, err := db.Migrator().Down(ctx); err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+
+	queries := strings.Join(rec.Queries(), "\n")
+	for _, want := range []string{
+		"ALTER TABLE posts ADD CONSTRAINT posts_user_id_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL ON UPDATE CASCADE",
+		"ALTER TABLE posts DROP CONSTRAINT posts_user_id_fk",
+	} {
+		if !strings.Contains(queries, want) {
+			t.Errorf("expected %q to be executed, got:\n%s", want, queries)
+		}
+	}
+}
+
+func TestUniqueConstraintOperations(t *testing.T) {
+	addUnique := &migration.AddUniqueConstraint{Table: "memberships", Name: "memberships_team_user_key", Columns: []string{"team_id", "user_id"}}
+	dropUnique := &migration.DropUniqueConstraint{Table: "memberships", Name: "memberships_team_user_key"}
+
+	for _, driverName := range []string{"postgres", "mysql"} {
+		t.Run(driverName, func(t *testing.T) {
+			rec, dsn := newRecorder(t)
+			db, err := Connect(Config{Driver: driverName, DSN: dsn})
+			if err != nil {
+				t.Fatalf("failed to connect to database: %v", err)
+			}
+			defer db.Close()
+
+			ctx := context.Background()
+			if err := db.AddUniqueConstraint(ctx, addUnique); err != nil {
+				t.Fatalf("failed to add unique constraint: %v", err)
+			}
+			if query, _ := rec.LastQuery(); query != addUnique.SQL() {
+				t.Errorf("executed %q, want %q", query, addUnique.SQL())
+			}
+
+			if err := db.DropUniqueConstraint(ctx, dropUnique); err != nil {
+				t.Fatalf("failed to drop unique constraint: %v", err)
+			}
+			if query, _ := rec.LastQuery(); query != dropUnique.SQL() {
+				t.Errorf("executed %q, want %q", query, dropUnique.SQL())
+			}
+		})
+	}
+
+	t.Run("sqlite3", func(t *testing.T) {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+
+		ctx := context.Background()
+		if err := db.AddUniqueConstraint(ctx, addUnique); !errors.Is(err, ErrUnsupportedOperation) {
+			t.Errorf("AddUniqueConstraint() error = %v, want %v", err, ErrUnsupportedOperation)
+		}
+		if err := db.DropUniqueConstraint(ctx, dropUnique); !errors.Is(err, ErrUnsupportedOperation) {
+			t.Errorf("DropUniqueConstraint() error = %v, want %v", err, ErrUnsupportedOperation)
+		}
+	})
+}
+
+func TestAlterColumn(t *testing.T) {
+	op := &migration.AlterColumn{Table: "test_user", Column: migration.Column{Name: "email", Type: "VARCHAR(255)", IsNull: true}}
+
+	rec, dsn := newRecorder(t)
+	db, err := Connect(Config{Driver: "postgres", DSN: dsn})
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.AlterColumn(context.Background(), op); err != nil {
+		t.Fatalf("failed to alter column: %v", err)
+	}
+	want := "ALTER TABLE test_user ALTER COLUMN email TYPE VARCHAR(255), ALTER COLUMN email DROP NOT NULL, ALTER COLUMN email DROP DEFAULT"
+	if query, _ := rec.LastQuery(); query != want {
+		t.Errorf("executed %q, want %q", query, want)
+	}
+
+	t.Run("sqlite3", func(t *testing.T) {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+
+		if err := db.AlterColumn(context.Background(), op); !errors.Is(err, ErrRequiresTableRebuild) {
+			t.Errorf("AlterColumn() error = %v, want %v", err, ErrRequiresTableRebuild)
+		}
+	})
+}
+
+func TestTruncateTable(t *testing.T) {
+	op := &migration.TruncateTable{Name: "test_user", RestartIdentity: true}
+	for driverName, want := range map[string]string{
+		"postgres": "TRUNCATE TABLE test_user RESTART IDENTITY",
+		"mysql":    "TRUNCATE TABLE test_user",
+	} {
+		t.Run(driverName, func(t *testing.T) {
+			rec, dsn := newRecorder(t)
+			db, err := Connect(Config{Driver: driverName, DSN: dsn})
+			if err != nil {
+				t.Fatalf("failed to connect to database: %v", err)
+			}
+			defer db.Close()
+
+			if err := db.TruncateTable(context.Background(), op); err != nil {
+				t.Fatalf("failed to truncate table: %v", err)
+			}
+			if query, _ := rec.LastQuery(); query != want {
+				t.Errorf("executed %q, want %q", query, want)
+			}
+		})
+	}
+
+	t.Run("sqlite3", func(t *testing.T) {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+
+		ctx := context.Background()
+		if err := db.Create(ctx, &TestUser{Name: "Jo"}); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+		if err := db.TruncateTable(ctx, op); err != nil {
+			t.Fatalf("failed to truncate table: %v", err)
+		}
+		var users []TestUser
+		if err := db.Find(ctx, &users, ""); err != nil || len(users) != 0 {
+			t.Errorf("expected no users, got %v (%v)", users, err)
+		}
+	})
+}
+
+type TestGizmo struct {
+	ID    int    `db:"id,pk,auto"`
+	Name  string `db:"name"`
+	Code  string `db:"code,unique"`
+	Notes string `db:"notes,null"`
+}
+
+func TestMigratorLock(t *testing.T) {
+	for name, want := range map[string][]string{
+		"postgres": {"SELECT pg_advisory_lock(hashtext($1))", "SELECT pg_advisory_unlock(hashtext($1))"},
+		"mysql":    {"SELECT GET_LOCK(?, -1)", "SELECT RELEASE_LOCK(?)"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec, dsn := newRecorder(t)
+			rec.result = func(query string) ([]string, [][]driver.Value) {
+				switch {
+				case strings.Contains(query, "GET_LOCK"):
+					return []string{"locked"}, [][]driver.Value{{int64(1)}}
+				case strings.Contains(query, "MAX(batch)"):
+					return []string{"batch"}, [][]driver.Value{{int64(0)}}
+				}
+				return nil, nil
+			}
+
+			db, err := Connect(Config{Driver: name, DSN: dsn})
+			if err != nil {
+				t.Fatalf("failed to connect to database: %v", err)
+			}
+			defer db.Close()
+
+			if _, err := db.Migrator().Up(context.Background()); err != nil {
+				t.Fatalf("Up() error = %v", err)
+			}
+
+			var locks []string
+			for _, query := range rec.Queries() {
+				if strings.Contains(query, "LOCK") || strings.Contains(query, "advisory") {
+					locks = append(locks, query)
+				}
+			}
+			if strings.Join(locks, "\n") != strings.Join(want, "\n") {
+				t.Errorf("lock queries = %q, want %q", locks, want)
+			}
+		})
+	}
+}
+
+func TestExportSchemaInformationSchema(t *testing.T) {
+	for name, want := range map[string]string{
+		"postgres": "WHERE table_schema = current_schema() AND table_name <> $1",
+		"mysql":    "WHERE table_schema = DATABASE() AND table_name <> ?",
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec, dsn := newRecorder(t)
+			db, err := Connect(Config{Driver: name, DSN: dsn})
+			if err != nil {
+				t.Fatalf("failed to connect to database: %v", err)
+			}
+			defer db.Close()
+
+			if _, err := db.Migrator().ExportSchema(context.Background()); err != nil {
+				t.Fatalf("ExportSchema() error = %v", err)
+			}
+			if query, _ := rec.LastQuery(); !strings.Contains(query, want) {
+				t.Errorf("expected %q in the query, got:\n%s", want, query)
+			}
+		})
+	}
+}
+
+func TestDropColumn(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := db.AutoMigrate(ctx, &TestGizmo{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	hasColumn := func(name string) bool {
+		columns, err := db.GetColumns(ctx, "test_gizmo")
+		if err != nil {
+			t.Fatalf("failed to get columns: %v", err)
+		}
+		for _, col := range columns {
+			if col.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !hasColumn("notes") {
+		t.Fatal("expected notes column to exist")
+	}
+	if err := db.DropColumn(ctx, &TestGizmo{}, "notes"); err != nil {
+		t.Fatalf("failed to drop column: %v", err)
+	}
+	if hasColumn("notes") {
+		t.Error("expected notes column to be dropped")
+	}
+
+	for _, column := range []string{"id", "code", "missing"} {
+		if err := db.DropColumn(ctx, &TestGizmo{}, column); err == nil {
+			t.Errorf("expected error dropping %s", column)
+		}
+	}
+	if !hasColumn("code") {
+		t.Error("expected unique column to be kept")
+	}
+}
+
+func TestAddColumn(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	err := db.AddColumn(ctx, &TestUser{}, migration.Column{Name: "nickname", Type: "TEXT", IsNull: true})
+	if err != nil {
+		t.Fatalf("failed to add column: %v", err)
+	}
+
+	columns, err := db.GetColumns(ctx, "test_user")
+	if err != nil {
+		t.Fatalf("failed to get columns: %v", err)
+	}
+	last := columns[len(columns)-1]
+	if last.Name != "nickname" || last.Type != "TEXT" || !last.IsNull {
+		t.Errorf("expected nullable nickname column, got %+v", last)
+	}
+
+	type TestUser struct {
+		ID       int    `db:"id,pk,auto"`
+		Name     string `db:"name"`
+		Email    string `db:"email"`
+		Nickname string `db:"nickname"`
+	}
+	if err := db.Create(ctx, &TestUser{Name: "Jo", Nickname: "jojo"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	var user TestUser
+	if err := db.First(ctx, &user, 1); err != nil {
+		t.Fatalf("failed to find user: %v", err)
+	}
+	if user.Nickname != "jojo" {
+		t.Errorf("expected nickname to be stored, got %q", user.Nickname)
+	}
+}
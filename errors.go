@@ -0,0 +1,111 @@
+package theory
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/wilburhimself/theory/migration"
+)
+
+// Constraint violation errors. Driver errors are wrapped with one of these
+// so callers can use errors.Is without depending on driver-specific codes.
+var (
+	ErrUniqueConstraint    = errors.New("unique constraint violation")
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+	ErrNotNullViolation    = errors.New("not null violation")
+	ErrCheckViolation      = errors.New("check constraint violation")
+)
+
+// ErrUnsupportedOperation is returned when the database does not support
+// the requested operation. It is migration.ErrUnsupportedOperation, so
+// migration failures match it too.
+var ErrUnsupportedOperation = migration.ErrUnsupportedOperation
+
+// ErrRequiresTableRebuild is returned for column changes SQLite can only
+// make by rebuilding the table. It is migration.ErrRequiresTableRebuild.
+var ErrRequiresTableRebuild = migration.ErrRequiresTableRebuild
+
+// ErrInvalidConfig is returned by Config.Validate and Connect when the
+// configuration cannot be used to connect
+var ErrInvalidConfig = errors.New("invalid config")
+
+// ErrColumnTypeMismatch is returned by AutoMigrate with Config.StrictTyping
+// when a live column's type differs from the type mapped from the model
+var ErrColumnTypeMismatch = errors.New("column type mismatch")
+
+// AutoMigrateError holds the errors of the models AutoMigrate failed to
+// migrate. errors.Is and errors.As match any of them.
+type AutoMigrateError []error
+
+func (e AutoMigrateError) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d models failed to migrate: %s", len(e), strings.Join(messages, "; "))
+}
+
+// Unwrap returns the individual errors
+func (e AutoMigrateError) Unwrap() []error {
+	return e
+}
+
+// translateError wraps known driver errors with the matching constraint
+// error, keeping the original driver error in the chain
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return fmt.Errorf("%w: %w", ErrUniqueConstraint, err)
+		case sqlite3.ErrConstraintForeignKey:
+			return fmt.Errorf("%w: %w", ErrForeignKeyViolation, err)
+		case sqlite3.ErrConstraintNotNull:
+			return fmt.Errorf("%w: %w", ErrNotNullViolation, err)
+		case sqlite3.ErrConstraintCheck:
+			return fmt.Errorf("%w: %w", ErrCheckViolation, err)
+		}
+	}
+
+	return err
+}
+
+// DBError describes a failed database operation. The driver error is
+// available through Unwrap, so errors.Is and errors.As keep working.
+type DBError struct {
+	Operation string
+	Table     string
+	Cause     error
+}
+
+func (e *DBError) Error() string {
+	if e.Table == "" {
+		return fmt.Sprintf("%s: %v", e.Operation, e.Cause)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Operation, e.Table, e.Cause)
+}
+
+// Unwrap returns the underlying cause
+func (e *DBError) Unwrap() error {
+	return e.Cause
+}
+
+// wrapError wraps err in a DBError for the given operation and table,
+// translating known driver errors on the way
+func wrapError(operation, table string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &DBError{Operation: operation, Table: table, Cause: translateError(err)}
+}
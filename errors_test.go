@@ -0,0 +1,164 @@
+package theory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/wilburhimself/theory/model"
+)
+
+type TestAuthor struct {
+	ID    int    `db:"id,pk,auto"`
+	Email string `db:"email"`
+}
+
+type TestBook struct {
+	ID       int    `db:"id,pk,auto"`
+	AuthorID int    `db:"author_id"`
+	Title    string `db:"title"`
+	Pages    int    `db:"pages"`
+}
+
+// TestBookWithNullTitle maps to test_book but writes NULL titles
+type TestBookWithNullTitle struct {
+	ID       int     `db:"id,pk,auto"`
+	AuthorID int     `db:"author_id"`
+	Title    *string `db:"title,null"`
+	Pages    int     `db:"pages"`
+}
+
+func (b *TestBookWithNullTitle) TableName() string {
+	return "test_book"
+}
+
+func (b *TestBookWithNullTitle) PrimaryKey() *model.Field {
+	return nil
+}
+
+func setupConstraintDB(t *testing.T) (*DB, func()) {
+	db, err := Connect(Config{Driver: "sqlite3", DSN: "file::memory:?_foreign_keys=on"})
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+
+	statements := []string{
+		"CREATE TABLE test_author (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT NOT NULL UNIQUE)",
+		`CREATE TABLE test_book (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			author_id INTEGER NOT NULL REFERENCES test_author (id),
+			title TEXT NOT NULL,
+			pages INTEGER NOT NULL CHECK (pages > 0)
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.Primary().Exec(stmt); err != nil {
+			db.Close()
+			t.Fatalf("failed to create tables: %v", err)
+		}
+	}
+
+	return db, func() {
+		db.Close()
+	}
+}
+
+func TestConstraintErrors(t *testing.T) {
+	db, cleanup := setupConstraintDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	author := &TestAuthor{Email: "author@example.com"}
+	if err := db.Create(ctx, author); err != nil {
+		t.Fatalf("failed to create author: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		model interface{}
+		want  error
+	}{
+		{
+			name:  "unique",
+			model: &TestAuthor{Email: "author@example.com"},
+			want:  ErrUniqueConstraint,
+		},
+		{
+			name:  "foreign key",
+			model: &TestBook{AuthorID: 999, Title: "Orphan", Pages: 10},
+			want:  ErrForeignKeyViolation,
+		},
+		{
+			name:  "not null",
+			model: &TestBookWithNullTitle{AuthorID: author.ID, Pages: 10},
+			want:  ErrNotNullViolation,
+		},
+		{
+			name:  "check",
+			model: &TestBook{AuthorID: author.ID, Title: "Empty", Pages: 0},
+			want:  ErrCheckViolation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.Create(ctx, tt.model)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Create() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranslateErrorPassthrough(t *testing.T) {
+	if translateError(nil) != nil {
+		t.Error("expected nil error to stay nil")
+	}
+
+	err := errors.New("some error")
+	if got := translateError(err); got != err {
+		t.Errorf("translateError() = %v, want %v", got, err)
+	}
+}
+
+func TestDBError(t *testing.T) {
+	db, cleanup := setupConstraintDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := db.Create(ctx, &TestAuthor{Email: "author@example.com"}); err != nil {
+		t.Fatalf("failed to create author: %v", err)
+	}
+
+	err := db.Create(ctx, &TestAuthor{Email: "author@example.com"})
+
+	var dbErr *DBError
+	if !errors.As(err, &dbErr) {
+		t.Fatalf("expected *DBError, got %T", err)
+	}
+	if dbErr.Operation != "create" {
+		t.Errorf("DBError.Operation = %v, want create", dbErr.Operation)
+	}
+	if dbErr.Table != "test_author" {
+		t.Errorf("DBError.Table = %v, want test_author", dbErr.Table)
+	}
+	if !errors.Is(err, ErrUniqueConstraint) {
+		t.Errorf("expected DBError to wrap ErrUniqueConstraint, got %v", err)
+	}
+
+	// Queries against a missing table are wrapped too
+	var users []TestUser
+	err = db.Find(ctx, &users, "")
+	if !errors.As(err, &dbErr) {
+		t.Fatalf("expected *DBError, got %T", err)
+	}
+	if dbErr.Operation != "find" || dbErr.Table != "test_user" {
+		t.Errorf("DBError = %+v, want find on test_user", dbErr)
+	}
+
+	// Not found is still reported as the sentinel error
+	err = db.First(ctx, &TestAuthor{}, 999)
+	if err != ErrRecordNotFound {
+		t.Errorf("expected ErrRecordNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package theory
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExplainResult holds the plan of a query run by ExplainAnalyze. Fields the
+// database does not report are left zero.
+type ExplainResult struct {
+	// Raw is the plan as output by the database
+	Raw string
+	// RowsEstimated is the number of rows the planner expected
+	RowsEstimated int64
+	// RowsActual is the number of rows the query returned
+	RowsActual int64
+	// TimeMs is the execution time of the query in milliseconds
+	TimeMs float64
+}
+
+// Patterns extracting the figures of an ExplainResult from the plan output
+var (
+	postgresPlanRows   = regexp.MustCompile(`"Plan Rows":\s*(\d+)`)
+	postgresActualRows = regexp.MustCompile(`"Actual Rows":\s*(\d+)`)
+	postgresTime       = regexp.MustCompile(`"Execution Time":\s*([\d.]+)`)
+	sqliteRows         = regexp.MustCompile(`~(\d+) rows`)
+)
+
+// ExplainAnalyze runs query and returns its plan along with the rows it
+// returned and how long it took. PostgreSQL uses EXPLAIN (ANALYZE, FORMAT
+// JSON). SQLite uses EXPLAIN QUERY PLAN, which does not run the query, so
+// the query is run after it to count rows and time it; its plan has no
+// estimate. Other databases return ErrUnsupportedOperation.
+//
+// The query is executed in both cases, so explaining a statement that
+// writes also applies the write.
+func (db *DB) ExplainAnalyze(ctx context.Context, query string, args ...interface{}) (*ExplainResult, error) {
+	db = db.inContextTx(ctx)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if db.dryRun {
+		db.logDryRun(query, args)
+		return &ExplainResult{}, nil
+	}
+
+	switch {
+	case db.isPostgres():
+		return db.explainPostgres(ctx, query, args)
+	case db.isSQLite():
+		return db.explainSQLite(ctx, query, args)
+	}
+	return nil, wrapError("explain", "", ErrUnsupportedOperation)
+}
+
+// explainPostgres explains a query on PostgreSQL
+func (db *DB) explainPostgres(ctx context.Context, query string, args []interface{}) (*ExplainResult, error) {
+	var raw string
+	if err := db.queryRow(ctx, "EXPLAIN (ANALYZE, FORMAT JSON) "+query, args, &raw); err != nil {
+		return nil, wrapError("explain", "", err)
+	}
+
+	return parsePostgresPlan(raw), nil
+}
+
+// parsePostgresPlan extracts the figures of a JSON plan. The first rows
+// figures are those of the top plan node.
+func parsePostgresPlan(raw string) *ExplainResult {
+	return &ExplainResult{
+		Raw:           raw,
+		RowsEstimated: matchInt(postgresPlanRows, raw),
+		RowsActual:    matchInt(postgresActualRows, raw),
+		TimeMs:        matchFloat(postgresTime, raw),
+	}
+}
+
+// explainSQLite explains a query on SQLite, then runs it
+func (db *DB) explainSQLite(ctx context.Context, query string, args []interface{}) (*ExplainResult, error) {
+	rows, release, err := db.query(ctx, db.Primary(), "EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		return nil, wrapError("explain", "", err)
+	}
+	var lines []string
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			rows.Close()
+			release()
+			return nil, wrapError("explain", "", err)
+		}
+		lines = append(lines, detail)
+	}
+	err = rows.Err()
+	rows.Close()
+	release()
+	if err != nil {
+		return nil, wrapError("explain", "", err)
+	}
+
+	result := &ExplainResult{Raw: strings.Join(lines, "\n")}
+	result.RowsEstimated = matchInt(sqliteRows, result.Raw)
+
+	start := time.Now()
+	rows, release, err = db.query(ctx, db.Primary(), query, args...)
+	if err != nil {
+		return nil, wrapError("explain", "", err)
+	}
+	defer release()
+	defer rows.Close()
+	for rows.Next() {
+		result.RowsActual++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapError("explain", "", err)
+	}
+	result.TimeMs = float64(time.Since(start).Microseconds()) / 1000
+	return result, nil
+}
+
+// matchInt returns the integer captured by the first match of re in s, or 0
+func matchInt(re *regexp.Regexp, s string) int64 {
+	if m := re.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.ParseInt(m[1], 10, 64)
+		return n
+	}
+	return 0
+}
+
+// matchFloat returns the number captured by the first match of re in s, or 0
+func matchFloat(re *regexp.Regexp, s string) float64 {
+	if m := re.FindStringSubmatch(s); m != nil {
+		f, _ := strconv.ParseFloat(m[1], 64)
+		return f
+	}
+	return 0
+}
@@ -0,0 +1,62 @@
+package theory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExplainAnalyze(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		user := &TestUser{Name: fmt.Sprintf("user%d", i%4), Email: fmt.Sprintf("user%d@example.com", i)}
+		if err := db.Create(ctx, user); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	const query = "SELECT * FROM test_user WHERE name = ?"
+	scan, err := db.ExplainAnalyze(ctx, query, "user1")
+	if err != nil {
+		t.Fatalf("ExplainAnalyze() error = %v", err)
+	}
+	if !strings.Contains(scan.Raw, "SCAN") {
+		t.Errorf("expected a table scan without an index, got %q", scan.Raw)
+	}
+
+	if _, err := db.Primary().Exec("CREATE INDEX idx_test_user_name ON test_user (name)"); err != nil {
+		t.Fatalf("failed to create index: %v", err)
+	}
+	search, err := db.ExplainAnalyze(ctx, query, "user1")
+	if err != nil {
+		t.Fatalf("ExplainAnalyze() error = %v", err)
+	}
+	if !strings.Contains(search.Raw, "idx_test_user_name") {
+		t.Errorf("expected the index to be used, got %q", search.Raw)
+	}
+
+	if scan.RowsActual != 5 || search.RowsActual != scan.RowsActual {
+		t.Errorf("RowsActual = %d without index, %d with index, want 5 for both", scan.RowsActual, search.RowsActual)
+	}
+	if scan.TimeMs < 0 || search.TimeMs < 0 {
+		t.Errorf("expected non-negative times, got %v and %v", scan.TimeMs, search.TimeMs)
+	}
+
+	if _, err := db.ExplainAnalyze(ctx, "SELECT * FROM missing_table"); err == nil {
+		t.Error("expected error for a missing table")
+	}
+}
+
+func TestParsePostgresPlan(t *testing.T) {
+	raw := `[{"Plan": {"Node Type": "Index Scan", "Plan Rows": 5, "Actual Rows": 4,
+		"Plans": [{"Plan Rows": 100, "Actual Rows": 90}]}, "Planning Time": 0.1, "Execution Time": 0.257}]`
+
+	got := parsePostgresPlan(raw)
+	if got.Raw != raw || got.RowsEstimated != 5 || got.RowsActual != 4 || got.TimeMs != 0.257 {
+		t.Errorf("parsePostgresPlan() = %+v, want 5 estimated, 4 actual rows in 0.257ms", got)
+	}
+}
@@ -0,0 +1,101 @@
+package theory
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// BeforeCreator is implemented by models that run code before being inserted.
+// Returning an error aborts the insert.
+type BeforeCreator interface {
+	BeforeCreate(ctx context.Context) error
+}
+
+// AfterCreator is implemented by models that run code after being inserted
+type AfterCreator interface {
+	AfterCreate(ctx context.Context) error
+}
+
+// BeforeUpdater is implemented by models that run code before being updated.
+// Returning an error aborts the update.
+type BeforeUpdater interface {
+	BeforeUpdate(ctx context.Context) error
+}
+
+// AfterUpdater is implemented by models that run code after being updated
+type AfterUpdater interface {
+	AfterUpdate(ctx context.Context) error
+}
+
+// BeforeDeleter is implemented by models that run code before being deleted.
+// Returning an error aborts the delete.
+type BeforeDeleter interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+// AfterDeleter is implemented by models that run code after being deleted
+type AfterDeleter interface {
+	AfterDelete(ctx context.Context) error
+}
+
+// HookError is returned when a model hook fails. The hook's error is
+// available through Unwrap, so errors.Is and errors.As keep working.
+type HookError struct {
+	ModelType string
+	Hook      string
+	Cause     error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s.%s: %v", e.ModelType, e.Hook, e.Cause)
+}
+
+// Unwrap returns the underlying cause
+func (e *HookError) Unwrap() error {
+	return e.Cause
+}
+
+// runHook calls the named hook on m if m implements it, wrapping a failure
+// in a HookError. Hooks are not run for sessions created with SkipHooks.
+func (db *DB) runHook(ctx context.Context, m interface{}, hook string) error {
+	if db.skipHooks {
+		return nil
+	}
+
+	if err := callHook(ctx, m, hook); err != nil {
+		return &HookError{ModelType: reflect.Indirect(reflect.ValueOf(m)).Type().Name(), Hook: hook, Cause: err}
+	}
+	return nil
+}
+
+// callHook calls the named hook on m if m implements it
+func callHook(ctx context.Context, m interface{}, hook string) error {
+	switch hook {
+	case "BeforeCreate":
+		if h, ok := m.(BeforeCreator); ok {
+			return h.BeforeCreate(ctx)
+		}
+	case "AfterCreate":
+		if h, ok := m.(AfterCreator); ok {
+			return h.AfterCreate(ctx)
+		}
+	case "BeforeUpdate":
+		if h, ok := m.(BeforeUpdater); ok {
+			return h.BeforeUpdate(ctx)
+		}
+	case "AfterUpdate":
+		if h, ok := m.(AfterUpdater); ok {
+			return h.AfterUpdate(ctx)
+		}
+	case "BeforeDelete":
+		if h, ok := m.(BeforeDeleter); ok {
+			return h.BeforeDelete(ctx)
+		}
+	case "AfterDelete":
+		if h, ok := m.(AfterDeleter); ok {
+			return h.AfterDelete(ctx)
+		}
+	}
+	return nil
+}
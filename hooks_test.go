@@ -0,0 +1,38 @@
+package theory
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestHookError(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := db.AutoMigrate(ctx, &TestHookedUser{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	err := db.Create(ctx, &TestHookedUser{})
+
+	var hookErr *HookError
+	if !errors.As(err, &hookErr) {
+		t.Fatalf("expected HookError, got %v", err)
+	}
+	if hookErr.ModelType != "TestHookedUser" || hookErr.Hook != "BeforeCreate" || hookErr.Cause != errHookRejected {
+		t.Errorf("unexpected HookError fields: %+v", hookErr)
+	}
+	if want := "TestHookedUser.BeforeCreate: rejected by hook"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	var count int
+	if err := db.Primary().QueryRow("SELECT COUNT(*) FROM test_hooked_user").Scan(&count); err != nil {
+		t.Fatalf("failed to count rows: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("expected insert to be aborted, found %d rows", count)
+	}
+}
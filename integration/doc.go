@@ -0,0 +1,6 @@
+// Package integration runs the theory test suite against real databases in
+// containers. The tests are only built with the integration build tag and
+// need a running Docker daemon:
+//
+//	go test -tags integration ./integration/...
+package integration
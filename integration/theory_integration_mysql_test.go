@@ -0,0 +1,256 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/wilburhimself/theory"
+	"github.com/wilburhimself/theory/migration"
+)
+
+type Article struct {
+	ID          int       `db:"id,pk,auto"`
+	Title       string    `db:"title,type=VARCHAR(255)"`
+	Featured    bool      `db:"featured,type=TINYINT(1)"`
+	PublishedAt time.Time `db:"published_at,type=DATETIME"`
+	Status      string    `db:"status,type=ENUM('draft','published')"`
+}
+
+// setupMySQL starts a MySQL container and connects to it. The container is
+// terminated when the test finishes.
+func setupMySQL(t *testing.T) *theory.DB {
+	t.Helper()
+	ctx := context.Background()
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "mysql:8.0",
+			ExposedPorts: []string{"3306/tcp"},
+			Env: map[string]string{
+				"MYSQL_ROOT_PASSWORD": "theory",
+				"MYSQL_DATABASE":      "theory",
+			},
+			WaitingFor: wait.ForLog("port: 3306  MySQL Community Server").
+				WithStartupTimeout(2 * time.Minute),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to start mysql container: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := container.Terminate(ctx); err != nil {
+			t.Errorf("failed to terminate mysql container: %v", err)
+		}
+	})
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		t.Fatalf("failed to get container host: %v", err)
+	}
+	port, err := container.MappedPort(ctx, "3306/tcp")
+	if err != nil {
+		t.Fatalf("failed to get container port: %v", err)
+	}
+
+	dsn := fmt.Sprintf("root:theory@tcp(%s:%s)/theory?parseTime=true", host, port.Port())
+	db, err := theory.Connect(theory.Config{Driver: "mysql", DSN: dsn})
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestMySQLColumnTypes(t *testing.T) {
+	db := setupMySQL(t)
+	ctx := context.Background()
+
+	if err := db.AutoMigrate(ctx, &Article{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	columns, err := db.GetColumns(ctx, "article")
+	if err != nil {
+		t.Fatalf("failed to get columns: %v", err)
+	}
+	types := make(map[string]string, len(columns))
+	for _, col := range columns {
+		types[col.Name] = col.Type
+	}
+	for name, want := range map[string]string{
+		"featured":     "tinyint(1)",
+		"published_at": "datetime",
+		"status":       "enum('draft','published')",
+	} {
+		if got := types[name]; got != want {
+			t.Errorf("column %s has type %q, want %q", name, got, want)
+		}
+	}
+
+	publishedAt := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	article := &Article{Title: "Hello", Featured: true, PublishedAt: publishedAt, Status: "published"}
+	if err := db.Create(ctx, article); err != nil {
+		t.Fatalf("failed to create article: %v", err)
+	}
+
+	var found Article
+	if err := db.First(ctx, &found, article.ID); err != nil {
+		t.Fatalf("failed to find article: %v", err)
+	}
+	if !found.Featured || !found.PublishedAt.Equal(publishedAt) || found.Status != "published" {
+		t.Errorf("found %+v, want %+v", found, *article)
+	}
+
+	// Strict mode rejects values outside the ENUM
+	if err := db.Create(ctx, &Article{Title: "Bad", PublishedAt: publishedAt, Status: "archived"}); err == nil {
+		t.Error("expected error inserting a value outside the ENUM")
+	}
+}
+
+func TestMySQLLastInsertID(t *testing.T) {
+	db := setupMySQL(t)
+	ctx := context.Background()
+
+	if err := db.AutoMigrate(ctx, &Customer{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	for want := 1; want <= 3; want++ {
+		user := &Customer{Name: fmt.Sprintf("user%d", want)}
+		if err := db.Create(ctx, user); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+		if user.ID != want {
+			t.Errorf("user ID = %d, want %d", user.ID, want)
+		}
+	}
+
+	// LAST_INSERT_ID is per connection, so IDs set inside a transaction
+	// must come from the transaction's connection
+	tx, err := db.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	user := &Customer{Name: "in transaction"}
+	if err := tx.Create(ctx, user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if user.ID != 4 {
+		t.Errorf("user ID = %d, want 4", user.ID)
+	}
+
+	var found Customer
+	if err := db.First(ctx, &found, user.ID); err != nil || found.Name != "in transaction" {
+		t.Errorf("expected to find the user by its ID, got %+v, %v", found, err)
+	}
+}
+
+func TestMySQLTableOptions(t *testing.T) {
+	db := setupMySQL(t)
+	ctx := context.Background()
+
+	mig := migration.NewMigration("create_logs")
+	mig.Up = []migration.Operation{&migration.CreateTable{
+		Name: "logs",
+		Columns: []migration.Column{
+			{Name: "id", Type: "INTEGER", IsPK: true, IsAuto: true},
+			{Name: "message", Type: "VARCHAR", MaxLength: 255},
+		},
+		Engine:  "MyISAM",
+		Charset: "latin1",
+	}}
+	db.Migrator().Add(mig)
+	if _, err := db.Migrator().Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	var engine, collation string
+	if err := db.Primary().QueryRowContext(ctx,
+		"SELECT ENGINE, TABLE_COLLATION FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = 'logs'",
+	).Scan(&engine, &collation); err != nil {
+		t.Fatalf("failed to read table options: %v", err)
+	}
+	if engine != "MyISAM" {
+		t.Errorf("ENGINE = %q, want MyISAM", engine)
+	}
+	if !strings.HasPrefix(collation, "latin1_") {
+		t.Errorf("TABLE_COLLATION = %q, want a latin1 collation", collation)
+	}
+
+	// The auto-increment key is filled in by MySQL
+	for want := int64(1); want <= 2; want++ {
+		result, err := db.Primary().ExecContext(ctx, "INSERT INTO logs (message) VALUES (?)", "hello")
+		if err != nil {
+			t.Fatalf("failed to insert log: %v", err)
+		}
+		if id, err := result.LastInsertId(); err != nil || id != want {
+			t.Errorf("LastInsertId() = %d, %v, want %d", id, err, want)
+		}
+	}
+}
+
+func TestMySQLMigrationLock(t *testing.T) {
+	db := setupMySQL(t)
+	ctx := context.Background()
+	migrator := db.Migrator()
+
+	// Hold the lock Up takes on a connection of its own
+	conn, err := db.Primary().Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	defer conn.Close()
+	var locked int
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK('theory_migrations', -1)").Scan(&locked); err != nil || locked != 1 {
+		t.Fatalf("GET_LOCK = %d, %v", locked, err)
+	}
+
+	mig := migration.NewMigration("create_notes")
+	mig.Up = []migration.Operation{&migration.CreateTable{
+		Name:    "notes",
+		Columns: []migration.Column{{Name: "id", Type: "INTEGER", IsPK: true, IsAuto: true}},
+	}}
+	migrator.Add(mig)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := migrator.Up(ctx)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Up() returned while the lock was held: %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	if _, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK('theory_migrations')"); err != nil {
+		t.Fatalf("RELEASE_LOCK error = %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Up() error = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Up() did not finish after the lock was released")
+	}
+
+	if _, err := db.GetColumns(ctx, "notes"); err != nil {
+		t.Errorf("failed to get columns of notes: %v", err)
+	}
+}
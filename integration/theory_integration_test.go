@@ -0,0 +1,295 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/wilburhimself/theory"
+	"github.com/wilburhimself/theory/migration"
+)
+
+type Customer struct {
+	ID    int    `db:"id,pk,auto"`
+	Name  string `db:"name"`
+	Email string `db:"email"`
+}
+
+type Setting struct {
+	ID    int         `db:"id,pk,auto"`
+	Key   string      `db:"key"`
+	Value interface{} `db:"value"`
+}
+
+// setupPostgres starts a PostgreSQL container and connects to it. The
+// container is terminated when the test finishes.
+func setupPostgres(t *testing.T) *theory.DB {
+	t.Helper()
+	ctx := context.Background()
+
+	container, err := postgres.RunContainer(ctx,
+		testcontainers.WithImage("postgres:16-alpine"),
+		postgres.WithDatabase("theory"),
+		postgres.WithUsername("theory"),
+		postgres.WithPassword("theory"),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(time.Minute)),
+	)
+	if err != nil {
+		t.Fatalf("failed to start postgres container: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := container.Terminate(ctx); err != nil {
+			t.Errorf("failed to terminate postgres container: %v", err)
+		}
+	})
+
+	dsn, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		t.Fatalf("failed to get connection string: %v", err)
+	}
+
+	db, err := theory.Connect(theory.Config{Driver: "pgx", DSN: dsn})
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestPostgresCRUD(t *testing.T) {
+	db := setupPostgres(t)
+	ctx := context.Background()
+
+	if err := db.AutoMigrate(ctx, &Customer{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	user := &Customer{Name: "John Doe", Email: "john@example.com"}
+	if err := db.Create(ctx, user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if user.ID == 0 {
+		t.Fatal("expected RETURNING to set the user ID")
+	}
+
+	var found Customer
+	if err := db.First(ctx, &found, user.ID); err != nil {
+		t.Fatalf("failed to find user: %v", err)
+	}
+	if found != *user {
+		t.Errorf("found %+v, want %+v", found, *user)
+	}
+
+	user.Name = "Jane Doe"
+	if err := db.Update(ctx, user); err != nil {
+		t.Fatalf("failed to update user: %v", err)
+	}
+
+	var users []Customer
+	if err := db.Find(ctx, &users, "name = ?", "Jane Doe"); err != nil {
+		t.Fatalf("failed to find users: %v", err)
+	}
+	if len(users) != 1 || users[0].ID != user.ID {
+		t.Errorf("expected the updated user, got %+v", users)
+	}
+
+	if err := db.Delete(ctx, user); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+	if err := db.First(ctx, &found, user.ID); !errors.Is(err, theory.ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound after delete, got %v", err)
+	}
+}
+
+func TestPostgresJSON(t *testing.T) {
+	db := setupPostgres(t)
+	ctx := context.Background()
+
+	if err := db.AutoMigrate(ctx, &Setting{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	setting := &Setting{Key: "theme", Value: map[string]interface{}{"dark": true, "size": 12.0}}
+	if err := db.Create(ctx, setting); err != nil {
+		t.Fatalf("failed to create setting: %v", err)
+	}
+
+	var found Setting
+	if err := db.First(ctx, &found, setting.ID); err != nil {
+		t.Fatalf("failed to find setting: %v", err)
+	}
+	value, ok := found.Value.(map[string]interface{})
+	if !ok || value["dark"] != true || value["size"] != 12.0 {
+		t.Errorf("expected JSON value to round trip, got %#v", found.Value)
+	}
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	db := setupPostgres(t)
+	ctx := context.Background()
+
+	createPosts := migration.NewMigration("create_posts")
+	createPosts.Up = []migration.Operation{
+		&migration.CreateTable{
+			Name: "posts",
+			Columns: []migration.Column{
+				{Name: "id", Type: "INTEGER", IsPK: true, IsAuto: true},
+				{Name: "title", Type: "TEXT"},
+			},
+		},
+	}
+	createPosts.Down = []migration.Operation{&migration.DropTable{Name: "posts"}}
+
+	migrator := db.Migrator()
+	migrator.Add(createPosts)
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+	if version, err := migrator.Version(); err != nil || version != createPosts.ID {
+		t.Errorf("Version() = %q, %v, want %q", version, err, createPosts.ID)
+	}
+
+	if _, err := migrator.Down(ctx); err != nil {
+		t.Fatalf("failed to roll back migrations: %v", err)
+	}
+	if version, err := migrator.Version(); err != nil || version != "" {
+		t.Errorf("Version() after rollback = %q, %v, want none", version, err)
+	}
+}
+
+func TestPostgresUniqueConstraint(t *testing.T) {
+	db := setupPostgres(t)
+	ctx := context.Background()
+
+	if err := db.AutoMigrate(ctx, &Customer{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	err := db.AddUniqueConstraint(ctx, &migration.AddUniqueConstraint{Table: "customer", Name: "customer_email_key", Columns: []string{"email"}})
+	if err != nil {
+		t.Fatalf("failed to add unique constraint: %v", err)
+	}
+
+	if err := db.Create(ctx, &Customer{Name: "Ada", Email: "ada@example.com"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := db.Create(ctx, &Customer{Name: "Ada", Email: "ada@example.com"}); err == nil {
+		t.Error("expected the unique constraint to reject a duplicate email")
+	}
+
+	err = db.DropUniqueConstraint(ctx, &migration.DropUniqueConstraint{Table: "customer", Name: "customer_email_key"})
+	if err != nil {
+		t.Fatalf("failed to drop unique constraint: %v", err)
+	}
+	if err := db.Create(ctx, &Customer{Name: "Ada", Email: "ada@example.com"}); err != nil {
+		t.Errorf("expected duplicates after dropping the constraint, got %v", err)
+	}
+}
+
+type Invoice struct {
+	ID     int     `db:"id,pk,auto"`
+	Amount float64 `db:"amount,precision=10,2"`
+}
+
+func TestPostgresDecimalPrecision(t *testing.T) {
+	db := setupPostgres(t)
+	ctx := context.Background()
+
+	if err := db.AutoMigrate(ctx, &Invoice{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	// NUMERIC rounds extra decimal places to the scale
+	invoice := &Invoice{Amount: 12.3456}
+	if err := db.Create(ctx, invoice); err != nil {
+		t.Fatalf("failed to create invoice: %v", err)
+	}
+	var found Invoice
+	if err := db.First(ctx, &found, invoice.ID); err != nil {
+		t.Fatalf("failed to find invoice: %v", err)
+	}
+	if found.Amount != 12.35 {
+		t.Errorf("amount = %v, want 12.35", found.Amount)
+	}
+
+	// Values with more integer digits than precision - scale are rejected
+	if err := db.Create(ctx, &Invoice{Amount: 123456789.5}); err == nil {
+		t.Error("expected error inserting a value exceeding the precision")
+	}
+}
+
+func TestPostgresTransactions(t *testing.T) {
+	db := setupPostgres(t)
+	ctx := context.Background()
+
+	if err := db.AutoMigrate(ctx, &Customer{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	count := func() int {
+		var users []Customer
+		if err := db.Find(ctx, &users, ""); err != nil {
+			t.Fatalf("failed to find users: %v", err)
+		}
+		return len(users)
+	}
+
+	for _, level := range []sql.IsolationLevel{sql.LevelReadCommitted, sql.LevelRepeatableRead, sql.LevelSerializable} {
+		t.Run(level.String(), func(t *testing.T) {
+			before := count()
+
+			tx, err := db.Begin(ctx, &theory.TxOptions{Isolation: level})
+			if err != nil {
+				t.Fatalf("failed to begin transaction: %v", err)
+			}
+			if err := tx.Create(ctx, &Customer{Name: "Rolled Back"}); err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+			if err := tx.Rollback(ctx); err != nil {
+				t.Fatalf("failed to roll back: %v", err)
+			}
+			if got := count(); got != before {
+				t.Errorf("expected rollback to discard the insert, have %d users, want %d", got, before)
+			}
+
+			tx, err = db.Begin(ctx, &theory.TxOptions{Isolation: level})
+			if err != nil {
+				t.Fatalf("failed to begin transaction: %v", err)
+			}
+			if err := tx.Create(ctx, &Customer{Name: "Committed"}); err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+
+			nested, err := tx.Begin(ctx, nil)
+			if err != nil {
+				t.Fatalf("failed to begin nested transaction: %v", err)
+			}
+			if err := nested.Create(ctx, &Customer{Name: "Savepoint"}); err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+			if err := nested.Rollback(ctx); err != nil {
+				t.Fatalf("failed to roll back to savepoint: %v", err)
+			}
+
+			if err := tx.Commit(ctx); err != nil {
+				t.Fatalf("failed to commit: %v", err)
+			}
+			if got := count(); got != before+1 {
+				t.Errorf("expected only the outer insert to be committed, have %d users, want %d", got, before+1)
+			}
+		})
+	}
+}
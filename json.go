@@ -0,0 +1,60 @@
+package theory
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/wilburhimself/theory/model"
+)
+
+// columnValue returns the value written to a field's column. Interface
+// fields are stored as JSON, with nil stored as NULL.
+func columnValue(v reflect.Value, field *model.Field) (interface{}, error) {
+	fv := v.FieldByName(field.Name)
+	if !field.IsJSON() {
+		return fv.Interface(), nil
+	}
+
+	if fv.IsNil() {
+		return nil, nil
+	}
+	data, err := json.Marshal(fv.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("encode %s as JSON: %w", field.Name, err)
+	}
+	return string(data), nil
+}
+
+// jsonScanner scans a JSON column into an interface field. Values decode
+// as encoding/json decodes into interface{}, so numbers become float64.
+type jsonScanner struct {
+	field reflect.Value
+}
+
+// Scan implements sql.Scanner
+func (s jsonScanner) Scan(src interface{}) error {
+	var raw json.RawMessage
+	switch v := src.(type) {
+	case nil:
+		s.field.Set(reflect.Zero(s.field.Type()))
+		return nil
+	case []byte:
+		raw = v
+	case string:
+		raw = json.RawMessage(v)
+	default:
+		return fmt.Errorf("cannot decode %T as JSON", src)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return err
+	}
+	if value == nil {
+		s.field.Set(reflect.Zero(s.field.Type()))
+		return nil
+	}
+	s.field.Set(reflect.ValueOf(value))
+	return nil
+}
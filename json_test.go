@@ -0,0 +1,69 @@
+package theory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type TestSetting struct {
+	ID    int         `db:"id,pk,auto"`
+	Key   string      `db:"key"`
+	Value interface{} `db:"value"`
+}
+
+func TestJSONField(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := db.AutoMigrate(ctx, &TestSetting{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	// Numbers decode as float64, as with encoding/json
+	tests := []struct {
+		key   string
+		value interface{}
+		want  interface{}
+	}{
+		{"string", "dark", "dark"},
+		{"int", 42, float64(42)},
+		{"map", map[string]interface{}{"size": 12, "tags": []string{"a", "b"}}, map[string]interface{}{"size": float64(12), "tags": []interface{}{"a", "b"}}},
+		{"nil", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			setting := &TestSetting{Key: tt.key, Value: tt.value}
+			if err := db.Create(ctx, setting); err != nil {
+				t.Fatalf("failed to create setting: %v", err)
+			}
+
+			var got TestSetting
+			if err := db.First(ctx, &got, setting.ID); err != nil {
+				t.Fatalf("failed to find setting: %v", err)
+			}
+			if !reflect.DeepEqual(got.Value, tt.want) {
+				t.Errorf("Value = %#v, want %#v", got.Value, tt.want)
+			}
+		})
+	}
+
+	setting := &TestSetting{Key: "updated", Value: "before"}
+	if err := db.Create(ctx, setting); err != nil {
+		t.Fatalf("failed to create setting: %v", err)
+	}
+	setting.Value = []interface{}{true, "after"}
+	if err := db.Update(ctx, setting); err != nil {
+		t.Fatalf("failed to update setting: %v", err)
+	}
+
+	var raw string
+	if err := db.Primary().QueryRowContext(ctx, "SELECT value FROM test_setting WHERE id = ?", setting.ID).Scan(&raw); err != nil {
+		t.Fatalf("failed to read raw value: %v", err)
+	}
+	if raw != `[true,"after"]` {
+		t.Errorf("stored %q, want JSON text", raw)
+	}
+}
@@ -0,0 +1,129 @@
+package migration
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/wilburhimself/theory/query"
+)
+
+// SQL dialects, as returned by Migrator.Dialect
+const (
+	DialectSQLite   = "sqlite"
+	DialectPostgres = "postgres"
+	DialectMySQL    = "mysql"
+)
+
+// DialectOperation is implemented by operations whose SQL differs between
+// databases. Their SQL method returns the PostgreSQL form.
+type DialectOperation interface {
+	Operation
+	SQLFor(dialect string) string
+}
+
+// ErrUnsupportedOperation is returned when the database does not support an
+// operation
+var ErrUnsupportedOperation = errors.New("operation not supported by this database")
+
+// ErrRequiresTableRebuild is returned for changes SQLite can only make by
+// creating a new table, copying the rows over and replacing the old table
+var ErrRequiresTableRebuild = errors.New("operation requires rebuilding the table")
+
+// DialectValidator is implemented by operations that only some databases
+// support. Validate returns an error wrapping ErrUnsupportedOperation for
+// the others; an unknown ("") dialect is accepted.
+type DialectValidator interface {
+	Validate(dialect string) error
+}
+
+// validateDialect checks that the dialect supports op
+func validateDialect(op Operation, dialect string) error {
+	if v, ok := op.(DialectValidator); ok {
+		return v.Validate(dialect)
+	}
+	return nil
+}
+
+// requirePostgres reports ErrUnsupportedOperation for known dialects other
+// than PostgreSQL
+func requirePostgres(dialect string) error {
+	if dialect != "" && dialect != DialectPostgres {
+		return fmt.Errorf("%w: requires PostgreSQL, got %s", ErrUnsupportedOperation, dialect)
+	}
+	return nil
+}
+
+// rejectSQLite reports ErrUnsupportedOperation for SQLite
+func rejectSQLite(dialect string) error {
+	if dialect == DialectSQLite {
+		return fmt.Errorf("%w: not supported by SQLite", ErrUnsupportedOperation)
+	}
+	return nil
+}
+
+// DialectSQL returns the SQL of op for the given dialect
+func DialectSQL(op Operation, dialect string) string {
+	if d, ok := op.(DialectOperation); ok {
+		return d.SQLFor(dialect)
+	}
+	return op.SQL()
+}
+
+// rebind rewrites the ? placeholders of a statement for the dialect
+func rebind(statement, dialect string) string {
+	if dialect == DialectPostgres {
+		return query.Rebind(statement)
+	}
+	return statement
+}
+
+// DialectFromDriver returns the dialect of a database/sql driver name, or ""
+// for unknown drivers
+func DialectFromDriver(driver string) string {
+	switch driver {
+	case "sqlite3", "sqlite":
+		return DialectSQLite
+	case "postgres", "pgx":
+		return DialectPostgres
+	case "mysql":
+		return DialectMySQL
+	}
+	return ""
+}
+
+// SetDialect sets the dialect used for operations whose SQL differs between
+// databases, overriding the one detected from the driver
+func (m *Migrator) SetDialect(dialect string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dialect = dialect
+}
+
+// Dialect returns the dialect set with SetDialect, or otherwise the one
+// detected from the type of the database's driver
+func (m *Migrator) Dialect() string {
+	return m.dialectOf(m.conn())
+}
+
+// dialectOf returns the dialect used with db
+func (m *Migrator) dialectOf(db *sql.DB) string {
+	m.mu.RLock()
+	dialect := m.dialect
+	m.mu.RUnlock()
+	if dialect != "" {
+		return dialect
+	}
+
+	driver := strings.ToLower(fmt.Sprintf("%T", db.Driver()))
+	switch {
+	case strings.Contains(driver, "sqlite"):
+		return DialectSQLite
+	case strings.Contains(driver, "mysql"):
+		return DialectMySQL
+	case strings.Contains(driver, "pq."), strings.Contains(driver, "pgx"), strings.Contains(driver, "postgres"):
+		return DialectPostgres
+	}
+	return ""
+}
@@ -0,0 +1,182 @@
+package migration
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Diff returns the operations that turn the schema from into the schema to:
+// CreateTable and DropTable for added and removed tables, and AddColumn,
+// DropColumn, AlterColumn, CreateIndex and DropIndex for changes to tables
+// in both.
+// Tables are matched by name, columns and indexes by name within their
+// table. Foreign keys of existing tables are not compared.
+//
+// A column missing from to is dropped, even if a column was added in its
+// place; use DiffWithRenames to rename it instead. Changes to an existing
+// column's type, nullability or default become an AlterColumn; other
+// changes, such as to its uniqueness, are reported as
+// ErrUnsupportedOperation.
+func Diff(from, to []CreateTable) ([]Operation, error) {
+	return DiffWithRenames(from, to, nil)
+}
+
+// DiffWithRenames is like Diff, but renames the columns given as hints in
+// renames, which maps "table.old_column" to the new column name. Renames are
+// returned as ModifyColumn operations.
+func DiffWithRenames(from, to []CreateTable, renames map[string]string) ([]Operation, error) {
+	fromTables, err := tablesByName(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from schema: %w", err)
+	}
+	toTables, err := tablesByName(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to schema: %w", err)
+	}
+
+	// Group the hints by table, checking they name existing columns
+	tableRenames := make(map[string]map[string]string)
+	for key, newName := range renames {
+		i := strings.Index(key, ".")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid rename %q: want table.column", key)
+		}
+		table, oldName := key[:i], key[i+1:]
+		if findColumn(fromTables[table], oldName) == nil || findColumn(toTables[table], newName) == nil {
+			return nil, fmt.Errorf("invalid rename of %s to %s: column not found", key, newName)
+		}
+		if tableRenames[table] == nil {
+			tableRenames[table] = make(map[string]string)
+		}
+		tableRenames[table][oldName] = newName
+	}
+
+	var ops []Operation
+	for i := range to {
+		if _, ok := fromTables[to[i].Name]; !ok {
+			table := to[i]
+			ops = append(ops, &table)
+		}
+	}
+	for i := range to {
+		if old, ok := fromTables[to[i].Name]; ok {
+			tableOps, err := diffTable(old, &to[i], tableRenames[to[i].Name])
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, tableOps...)
+		}
+	}
+	for i := range from {
+		if _, ok := toTables[from[i].Name]; !ok {
+			ops = append(ops, &DropTable{Name: from[i].Name})
+		}
+	}
+	return ops, nil
+}
+
+// tablesByName indexes tables by name, rejecting duplicates
+func tablesByName(tables []CreateTable) (map[string]*CreateTable, error) {
+	byName := make(map[string]*CreateTable, len(tables))
+	for i := range tables {
+		if _, ok := byName[tables[i].Name]; ok {
+			return nil, fmt.Errorf("duplicate table %s", tables[i].Name)
+		}
+		byName[tables[i].Name] = &tables[i]
+	}
+	return byName, nil
+}
+
+// findColumn returns the named column of table, or nil
+func findColumn(table *CreateTable, name string) *Column {
+	if table == nil {
+		return nil
+	}
+	for i := range table.Columns {
+		if table.Columns[i].Name == name {
+			return &table.Columns[i]
+		}
+	}
+	return nil
+}
+
+// diffTable returns the operations that turn one version of a table into
+// another. Indexes are dropped before columns they may cover, and created
+// once the columns they cover exist.
+func diffTable(from, to *CreateTable, renames map[string]string) ([]Operation, error) {
+	var renameOps, alterColumns, dropIndexes, dropColumns, addColumns, createIndexes []Operation
+
+	renamed := make(map[string]string) // new name to old name
+	for _, col := range from.Columns {
+		newName, isRenamed := renames[col.Name]
+		if !isRenamed {
+			newName = col.Name
+		}
+		target := findColumn(to, newName)
+		if target == nil {
+			dropColumns = append(dropColumns, &DropColumn{Table: from.Name, Column: col.Name})
+			continue
+		}
+
+		if isRenamed {
+			renamed[newName] = col.Name
+			renameOps = append(renameOps, &ModifyColumn{Table: from.Name, OldColumn: col.Name, NewColumn: *target})
+		}
+
+		// Definitions are compared apart from the name
+		old := col
+		old.Name = target.Name
+		if reflect.DeepEqual(old, *target) {
+			continue
+		}
+		old.Type, old.MaxLength, old.Precision, old.Scale = target.Type, target.MaxLength, target.Precision, target.Scale
+		old.IsNull, old.Default = target.IsNull, target.Default
+		if !reflect.DeepEqual(old, *target) {
+			return nil, fmt.Errorf("%w: changing the definition of column %s.%s", ErrUnsupportedOperation, from.Name, col.Name)
+		}
+		alterColumns = append(alterColumns, &AlterColumn{Table: to.Name, Column: *target})
+	}
+	for _, col := range to.Columns {
+		if _, ok := renamed[col.Name]; !ok && findColumn(from, col.Name) == nil {
+			addColumns = append(addColumns, &AddColumn{Table: to.Name, Column: col})
+		}
+	}
+
+	// Indexes of the old table refer to columns by their old names
+	oldIndexes := make(map[string]Index, len(from.Indexes))
+	for _, idx := range from.Indexes {
+		columns := make([]string, len(idx.Columns))
+		for i, column := range idx.Columns {
+			if newName, ok := renames[column]; ok {
+				column = newName
+			}
+			columns[i] = column
+		}
+		idx.Columns = columns
+		oldIndexes[idx.Name] = idx
+	}
+	newIndexes := make(map[string]bool, len(to.Indexes))
+	for _, idx := range to.Indexes {
+		newIndexes[idx.Name] = true
+		old, ok := oldIndexes[idx.Name]
+		if ok && reflect.DeepEqual(old, idx) {
+			continue
+		}
+		if ok {
+			dropIndexes = append(dropIndexes, &DropIndex{Table: from.Name, Name: idx.Name})
+		}
+		createIndexes = append(createIndexes, &CreateIndex{Table: to.Name, Index: idx})
+	}
+	for _, idx := range from.Indexes {
+		if !newIndexes[idx.Name] {
+			dropIndexes = append(dropIndexes, &DropIndex{Table: from.Name, Name: idx.Name})
+		}
+	}
+
+	var ops []Operation
+	for _, group := range [][]Operation{renameOps, dropIndexes, dropColumns, alterColumns, addColumns, createIndexes} {
+		ops = append(ops, group...)
+	}
+	return ops, nil
+}
@@ -0,0 +1,194 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func usersTable() CreateTable {
+	return CreateTable{
+		Name: "users",
+		Columns: []Column{
+			{Name: "id", Type: "INTEGER", IsPK: true, IsAuto: true},
+			{Name: "name", Type: "TEXT"},
+		},
+		Indexes: []Index{{Name: "idx_users_name", Columns: []string{"name"}}},
+	}
+}
+
+func TestDiff(t *testing.T) {
+	posts := CreateTable{
+		Name:    "posts",
+		Columns: []Column{{Name: "id", Type: "INTEGER", IsPK: true}},
+	}
+
+	withEmail := usersTable()
+	withEmail.Columns = append(withEmail.Columns, Column{Name: "email", Type: "TEXT", IsNull: true})
+
+	withoutIndex := usersTable()
+	withoutIndex.Indexes = nil
+
+	uniqueIndex := usersTable()
+	uniqueIndex.Indexes[0].IsUnique = true
+
+	withoutName := usersTable()
+	withoutName.Columns = withoutName.Columns[:1]
+	withoutName.Indexes = nil
+
+	tests := []struct {
+		name     string
+		from, to []CreateTable
+		want     []Operation
+	}{
+		{
+			name: "unchanged",
+			from: []CreateTable{usersTable(), posts},
+			to:   []CreateTable{usersTable(), posts},
+		},
+		{
+			name: "add column",
+			from: []CreateTable{usersTable()},
+			to:   []CreateTable{withEmail},
+			want: []Operation{&AddColumn{Table: "users", Column: Column{Name: "email", Type: "TEXT", IsNull: true}}},
+		},
+		{
+			name: "drop table",
+			from: []CreateTable{usersTable(), posts},
+			to:   []CreateTable{usersTable()},
+			want: []Operation{&DropTable{Name: "posts"}},
+		},
+		{
+			name: "create table",
+			from: []CreateTable{usersTable()},
+			to:   []CreateTable{usersTable(), posts},
+			want: []Operation{&posts},
+		},
+		{
+			name: "drop index",
+			from: []CreateTable{usersTable()},
+			to:   []CreateTable{withoutIndex},
+			want: []Operation{&DropIndex{Table: "users", Name: "idx_users_name"}},
+		},
+		{
+			name: "create index",
+			from: []CreateTable{withoutIndex},
+			to:   []CreateTable{usersTable()},
+			want: []Operation{&CreateIndex{Table: "users", Index: usersTable().Indexes[0]}},
+		},
+		{
+			name: "change index",
+			from: []CreateTable{usersTable()},
+			to:   []CreateTable{uniqueIndex},
+			want: []Operation{
+				&DropIndex{Table: "users", Name: "idx_users_name"},
+				&CreateIndex{Table: "users", Index: uniqueIndex.Indexes[0]},
+			},
+		},
+		{
+			name: "drop column with its index",
+			from: []CreateTable{usersTable()},
+			to:   []CreateTable{withoutName},
+			want: []Operation{
+				&DropIndex{Table: "users", Name: "idx_users_name"},
+				&DropColumn{Table: "users", Column: "name"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Diff(tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffWithRenames(t *testing.T) {
+	renamed := usersTable()
+	renamed.Columns[1].Name = "full_name"
+	renamed.Indexes[0].Columns = []string{"full_name"}
+
+	// Without a hint the column is dropped and a new one added
+	ops, err := Diff([]CreateTable{usersTable()}, []CreateTable{renamed})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	want := []Operation{
+		&DropIndex{Table: "users", Name: "idx_users_name"},
+		&DropColumn{Table: "users", Column: "name"},
+		&AddColumn{Table: "users", Column: renamed.Columns[1]},
+		&CreateIndex{Table: "users", Index: renamed.Indexes[0]},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("Diff() = %#v, want %#v", ops, want)
+	}
+
+	ops, err = DiffWithRenames([]CreateTable{usersTable()}, []CreateTable{renamed}, map[string]string{"users.name": "full_name"})
+	if err != nil {
+		t.Fatalf("DiffWithRenames() error = %v", err)
+	}
+	want = []Operation{&ModifyColumn{Table: "users", OldColumn: "name", NewColumn: renamed.Columns[1]}}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("DiffWithRenames() = %#v, want %#v", ops, want)
+	}
+
+	for _, hints := range []map[string]string{
+		{"name": "full_name"},
+		{"users.missing": "full_name"},
+		{"users.name": "missing"},
+	} {
+		if _, err := DiffWithRenames([]CreateTable{usersTable()}, []CreateTable{renamed}, hints); err == nil {
+			t.Errorf("expected error for rename hints %v", hints)
+		}
+	}
+}
+
+func TestDiffAlterColumn(t *testing.T) {
+	changed := usersTable()
+	changed.Columns[1].Type = "VARCHAR(100)"
+	changed.Columns[1].IsNull = true
+	changed.Columns[1].Default = "'anonymous'"
+
+	ops, err := Diff([]CreateTable{usersTable()}, []CreateTable{changed})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	want := []Operation{&AlterColumn{Table: "users", Column: changed.Columns[1]}}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("Diff() = %#v, want %#v", ops, want)
+	}
+
+	renamed := changed
+	renamed.Columns = append([]Column(nil), changed.Columns...)
+	renamed.Columns[1].Name = "full_name"
+	renamed.Indexes = []Index{{Name: "idx_users_name", Columns: []string{"full_name"}}}
+	ops, err = DiffWithRenames([]CreateTable{usersTable()}, []CreateTable{renamed}, map[string]string{"users.name": "full_name"})
+	if err != nil {
+		t.Fatalf("DiffWithRenames() error = %v", err)
+	}
+	want = []Operation{
+		&ModifyColumn{Table: "users", OldColumn: "name", NewColumn: renamed.Columns[1]},
+		&AlterColumn{Table: "users", Column: renamed.Columns[1]},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("DiffWithRenames() = %#v, want %#v", ops, want)
+	}
+}
+
+func TestDiffErrors(t *testing.T) {
+	changed := usersTable()
+	changed.Columns[1].IsUnique = true
+	if _, err := Diff([]CreateTable{usersTable()}, []CreateTable{changed}); !errors.Is(err, ErrUnsupportedOperation) {
+		t.Errorf("expected ErrUnsupportedOperation for a column made unique, got %v", err)
+	}
+
+	if _, err := Diff([]CreateTable{usersTable(), usersTable()}, nil); err == nil {
+		t.Error("expected error for duplicate tables")
+	}
+}
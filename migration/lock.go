@@ -0,0 +1,78 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// querier is the part of *sql.DB and *sql.Conn a migration run uses
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// lockName returns the name of the advisory lock guarding the migrations
+// table. MySQL limits lock names to 64 characters.
+func (m *Migrator) lockName() string {
+	name := "theory_" + m.table
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// lock takes the advisory lock Up and Down hold while they run, so that
+// migrators started at the same time, such as by several instances of an
+// application, apply migrations one at a time. PostgreSQL uses
+// pg_advisory_lock and MySQL GET_LOCK; SQLite serializes writes by itself,
+// so no lock is taken there or for unknown dialects.
+//
+// The lock belongs to a session, so it is taken on a dedicated connection,
+// which is returned for the run to use along with a function releasing the
+// lock and the connection. Without a lock, db itself is returned.
+func (m *Migrator) lock(ctx context.Context, db *sql.DB, dialect string) (querier, func() error, error) {
+	var acquire, release string
+	switch dialect {
+	case DialectPostgres:
+		acquire = "SELECT pg_advisory_lock(hashtext($1))"
+		release = "SELECT pg_advisory_unlock(hashtext($1))"
+	case DialectMySQL:
+		acquire = "SELECT GET_LOCK(?, -1)"
+		release = "SELECT RELEASE_LOCK(?)"
+	default:
+		return db, func() error { return nil }, nil
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+
+	name := m.lockName()
+	var acquired sql.NullInt64
+	if dialect == DialectMySQL {
+		// GET_LOCK returns 1 once the lock is held, and 0 or NULL otherwise
+		err = conn.QueryRowContext(ctx, acquire, name).Scan(&acquired)
+		if err == nil && acquired.Int64 != 1 {
+			err = fmt.Errorf("GET_LOCK returned %v", acquired)
+		}
+	} else {
+		_, err = conn.ExecContext(ctx, acquire, name)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+
+	return conn, func() error {
+		defer conn.Close()
+		// The lock is released even if ctx has been canceled meanwhile
+		if _, err := conn.ExecContext(context.Background(), release, name); err != nil {
+			return fmt.Errorf("failed to release migration lock: %w", err)
+		}
+		return nil
+	}, nil
+}
@@ -16,6 +16,17 @@ type Migration struct {
 	Name      string
 	Up        []Operation
 	Down      []Operation
+
+	// DependsOn lists the IDs of migrations this one builds on. It documents
+	// the dependency graph drawn by Migrator.DotGraph; migrations still run
+	// in timestamp order.
+	DependsOn []string
+
+	// SkipIf is an optional SQL query run before applying the migration. If
+	// it returns any rows, the migration is skipped without being recorded,
+	// so it stays pending and the query is checked again by the next run.
+	// This suits data migrations whose target data may already exist.
+	SkipIf string
 }
 
 // Operation represents a migration operation
@@ -30,6 +41,12 @@ type CreateTable struct {
 	Columns    []Column
 	ForeignKeys []ForeignKey
 	Indexes    []Index
+
+	// Engine and Charset set the storage engine and default character set
+	// of the table on MySQL, as in InnoDB and utf8mb4. Other dialects
+	// ignore them.
+	Engine  string
+	Charset string
 }
 
 // Column represents a table column
@@ -39,7 +56,24 @@ type Column struct {
 	IsPK      bool
 	IsAuto    bool
 	IsNull    bool
+	IsUnique  bool
 	MaxLength int
+
+	// Default is the SQL expression of the column's default value, such as
+	// 0, 'draft' or CURRENT_TIMESTAMP. Empty means no default.
+	Default string
+
+	// Precision and Scale parameterize DECIMAL and NUMERIC columns, as in
+	// DECIMAL(10,2). They are ignored for other types or a zero Precision.
+	Precision int
+	Scale     int
+
+	// IsGenerated makes the column computed by the database from
+	// GeneratedExpression. Generated columns are virtual unless
+	// GeneratedStored is set; PostgreSQL only supports stored ones.
+	IsGenerated         bool
+	GeneratedExpression string
+	GeneratedStored     bool
 }
 
 // ForeignKey represents a foreign key constraint
@@ -56,6 +90,11 @@ type Index struct {
 	Name      string
 	Columns   []string
 	IsUnique  bool
+
+	// IsPartial limits the index to the rows matching WhereClause. MySQL
+	// does not support partial indexes.
+	IsPartial   bool
+	WhereClause string
 }
 
 // DropTable operation drops a table
@@ -82,6 +121,14 @@ type ModifyColumn struct {
 	NewColumn Column
 }
 
+// AlterColumn operation changes the type, nullability and default value of
+// a column to those of Column, which names the column to change. SQLite
+// cannot alter columns; see ErrRequiresTableRebuild.
+type AlterColumn struct {
+	Table  string
+	Column Column
+}
+
 // CreateIndex operation creates an index
 type CreateIndex struct {
 	Table  string
@@ -106,21 +153,106 @@ type DropForeignKey struct {
 	Name  string
 }
 
+// AddUniqueConstraint operation adds a named unique constraint. Unlike a
+// unique index it is part of the table definition, which some databases
+// treat differently, e.g. for deferred checks or foreign key targets.
+type AddUniqueConstraint struct {
+	Table   string
+	Name    string
+	Columns []string
+}
+
+// DropUniqueConstraint operation drops a unique constraint
+type DropUniqueConstraint struct {
+	Table string
+	Name  string
+}
+
+// TruncateTable operation removes all rows from a table. RestartIdentity
+// resets the table's sequences and Cascade also truncates tables referencing
+// it; both apply to PostgreSQL only.
+type TruncateTable struct {
+	Name            string
+	RestartIdentity bool
+	Cascade         bool
+}
+
+// CreateSequence operation creates a PostgreSQL sequence. Zero Start and
+// Increment default to 1; nil bounds use the database's defaults.
+type CreateSequence struct {
+	Name      string
+	Start     int64
+	Increment int64
+	MinValue  *int64
+	MaxValue  *int64
+}
+
+// DropSequence operation drops a PostgreSQL sequence
+type DropSequence struct {
+	Name     string
+	IfExists bool
+}
+
+// CustomSQL operation runs a SQL statement as written, for changes the other
+// operations do not cover
+type CustomSQL struct {
+	Query  string
+	Params []interface{}
+}
+
+// sqlType returns the column's type, with the precision and scale of a
+// DECIMAL or NUMERIC column
+func (c Column) sqlType() string {
+	switch strings.ToUpper(c.Type) {
+	case "DECIMAL", "NUMERIC":
+		if c.Precision > 0 {
+			return fmt.Sprintf("%s(%d,%d)", c.Type, c.Precision, c.Scale)
+		}
+	}
+	return c.Type
+}
+
 // SQL generates SQL for CreateTable operation
 func (op *CreateTable) SQL() string {
+	return op.SQLFor("")
+}
+
+// SQLFor generates SQL for CreateTable operation. Generated columns are
+// always stored on PostgreSQL, which does not support virtual ones, and
+// auto-incrementing keys are identity columns there and AUTO_INCREMENT
+// columns on MySQL.
+func (op *CreateTable) SQLFor(dialect string) string {
 	var cols []string
 	for _, col := range op.Columns {
-		def := fmt.Sprintf("%s %s", col.Name, col.Type)
+		def := fmt.Sprintf("%s %s", col.Name, col.sqlType())
+		if col.IsGenerated {
+			storage := "VIRTUAL"
+			if col.GeneratedStored || dialect == DialectPostgres {
+				storage = "STORED"
+			}
+			def += fmt.Sprintf(" GENERATED ALWAYS AS (%s) %s", col.GeneratedExpression, storage)
+		}
 		if col.IsPK {
-			if col.IsAuto {
-				def += " PRIMARY KEY AUTOINCREMENT"
-			} else {
+			switch {
+			case !col.IsAuto:
 				def += " PRIMARY KEY"
+			case dialect == DialectPostgres:
+				def += " GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY"
+			case dialect == DialectMySQL:
+				def += " PRIMARY KEY AUTO_INCREMENT"
+			default:
+				def += " PRIMARY KEY AUTOINCREMENT"
 			}
 		}
-		if !col.IsPK && !col.IsNull {
+		if !col.IsPK && !col.IsNull && !col.IsGenerated {
 			def += " NOT NULL"
 		}
+		if !col.IsPK && col.IsUnique {
+			def += " UNIQUE"
+		}
+		if col.Default != "" {
+			def += " DEFAULT " + col.Default
+		}
 		cols = append(cols, def)
 	}
 
@@ -141,16 +273,19 @@ func (op *CreateTable) SQL() string {
 	}
 
 	sql := fmt.Sprintf("CREATE TABLE %s (\n\t%s\n)", op.Name, strings.Join(cols, ",\n\t"))
+	if dialect == DialectMySQL {
+		if op.Engine != "" {
+			sql += " ENGINE=" + op.Engine
+		}
+		if op.Charset != "" {
+			sql += " DEFAULT CHARSET=" + op.Charset
+		}
+	}
 
 	// Create indexes
 	var indexes []string
 	for _, idx := range op.Indexes {
-		idxSQL := fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)",
-			map[bool]string{true: "UNIQUE ", false: ""}[idx.IsUnique],
-			idx.Name,
-			op.Name,
-			strings.Join(idx.Columns, ", "))
-		indexes = append(indexes, idxSQL)
+		indexes = append(indexes, (&CreateIndex{Table: op.Name, Index: idx}).SQL())
 	}
 
 	if len(indexes) > 0 {
@@ -164,6 +299,11 @@ func (c *CreateTable) Args() []interface{} {
 	return nil
 }
 
+// Validate reports ErrUnsupportedOperation for partial indexes on MySQL
+func (c *CreateTable) Validate(dialect string) error {
+	return validateIndexes(dialect, c.Indexes...)
+}
+
 // SQL generates SQL for DropTable operation
 func (d *DropTable) SQL() string {
 	return fmt.Sprintf("DROP TABLE %s", d.Name)
@@ -175,11 +315,30 @@ func (d *DropTable) Args() []interface{} {
 
 // SQL generates SQL for AddColumn operation
 func (a *AddColumn) SQL() string {
-	def := fmt.Sprintf("%s %s", a.Column.Name, a.Column.Type)
+	def := fmt.Sprintf("%s %s", a.Column.Name, a.Column.sqlType())
 	if !a.Column.IsNull {
 		def += " NOT NULL"
 	}
-	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", a.Table, def)
+	if a.Column.Default != "" {
+		def += " DEFAULT " + a.Column.Default
+	}
+	sql := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", a.Table, def)
+
+	// Unique columns cannot be added inline by every database, so the
+	// constraint is enforced with a separate unique index instead
+	if a.Column.IsUnique {
+		idx := &CreateIndex{
+			Table: a.Table,
+			Index: Index{
+				Name:     fmt.Sprintf("idx_%s_%s_unique", a.Table, a.Column.Name),
+				Columns:  []string{a.Column.Name},
+				IsUnique: true,
+			},
+		}
+		sql += ";\n" + idx.SQL()
+	}
+
+	return sql
 }
 
 func (a *AddColumn) Args() []interface{} {
@@ -204,13 +363,82 @@ func (m *ModifyColumn) Args() []interface{} {
 	return nil
 }
 
+// SQL generates PostgreSQL SQL for AlterColumn operation
+func (a *AlterColumn) SQL() string {
+	return a.SQLFor(DialectPostgres)
+}
+
+// SQLFor generates SQL for AlterColumn operation. PostgreSQL changes each
+// property with its own ALTER COLUMN clause; MySQL redefines the column.
+func (a *AlterColumn) SQLFor(dialect string) string {
+	col := a.Column
+	if dialect == DialectMySQL {
+		def := fmt.Sprintf("%s %s", col.Name, col.sqlType())
+		if !col.IsNull {
+			def += " NOT NULL"
+		}
+		if col.Default != "" {
+			def += " DEFAULT " + col.Default
+		}
+		return fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s", a.Table, def)
+	}
+
+	clauses := []string{fmt.Sprintf("ALTER COLUMN %s TYPE %s", col.Name, col.sqlType())}
+	if col.IsNull {
+		clauses = append(clauses, fmt.Sprintf("ALTER COLUMN %s DROP NOT NULL", col.Name))
+	} else {
+		clauses = append(clauses, fmt.Sprintf("ALTER COLUMN %s SET NOT NULL", col.Name))
+	}
+	if col.Default != "" {
+		clauses = append(clauses, fmt.Sprintf("ALTER COLUMN %s SET DEFAULT %s", col.Name, col.Default))
+	} else {
+		clauses = append(clauses, fmt.Sprintf("ALTER COLUMN %s DROP DEFAULT", col.Name))
+	}
+	return fmt.Sprintf("ALTER TABLE %s %s", a.Table, strings.Join(clauses, ", "))
+}
+
+func (a *AlterColumn) Args() []interface{} {
+	return nil
+}
+
+// Validate reports ErrRequiresTableRebuild for SQLite, with the steps to
+// change the column by rebuilding the table
+func (a *AlterColumn) Validate(dialect string) error {
+	if dialect != DialectSQLite {
+		return nil
+	}
+	return fmt.Errorf("%w: to change %s.%s, create %s_new with the new column definition, "+
+		"copy the rows with INSERT INTO %s_new SELECT ... FROM %s, "+
+		"DROP TABLE %s, then ALTER TABLE %s_new RENAME TO %s and recreate its indexes",
+		ErrRequiresTableRebuild, a.Table, a.Column.Name, a.Table, a.Table, a.Table, a.Table, a.Table, a.Table)
+}
+
 // SQL generates SQL for CreateIndex operation
 func (c *CreateIndex) SQL() string {
-	return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)",
+	sql := fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)",
 		map[bool]string{true: "UNIQUE ", false: ""}[c.Index.IsUnique],
 		c.Index.Name,
 		c.Table,
 		strings.Join(c.Index.Columns, ", "))
+	if c.Index.IsPartial && c.Index.WhereClause != "" {
+		sql += " WHERE " + c.Index.WhereClause
+	}
+	return sql
+}
+
+// Validate reports ErrUnsupportedOperation for partial indexes on MySQL
+func (c *CreateIndex) Validate(dialect string) error {
+	return validateIndexes(dialect, c.Index)
+}
+
+// validateIndexes checks that the dialect supports the indexes
+func validateIndexes(dialect string, indexes ...Index) error {
+	for _, idx := range indexes {
+		if idx.IsPartial && dialect == DialectMySQL {
+			return fmt.Errorf("%w: partial index %s on MySQL", ErrUnsupportedOperation, idx.Name)
+		}
+	}
+	return nil
 }
 
 func (c *CreateIndex) Args() []interface{} {
@@ -228,10 +456,9 @@ func (d *DropIndex) Args() []interface{} {
 
 // SQL generates SQL for AddForeignKey operation
 func (a *AddForeignKey) SQL() string {
-	sql := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s_%s_fk FOREIGN KEY (%s) REFERENCES %s (%s)",
-		a.Table,
+	sql := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
 		a.Table,
-		strings.Join(a.ForeignKey.Columns, "_"),
+		a.ConstraintName(),
 		strings.Join(a.ForeignKey.Columns, ", "),
 		a.ForeignKey.RefTable,
 		strings.Join(a.ForeignKey.RefColumns, ", "))
@@ -250,6 +477,24 @@ func (a *AddForeignKey) Args() []interface{} {
 	return nil
 }
 
+// ConstraintName returns the name of the constraint added, as in
+// posts_user_id_fk
+func (a *AddForeignKey) ConstraintName() string {
+	return fmt.Sprintf("%s_%s_fk", a.Table, strings.Join(a.ForeignKey.Columns, "_"))
+}
+
+// Drop returns the operation dropping the constraint a adds, for the Down
+// operations of a migration
+func (a *AddForeignKey) Drop() *DropForeignKey {
+	return &DropForeignKey{Table: a.Table, Name: a.ConstraintName()}
+}
+
+// Validate reports ErrUnsupportedOperation for SQLite, which cannot add
+// constraints to existing tables
+func (a *AddForeignKey) Validate(dialect string) error {
+	return rejectSQLite(dialect)
+}
+
 // SQL generates SQL for DropForeignKey operation
 func (d *DropForeignKey) SQL() string {
 	return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", d.Table, d.Name)
@@ -259,6 +504,140 @@ func (d *DropForeignKey) Args() []interface{} {
 	return nil
 }
 
+// Validate reports ErrUnsupportedOperation for SQLite, which cannot drop
+// constraints from existing tables
+func (d *DropForeignKey) Validate(dialect string) error {
+	return rejectSQLite(dialect)
+}
+
+// foreignKeyActions lists the accepted ON DELETE and ON UPDATE actions
+var foreignKeyActions = map[string]bool{
+	"CASCADE":     true,
+	"SET NULL":    true,
+	"SET DEFAULT": true,
+	"RESTRICT":    true,
+	"NO ACTION":   true,
+}
+
+// validateForeignKey checks the referential actions of a foreign key.
+// Actions are matched case-insensitively; empty ones use the default.
+func validateForeignKey(fk ForeignKey) error {
+	for _, action := range []struct{ clause, value string }{
+		{"ON DELETE", fk.OnDelete},
+		{"ON UPDATE", fk.OnUpdate},
+	} {
+		normalized := strings.ToUpper(strings.Join(strings.Fields(action.value), " "))
+		if normalized != "" && !foreignKeyActions[normalized] {
+			return fmt.Errorf("invalid %s action %s", action.clause, action.value)
+		}
+	}
+	return nil
+}
+
+// SQL generates SQL for AddUniqueConstraint operation
+func (a *AddUniqueConstraint) SQL() string {
+	return fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s UNIQUE (%s)", a.Table, a.Name, strings.Join(a.Columns, ", "))
+}
+
+func (a *AddUniqueConstraint) Args() []interface{} {
+	return nil
+}
+
+// SQL generates SQL for DropUniqueConstraint operation
+func (d *DropUniqueConstraint) SQL() string {
+	return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", d.Table, d.Name)
+}
+
+func (d *DropUniqueConstraint) Args() []interface{} {
+	return nil
+}
+
+// SQL generates PostgreSQL SQL for TruncateTable operation
+func (t *TruncateTable) SQL() string {
+	return t.SQLFor(DialectPostgres)
+}
+
+// SQLFor generates SQL for TruncateTable operation. SQLite has no TRUNCATE,
+// so all rows are deleted instead.
+func (t *TruncateTable) SQLFor(dialect string) string {
+	switch dialect {
+	case DialectSQLite:
+		return fmt.Sprintf("DELETE FROM %s", t.Name)
+	case DialectMySQL:
+		return fmt.Sprintf("TRUNCATE TABLE %s", t.Name)
+	}
+
+	sql := fmt.Sprintf("TRUNCATE TABLE %s", t.Name)
+	if t.RestartIdentity {
+		sql += " RESTART IDENTITY"
+	}
+	if t.Cascade {
+		sql += " CASCADE"
+	}
+	return sql
+}
+
+func (t *TruncateTable) Args() []interface{} {
+	return nil
+}
+
+// SQL generates SQL for CreateSequence operation
+func (c *CreateSequence) SQL() string {
+	start, increment := c.Start, c.Increment
+	if start == 0 {
+		start = 1
+	}
+	if increment == 0 {
+		increment = 1
+	}
+
+	sql := fmt.Sprintf("CREATE SEQUENCE %s START WITH %d INCREMENT BY %d", c.Name, start, increment)
+	if c.MinValue != nil {
+		sql += fmt.Sprintf(" MINVALUE %d", *c.MinValue)
+	}
+	if c.MaxValue != nil {
+		sql += fmt.Sprintf(" MAXVALUE %d", *c.MaxValue)
+	}
+	return sql
+}
+
+func (c *CreateSequence) Args() []interface{} {
+	return nil
+}
+
+// Validate reports ErrUnsupportedOperation for databases other than
+// PostgreSQL
+func (c *CreateSequence) Validate(dialect string) error {
+	return requirePostgres(dialect)
+}
+
+// SQL generates SQL for DropSequence operation
+func (d *DropSequence) SQL() string {
+	if d.IfExists {
+		return fmt.Sprintf("DROP SEQUENCE IF EXISTS %s", d.Name)
+	}
+	return fmt.Sprintf("DROP SEQUENCE %s", d.Name)
+}
+
+func (d *DropSequence) Args() []interface{} {
+	return nil
+}
+
+// Validate reports ErrUnsupportedOperation for databases other than
+// PostgreSQL
+func (d *DropSequence) Validate(dialect string) error {
+	return requirePostgres(dialect)
+}
+
+// SQL returns the statement of the CustomSQL operation
+func (c *CustomSQL) SQL() string {
+	return c.Query
+}
+
+func (c *CustomSQL) Args() []interface{} {
+	return c.Params
+}
+
 // NewMigration creates a new migration with the given name
 func NewMigration(name string) *Migration {
 	return &Migration{
@@ -270,28 +649,14 @@ func NewMigration(name string) *Migration {
 	}
 }
 
+// String describes the migration by its ID, name and operation counts
+func (m *Migration) String() string {
+	return fmt.Sprintf("[%s] %s (%d up operations, %d down operations)", m.ID, m.Name, len(m.Up), len(m.Down))
+}
+
 // SqlType converts a Go type to SQL type
 func SqlType(t reflect.Type) string {
-	switch t.Kind() {
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return "INTEGER"
-	case reflect.Float32, reflect.Float64:
-		return "REAL"
-	case reflect.String:
-		return "TEXT"
-	case reflect.Bool:
-		return "INTEGER"
-	case reflect.Slice:
-		if t.Elem().Kind() == reflect.Uint8 {
-			return "BLOB"
-		}
-	case reflect.Struct:
-		if t == reflect.TypeOf(time.Time{}) {
-			return "INTEGER" // Store as Unix timestamp
-		}
-	}
-	return "TEXT"
+	return model.SqlType(t)
 }
 
 // CreateTableFromModel creates a CreateTable operation from a model
@@ -300,23 +665,65 @@ func CreateTableFromModel(m interface{}) (*CreateTable, error) {
 	if err != nil {
 		return nil, err
 	}
+	return CreateTableFromMetadata(metadata), nil
+}
 
+// CreateTableFromMetadata creates a CreateTable operation from a model's
+// metadata, e.g. one extracted with a specific naming strategy
+func CreateTableFromMetadata(metadata *model.Metadata) *CreateTable {
 	var columns []Column
 	for _, field := range metadata.Fields {
-		col := Column{
-			Name:   field.DBName,
-			Type:   SqlType(field.Type),
-			IsPK:   field.IsPK,
-			IsAuto: field.IsAuto,
-			IsNull: field.IsNull,
-		}
-		columns = append(columns, col)
+		columns = append(columns, Column{
+			Name:     field.DBName,
+			Type:     field.ColumnType(),
+			IsPK:     field.IsPK,
+			IsAuto:   field.IsAuto && !field.UsesPKStrategy(),
+			IsNull:   field.Nullable(),
+			IsUnique: field.IsUnique,
+
+			Precision: field.Precision,
+			Scale:     field.Scale,
+
+			IsGenerated:         field.IsGenerated(),
+			GeneratedExpression: field.Generated,
+			GeneratedStored:     field.IsStored,
+		})
 	}
 
 	return &CreateTable{
 		Name:    metadata.TableName,
 		Columns: columns,
-	}, nil
+	}
+}
+
+// IndexesFromModel creates CreateIndex operations for the indexes declared
+// on a model via theory_index struct tags
+func IndexesFromModel(m interface{}) ([]*CreateIndex, error) {
+	metadata, err := model.ExtractMetadata(m)
+	if err != nil {
+		return nil, err
+	}
+	return IndexesFromMetadata(metadata), nil
+}
+
+// IndexesFromMetadata creates CreateIndex operations for the indexes in a
+// model's metadata
+func IndexesFromMetadata(metadata *model.Metadata) []*CreateIndex {
+	var ops []*CreateIndex
+	for _, idx := range metadata.Indexes {
+		ops = append(ops, &CreateIndex{
+			Table: metadata.TableName,
+			Index: Index{
+				Name:        idx.Name,
+				Columns:     idx.Columns,
+				IsUnique:    idx.IsUnique,
+				IsPartial:   idx.Where != "",
+				WhereClause: idx.Where,
+			},
+		})
+	}
+
+	return ops
 }
 
 // generateID generates a unique ID for a migration
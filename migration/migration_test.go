@@ -1,6 +1,8 @@
 package migration
 
 import (
+	"context"
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
@@ -50,6 +52,43 @@ func TestOperationSQL(t *testing.T) {
 			},
 			wantSQL: "CREATE TABLE users (\n\tid INTEGER PRIMARY KEY AUTOINCREMENT,\n\tname TEXT NOT NULL\n)",
 		},
+		{
+			name: "create table with decimal",
+			operation: &CreateTable{
+				Name: "invoices",
+				Columns: []Column{
+					{Name: "amount", Type: "DECIMAL", Precision: 10, Scale: 2},
+					{Name: "rate", Type: "NUMERIC", Precision: 5},
+					{Name: "total", Type: "REAL", Precision: 10, Scale: 2},
+				},
+			},
+			wantSQL: "CREATE TABLE invoices (\n\tamount DECIMAL(10,2) NOT NULL,\n\trate NUMERIC(5,0) NOT NULL,\n\ttotal REAL NOT NULL\n)",
+		},
+		{
+			name: "add decimal column",
+			operation: &AddColumn{
+				Table:  "invoices",
+				Column: Column{Name: "tax", Type: "decimal", Precision: 8, Scale: 3, IsNull: true},
+			},
+			wantSQL: "ALTER TABLE invoices ADD COLUMN tax decimal(8,3)",
+		},
+		{
+			name: "create partial index",
+			operation: &CreateIndex{
+				Table: "users",
+				Index: Index{Name: "idx_users_email_active", Columns: []string{"email"}, IsUnique: true, IsPartial: true, WhereClause: "deleted_at IS NULL"},
+			},
+			wantSQL: "CREATE UNIQUE INDEX idx_users_email_active ON users (email) WHERE deleted_at IS NULL",
+		},
+		{
+			name: "create table with partial index",
+			operation: &CreateTable{
+				Name:    "users",
+				Columns: []Column{{Name: "email", Type: "TEXT", IsNull: true}},
+				Indexes: []Index{{Name: "idx_users_email", Columns: []string{"email"}, IsPartial: true, WhereClause: "email IS NOT NULL"}},
+			},
+			wantSQL: "CREATE TABLE users (\n\temail TEXT\n);\nCREATE INDEX idx_users_email ON users (email) WHERE email IS NOT NULL",
+		},
 		{
 			name: "drop table",
 			operation: &DropTable{
@@ -65,6 +104,49 @@ func TestOperationSQL(t *testing.T) {
 			},
 			wantSQL: "ALTER TABLE users ADD COLUMN age INTEGER NOT NULL",
 		},
+		{
+			name: "add column with default",
+			operation: &AddColumn{
+				Table:  "posts",
+				Column: Column{Name: "status", Type: "TEXT", Default: "'draft'"},
+			},
+			wantSQL: "ALTER TABLE posts ADD COLUMN status TEXT NOT NULL DEFAULT 'draft'",
+		},
+		{
+			name: "alter column",
+			operation: &AlterColumn{
+				Table:  "invoices",
+				Column: Column{Name: "amount", Type: "NUMERIC", Precision: 12, Scale: 2, Default: "0"},
+			},
+			wantSQL: "ALTER TABLE invoices ALTER COLUMN amount TYPE NUMERIC(12,2), ALTER COLUMN amount SET NOT NULL, ALTER COLUMN amount SET DEFAULT 0",
+		},
+		{
+			name: "alter column to nullable without default",
+			operation: &AlterColumn{
+				Table:  "users",
+				Column: Column{Name: "bio", Type: "TEXT", IsNull: true},
+			},
+			wantSQL: "ALTER TABLE users ALTER COLUMN bio TYPE TEXT, ALTER COLUMN bio DROP NOT NULL, ALTER COLUMN bio DROP DEFAULT",
+		},
+		{
+			name: "add unique column",
+			operation: &AddColumn{
+				Table:  "users",
+				Column: Column{Name: "email", Type: "TEXT", IsNull: true, IsUnique: true},
+			},
+			wantSQL: "ALTER TABLE users ADD COLUMN email TEXT;\nCREATE UNIQUE INDEX idx_users_email_unique ON users (email)",
+		},
+		{
+			name: "create table with unique column",
+			operation: &CreateTable{
+				Name: "users",
+				Columns: []Column{
+					{Name: "id", Type: "INTEGER", IsPK: true, IsAuto: true},
+					{Name: "email", Type: "TEXT", IsUnique: true},
+				},
+			},
+			wantSQL: "CREATE TABLE users (\n\tid INTEGER PRIMARY KEY AUTOINCREMENT,\n\temail TEXT NOT NULL UNIQUE\n)",
+		},
 		{
 			name: "modify column",
 			operation: &ModifyColumn{
@@ -86,6 +168,17 @@ func TestOperationSQL(t *testing.T) {
 			},
 			wantSQL: "CREATE UNIQUE INDEX idx_users_email ON users (email)",
 		},
+		{
+			name: "create multi-column index",
+			operation: &CreateIndex{
+				Table: "memberships",
+				Index: Index{
+					Name:    "idx_memberships_team_user",
+					Columns: []string{"team_id", "user_id"},
+				},
+			},
+			wantSQL: "CREATE INDEX idx_memberships_team_user ON memberships (team_id, user_id)",
+		},
 		{
 			name: "drop index",
 			operation: &DropIndex{
@@ -145,6 +238,20 @@ func TestOperationSQL(t *testing.T) {
 			},
 			wantSQL: "CREATE TABLE users (\n\tid INTEGER PRIMARY KEY AUTOINCREMENT,\n\temail TEXT NOT NULL\n);\nCREATE UNIQUE INDEX idx_users_email ON users (email)",
 		},
+		{
+			name: "add unique constraint",
+			operation: &AddUniqueConstraint{
+				Table:   "memberships",
+				Name:    "memberships_team_user_key",
+				Columns: []string{"team_id", "user_id"},
+			},
+			wantSQL: "ALTER TABLE memberships ADD CONSTRAINT memberships_team_user_key UNIQUE (team_id, user_id)",
+		},
+		{
+			name:      "drop unique constraint",
+			operation: &DropUniqueConstraint{Table: "memberships", Name: "memberships_team_user_key"},
+			wantSQL:   "ALTER TABLE memberships DROP CONSTRAINT memberships_team_user_key",
+		},
 	}
 
 	for _, tt := range tests {
@@ -182,7 +289,7 @@ func TestBatchMigrations(t *testing.T) {
 	defer cleanup()
 
 	migrator := NewMigrator(db)
-	err := migrator.Initialize()
+	err := migrator.Initialize(context.Background())
 	if err != nil {
 		t.Fatalf("failed to initialize migrator: %v", err)
 	}
@@ -216,7 +323,7 @@ func TestBatchMigrations(t *testing.T) {
 	// Add and run first batch
 	migrator.Add(m1)
 	migrator.Add(m2)
-	err = migrator.UpWithBatch(true)
+	_, err = migrator.UpWithBatch(context.Background(), true)
 	if err != nil {
 		t.Fatalf("failed to run first batch: %v", err)
 	}
@@ -258,7 +365,7 @@ func TestBatchMigrations(t *testing.T) {
 
 	// Add and run second batch
 	migrator.Add(m3)
-	err = migrator.UpWithBatch(true)
+	_, err = migrator.UpWithBatch(context.Background(), true)
 	if err != nil {
 		t.Fatalf("failed to run second batch: %v", err)
 	}
@@ -291,7 +398,7 @@ func TestBatchMigrations(t *testing.T) {
 	}
 
 	// Roll back last batch
-	err = migrator.DownWithBatch(true)
+	_, err = migrator.DownWithBatch(context.Background(), true)
 	if err != nil {
 		t.Fatalf("failed to roll back: %v", err)
 	}
@@ -314,3 +421,420 @@ func TestBatchMigrations(t *testing.T) {
 		}
 	}
 }
+
+type TestMembership struct {
+	ID     int `db:"id,pk,auto"`
+	TeamID int `db:"team_id" theory_index:"idx_team_user,team_id,user_id,unique"`
+	UserID int `db:"user_id"`
+}
+
+func TestIndexesFromModel(t *testing.T) {
+	ops, err := IndexesFromModel(&TestMembership{})
+	if err != nil {
+		t.Fatalf("IndexesFromModel() error = %v", err)
+	}
+
+	if len(ops) != 1 {
+		t.Fatalf("IndexesFromModel() got %d operations, want 1", len(ops))
+	}
+
+	wantSQL := "CREATE UNIQUE INDEX idx_team_user ON test_membership (team_id, user_id)"
+	if got := ops[0].SQL(); got != wantSQL {
+		t.Errorf("SQL() = %v, want %v", got, wantSQL)
+	}
+
+	// Run the generated operations and verify the index is enforced
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	createTable, err := CreateTableFromModel(&TestMembership{})
+	if err != nil {
+		t.Fatalf("CreateTableFromModel() error = %v", err)
+	}
+
+	m := NewMigration("create_memberships")
+	m.Up = []Operation{createTable, ops[0]}
+
+	migrator := NewMigrator(db)
+	migrator.Add(m)
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Migrator.Up() error = %v", err)
+	}
+
+	insert := "INSERT INTO test_membership (team_id, user_id) VALUES (?, ?)"
+	if _, err := db.Exec(insert, 1, 1); err != nil {
+		t.Fatalf("failed to insert membership: %v", err)
+	}
+	if _, err := db.Exec(insert, 1, 2); err != nil {
+		t.Fatalf("failed to insert membership with different user: %v", err)
+	}
+	if _, err := db.Exec(insert, 1, 1); err == nil {
+		t.Error("expected duplicate membership to violate the unique index")
+	}
+}
+
+type TestAccount struct {
+	ID      int    `db:"id,pk,type=BIGINT"`
+	UUID    string `db:"uuid,type=CHAR(36)"`
+	Payload string `db:"payload,null,type=JSONB"`
+}
+
+func TestCreateTableFromModelTypeOverride(t *testing.T) {
+	op, err := CreateTableFromModel(&TestAccount{})
+	if err != nil {
+		t.Fatalf("CreateTableFromModel() error = %v", err)
+	}
+
+	wantSQL := "CREATE TABLE test_account (\n\tid BIGINT PRIMARY KEY,\n\tuuid CHAR(36) NOT NULL,\n\tpayload JSONB\n)"
+	if got := op.SQL(); got != wantSQL {
+		t.Errorf("SQL() = %v, want %v", got, wantSQL)
+	}
+
+	migrator := NewMigrator(nil)
+	if err := migrator.validateOperation(op, DialectSQLite); err != nil {
+		t.Errorf("validateOperation() error = %v", err)
+	}
+}
+
+func TestCreateTableFromModelSoftDelete(t *testing.T) {
+	type TestDocument struct {
+		ID        int        `db:"id,pk,auto"`
+		DeletedAt *time.Time `db:"deleted_at"`
+	}
+
+	op, err := CreateTableFromModel(&TestDocument{})
+	if err != nil {
+		t.Fatalf("CreateTableFromModel() error = %v", err)
+	}
+
+	wantSQL := "CREATE TABLE test_document (\n\tid INTEGER PRIMARY KEY AUTOINCREMENT,\n\tdeleted_at DATETIME\n)"
+	if got := op.SQL(); got != wantSQL {
+		t.Errorf("SQL() = %v, want %v", got, wantSQL)
+	}
+}
+
+func TestMigrationString(t *testing.T) {
+	m := &Migration{
+		ID:   "20240101000000_create_users",
+		Name: "create_users",
+		Up: []Operation{
+			&CreateTable{Name: "users", Columns: []Column{{Name: "id", Type: "INTEGER", IsPK: true}}},
+			&CreateIndex{Table: "users", Index: Index{Name: "idx_users_id", Columns: []string{"id"}}},
+		},
+		Down: []Operation{&DropTable{Name: "users"}},
+	}
+
+	want := "[20240101000000_create_users] create_users (2 up operations, 1 down operations)"
+	if got := m.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestTruncateTableSQL(t *testing.T) {
+	tests := []struct {
+		op                      TruncateTable
+		postgres, mysql, sqlite string
+	}{
+		{TruncateTable{Name: "users"}, "TRUNCATE TABLE users", "TRUNCATE TABLE users", "DELETE FROM users"},
+		{TruncateTable{Name: "users", RestartIdentity: true}, "TRUNCATE TABLE users RESTART IDENTITY", "TRUNCATE TABLE users", "DELETE FROM users"},
+		{TruncateTable{Name: "users", Cascade: true}, "TRUNCATE TABLE users CASCADE", "TRUNCATE TABLE users", "DELETE FROM users"},
+		{TruncateTable{Name: "users", RestartIdentity: true, Cascade: true}, "TRUNCATE TABLE users RESTART IDENTITY CASCADE", "TRUNCATE TABLE users", "DELETE FROM users"},
+	}
+
+	for _, tt := range tests {
+		for dialect, want := range map[string]string{
+			DialectPostgres: tt.postgres,
+			DialectMySQL:    tt.mysql,
+			DialectSQLite:   tt.sqlite,
+		} {
+			if got := DialectSQL(&tt.op, dialect); got != want {
+				t.Errorf("%+v for %s: SQL = %q, want %q", tt.op, dialect, got, want)
+			}
+		}
+		if got := tt.op.SQL(); got != tt.postgres {
+			t.Errorf("%+v: SQL() = %q, want the PostgreSQL form %q", tt.op, got, tt.postgres)
+		}
+	}
+}
+
+func TestGeneratedColumnSQL(t *testing.T) {
+	op := &CreateTable{
+		Name: "orders",
+		Columns: []Column{
+			{Name: "price", Type: "REAL"},
+			{Name: "quantity", Type: "INTEGER"},
+			{Name: "total", Type: "REAL", IsGenerated: true, GeneratedExpression: "price * quantity"},
+			{Name: "label", Type: "TEXT", IsGenerated: true, GeneratedExpression: "'x' || quantity", GeneratedStored: true},
+		},
+	}
+
+	for dialect, want := range map[string]string{
+		DialectSQLite: "CREATE TABLE orders (\n\tprice REAL NOT NULL,\n\tquantity INTEGER NOT NULL,\n" +
+			"\ttotal REAL GENERATED ALWAYS AS (price * quantity) VIRTUAL,\n" +
+			"\tlabel TEXT GENERATED ALWAYS AS ('x' || quantity) STORED\n)",
+		DialectPostgres: "CREATE TABLE orders (\n\tprice REAL NOT NULL,\n\tquantity INTEGER NOT NULL,\n" +
+			"\ttotal REAL GENERATED ALWAYS AS (price * quantity) STORED,\n" +
+			"\tlabel TEXT GENERATED ALWAYS AS ('x' || quantity) STORED\n)",
+	} {
+		if got := DialectSQL(op, dialect); got != want {
+			t.Errorf("SQL for %s = %q, want %q", dialect, got, want)
+		}
+	}
+
+	type Order struct {
+		ID       int     `db:"id,pk,auto"`
+		Price    float64 `db:"price"`
+		Quantity int     `db:"quantity"`
+		Total    float64 `db:"total,generated=(price * quantity),stored"`
+	}
+	fromModel, err := CreateTableFromModel(&Order{})
+	if err != nil {
+		t.Fatalf("CreateTableFromModel() error = %v", err)
+	}
+	want := Column{Name: "total", Type: "REAL", IsGenerated: true, GeneratedExpression: "price * quantity", GeneratedStored: true}
+	if got := fromModel.Columns[3]; !reflect.DeepEqual(got, want) {
+		t.Errorf("generated column = %+v, want %+v", got, want)
+	}
+}
+
+func TestAutoIncrementSQL(t *testing.T) {
+	op := &CreateTable{
+		Name:    "users",
+		Columns: []Column{{Name: "id", Type: "INTEGER", IsPK: true, IsAuto: true}},
+	}
+	for dialect, want := range map[string]string{
+		DialectSQLite:   "CREATE TABLE users (\n\tid INTEGER PRIMARY KEY AUTOINCREMENT\n)",
+		DialectPostgres: "CREATE TABLE users (\n\tid INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY\n)",
+		DialectMySQL:    "CREATE TABLE users (\n\tid INTEGER PRIMARY KEY AUTO_INCREMENT\n)",
+	} {
+		if got := DialectSQL(op, dialect); got != want {
+			t.Errorf("SQL for %s = %q, want %q", dialect, got, want)
+		}
+	}
+}
+
+func TestCreateTableEngineSQL(t *testing.T) {
+	op := &CreateTable{
+		Name:    "logs",
+		Columns: []Column{{Name: "id", Type: "INTEGER", IsPK: true}},
+		Indexes: []Index{{Name: "idx_logs_id", Columns: []string{"id"}}},
+		Engine:  "MyISAM",
+		Charset: "latin1",
+	}
+	for dialect, want := range map[string]string{
+		DialectSQLite: "CREATE TABLE logs (\n\tid INTEGER PRIMARY KEY\n);\nCREATE INDEX idx_logs_id ON logs (id)",
+		DialectMySQL:  "CREATE TABLE logs (\n\tid INTEGER PRIMARY KEY\n) ENGINE=MyISAM DEFAULT CHARSET=latin1;\nCREATE INDEX idx_logs_id ON logs (id)",
+	} {
+		if got := DialectSQL(op, dialect); got != want {
+			t.Errorf("SQL for %s = %q, want %q", dialect, got, want)
+		}
+	}
+}
+
+func TestMigratorTruncateTable(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	migrator := NewMigrator(db)
+	if got := migrator.Dialect(); got != DialectSQLite {
+		t.Fatalf("Dialect() = %q, want %q", got, DialectSQLite)
+	}
+
+	if _, err := db.Exec("CREATE TABLE logs (id INTEGER PRIMARY KEY); INSERT INTO logs (id) VALUES (1), (2)"); err != nil {
+		t.Fatalf("failed to create logs: %v", err)
+	}
+
+	truncate := NewMigration("truncate_logs")
+	truncate.Up = []Operation{&TruncateTable{Name: "logs", RestartIdentity: true}}
+	migrator.Add(truncate)
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&count); err != nil || count != 0 {
+		t.Errorf("expected logs to be empty, got %d rows (%v)", count, err)
+	}
+}
+
+func TestSequenceOperations(t *testing.T) {
+	minValue, maxValue := int64(100), int64(999999)
+	tests := []struct {
+		name      string
+		operation Operation
+		wantSQL   string
+	}{
+		{"create with defaults", &CreateSequence{Name: "order_numbers"}, "CREATE SEQUENCE order_numbers START WITH 1 INCREMENT BY 1"},
+		{"create with options", &CreateSequence{Name: "order_numbers", Start: 100, Increment: 10, MinValue: &minValue, MaxValue: &maxValue},
+			"CREATE SEQUENCE order_numbers START WITH 100 INCREMENT BY 10 MINVALUE 100 MAXVALUE 999999"},
+		{"drop", &DropSequence{Name: "order_numbers"}, "DROP SEQUENCE order_numbers"},
+		{"drop if exists", &DropSequence{Name: "order_numbers", IfExists: true}, "DROP SEQUENCE IF EXISTS order_numbers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.operation.SQL(); got != tt.wantSQL {
+				t.Errorf("SQL() = %v, want %v", got, tt.wantSQL)
+			}
+
+			v := tt.operation.(DialectValidator)
+			if err := v.Validate(DialectPostgres); err != nil {
+				t.Errorf("Validate(%s) error = %v", DialectPostgres, err)
+			}
+			for _, dialect := range []string{DialectSQLite, DialectMySQL} {
+				if err := v.Validate(dialect); !errors.Is(err, ErrUnsupportedOperation) {
+					t.Errorf("Validate(%s) error = %v, want %v", dialect, err, ErrUnsupportedOperation)
+				}
+			}
+		})
+	}
+
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	migrator := NewMigrator(db)
+	mig := NewMigration("create_sequence")
+	mig.Up = []Operation{&CreateSequence{Name: "order_numbers"}}
+	migrator.Add(mig)
+	if _, err := migrator.Up(context.Background()); !errors.Is(err, ErrUnsupportedOperation) {
+		t.Errorf("Up() error = %v, want %v", err, ErrUnsupportedOperation)
+	}
+}
+
+func TestPartialIndex(t *testing.T) {
+	type Subscriber struct {
+		ID     int    `db:"id,pk,auto"`
+		Email  string `db:"email" theory_index:"idx_subscriber_email,unique,partial=active = 1"`
+		Active bool   `db:"active"`
+	}
+
+	ops, err := IndexesFromModel(&Subscriber{})
+	if err != nil {
+		t.Fatalf("IndexesFromModel() error = %v", err)
+	}
+	want := Index{Name: "idx_subscriber_email", Columns: []string{"email"}, IsUnique: true, IsPartial: true, WhereClause: "active = 1"}
+	if len(ops) != 1 || !reflect.DeepEqual(ops[0].Index, want) {
+		t.Fatalf("IndexesFromModel() = %+v, want %+v", ops, want)
+	}
+
+	for _, op := range []DialectValidator{ops[0], &CreateTable{Name: "subscriber", Indexes: []Index{want}}} {
+		if err := op.Validate(DialectMySQL); !errors.Is(err, ErrUnsupportedOperation) {
+			t.Errorf("%T.Validate(mysql) = %v, want ErrUnsupportedOperation", op, err)
+		}
+		for _, dialect := range []string{DialectPostgres, DialectSQLite, ""} {
+			if err := op.Validate(dialect); err != nil {
+				t.Errorf("%T.Validate(%q) = %v", op, dialect, err)
+			}
+		}
+	}
+}
+
+func TestForeignKeyActions(t *testing.T) {
+	migrator := NewMigrator(nil)
+	for _, action := range []string{"CASCADE", "SET NULL", "RESTRICT", "NO ACTION", "SET DEFAULT"} {
+		op := &AddForeignKey{
+			Table: "posts",
+			ForeignKey: ForeignKey{
+				Columns:    []string{"user_id"},
+				RefTable:   "users",
+				RefColumns: []string{"id"},
+				OnDelete:   action,
+				OnUpdate:   action,
+			},
+		}
+		want := "ALTER TABLE posts ADD CONSTRAINT posts_user_id_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE " + action + " ON UPDATE " + action
+		if got := op.SQL(); got != want {
+			t.Errorf("SQL() = %q, want %q", got, want)
+		}
+		if err := migrator.validateOperation(op, DialectPostgres); err != nil {
+			t.Errorf("validateOperation(%s) error = %v", action, err)
+		}
+	}
+
+	onUpdateOnly := &AddForeignKey{
+		Table:      "posts",
+		ForeignKey: ForeignKey{Columns: []string{"user_id"}, RefTable: "users", RefColumns: []string{"id"}, OnUpdate: "set null"},
+	}
+	if got, want := onUpdateOnly.SQL(), "ALTER TABLE posts ADD CONSTRAINT posts_user_id_fk FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE set null"; got != want {
+		t.Errorf("SQL() = %q, want %q", got, want)
+	}
+	if err := migrator.validateOperation(onUpdateOnly, DialectPostgres); err != nil {
+		t.Errorf("expected a lowercase action to be accepted, got %v", err)
+	}
+	if got, want := onUpdateOnly.Drop().SQL(), "ALTER TABLE posts DROP CONSTRAINT posts_user_id_fk"; got != want {
+		t.Errorf("Drop().SQL() = %q, want %q", got, want)
+	}
+
+	invalid := []Operation{
+		&AddForeignKey{Table: "posts", ForeignKey: ForeignKey{Columns: []string{"user_id"}, RefTable: "users", RefColumns: []string{"id"}, OnDelete: "EXPLODE"}},
+		&AddForeignKey{Table: "posts", ForeignKey: ForeignKey{Columns: []string{"user_id"}, RefTable: "users", RefColumns: []string{"id"}, OnUpdate: "EXPLODE"}},
+		&CreateTable{
+			Name:        "posts",
+			Columns:     []Column{{Name: "user_id", Type: "INTEGER"}},
+			ForeignKeys: []ForeignKey{{Columns: []string{"user_id"}, RefTable: "users", RefColumns: []string{"id"}, OnUpdate: "EXPLODE"}},
+		},
+	}
+	for _, op := range invalid {
+		err := migrator.validateOperation(op, DialectPostgres)
+		if err == nil || !strings.Contains(err.Error(), "EXPLODE") {
+			t.Errorf("validateOperation(%T) error = %v, want an invalid action error", op, err)
+		}
+	}
+
+	for _, op := range []DialectValidator{onUpdateOnly, onUpdateOnly.Drop()} {
+		if err := op.Validate(DialectSQLite); !errors.Is(err, ErrUnsupportedOperation) {
+			t.Errorf("%T.Validate(sqlite) = %v, want ErrUnsupportedOperation", op, err)
+		}
+	}
+}
+
+func TestAlterColumn(t *testing.T) {
+	op := &AlterColumn{Table: "users", Column: Column{Name: "status", Type: "VARCHAR(20)", Default: "'active'"}}
+
+	if got, want := op.SQLFor(DialectMySQL), "ALTER TABLE users MODIFY COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active'"; got != want {
+		t.Errorf("SQLFor(mysql) = %q, want %q", got, want)
+	}
+	if err := op.Validate(DialectPostgres); err != nil {
+		t.Errorf("Validate(postgres) error = %v", err)
+	}
+
+	err := op.Validate(DialectSQLite)
+	if !errors.Is(err, ErrRequiresTableRebuild) {
+		t.Fatalf("Validate(sqlite) = %v, want ErrRequiresTableRebuild", err)
+	}
+	for _, step := range []string{"users_new", "INSERT INTO users_new SELECT", "DROP TABLE users", "ALTER TABLE users_new RENAME TO users"} {
+		if !strings.Contains(err.Error(), step) {
+			t.Errorf("expected %q in the suggested steps, got %q", step, err)
+		}
+	}
+
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	migrator := NewMigrator(db)
+	mig := NewMigration("alter_users_status")
+	mig.Up = []Operation{op}
+	migrator.Add(mig)
+	if _, err := migrator.Up(context.Background()); !errors.Is(err, ErrRequiresTableRebuild) {
+		t.Errorf("Up() error = %v, want ErrRequiresTableRebuild", err)
+	}
+}
+
+func TestForeignKeyActionsUp(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	migrator := NewMigrator(db)
+	mig := NewMigration("create_posts")
+	mig.Up = []Operation{&CreateTable{
+		Name:        "posts",
+		Columns:     []Column{{Name: "user_id", Type: "INTEGER"}},
+		ForeignKeys: []ForeignKey{{Columns: []string{"user_id"}, RefTable: "users", RefColumns: []string{"id"}, OnDelete: "EXPLODE"}},
+	}}
+	migrator.Add(mig)
+
+	if _, err := migrator.Up(context.Background()); err == nil || !strings.Contains(err.Error(), "invalid ON DELETE action EXPLODE") {
+		t.Errorf("Up() error = %v, want an invalid action error", err)
+	}
+}
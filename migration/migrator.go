@@ -1,69 +1,265 @@
 package migration
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
 // Migrator handles database migrations
 type Migrator struct {
+	mu         sync.RWMutex // guards db and dialect
 	db         *sql.DB
+	dialect    string
+	table      string
 	migrations []*Migration
+	output     io.Writer
+	logger     Logger
+	beforeEach func(m *Migration) error
+	afterEach  func(m *Migration, err error)
 }
 
+// ErrOrphanedMigration is returned by Verify when migrations recorded as
+// applied are no longer registered with the migrator
+var ErrOrphanedMigration = errors.New("orphaned migration")
+
 // MigrationRecord represents a migration record in the database
 type MigrationRecord struct {
-	ID        string
-	Name      string
-	Timestamp time.Time
-	Applied   time.Time
-	Batch     int
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Timestamp time.Time `json:"timestamp"`
+	Applied   time.Time `json:"applied"`
+	Batch     int       `json:"batch"`
+}
+
+// String describes the record by its ID, name, application time and batch
+func (r MigrationRecord) String() string {
+	return fmt.Sprintf("[%s] %s applied at %s in batch %d", r.ID, r.Name, r.Applied.Format("2006-01-02 15:04:05"), r.Batch)
 }
 
 // NewMigrator creates a new migrator instance
 func NewMigrator(db *sql.DB) *Migrator {
 	return &Migrator{
 		db:         db,
+		table:      DefaultTableName,
 		migrations: make([]*Migration, 0),
 	}
 }
 
+// DefaultTableName is the table applied migrations are recorded in unless
+// SetTableName is called
+const DefaultTableName = "migrations"
+
+// SetTableName sets the table applied migrations are recorded in. An empty
+// name restores DefaultTableName.
+func (m *Migrator) SetTableName(name string) {
+	if name == "" {
+		name = DefaultTableName
+	}
+	m.table = name
+}
+
+// TableName returns the table applied migrations are recorded in
+func (m *Migrator) TableName() string {
+	return m.table
+}
+
+// SetDB replaces the database the migrator runs against, for example after
+// credentials are rotated. Migrations already running finish on the
+// database they started with.
+func (m *Migrator) SetDB(db *sql.DB) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.db = db
+}
+
+// conn returns the current database
+func (m *Migrator) conn() *sql.DB {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.db
+}
+
 // Add adds a migration to the migrator
 func (m *Migrator) Add(migration *Migration) {
 	m.migrations = append(m.migrations, migration)
 }
 
+// SetOutput makes Up and Down write a timestamped progress line for each
+// migration to w. A nil writer disables the output.
+func (m *Migrator) SetOutput(w io.Writer) {
+	m.output = w
+}
+
+// progress writes the start of a progress line for a migration and returns
+// a function that completes it with the outcome and elapsed time, then
+// calls the AfterEach hook
+func (m *Migrator) progress(action string, migration *Migration) func(err error) {
+	start := time.Now()
+	if m.output != nil {
+		fmt.Fprintf(m.output, "[%s] %s: %s ... ", start.Format("2006-01-02 15:04:05"), action, migration.Name)
+	}
+
+	return func(err error) {
+		if m.output != nil {
+			elapsed := time.Since(start).Milliseconds()
+			if err != nil {
+				fmt.Fprintf(m.output, "failed (%dms)\n", elapsed)
+			} else {
+				fmt.Fprintf(m.output, "done (%dms)\n", elapsed)
+			}
+		}
+		if m.logger != nil {
+			if err != nil {
+				m.logger.Printf("%s %s [%s] error: %v", action, migration.Name, time.Since(start), err)
+			} else {
+				m.logger.Printf("%s %s [%s]", action, migration.Name, time.Since(start))
+			}
+		}
+		if m.afterEach != nil {
+			m.afterEach(migration, err)
+		}
+	}
+}
+
+// Logger receives the statements run by a Migrator. It is the interface the
+// root package logs queries with, so the same logger can be shared.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithLogger makes Up and Down log each statement they run with its
+// arguments, duration and error, and the outcome of each migration, to l.
+// A nil logger disables the logging. It returns m for chaining.
+func (m *Migrator) WithLogger(l Logger) *Migrator {
+	m.logger = l
+	return m
+}
+
+// logQuery logs a statement started at start, in the format the root
+// package uses for queries. err points to the statement's result, so it
+// can be deferred.
+func (m *Migrator) logQuery(query string, args []interface{}, start time.Time, err *error) {
+	if m.logger == nil {
+		return
+	}
+	elapsed := time.Since(start)
+	if *err != nil {
+		m.logger.Printf("%s %v [%s] error: %v", query, args, elapsed, *err)
+		return
+	}
+	m.logger.Printf("%s %v [%s]", query, args, elapsed)
+}
+
+// BeforeEach sets a hook called before each migration is applied or rolled
+// back. Returning an error aborts the migration, failing the run like any
+// other migration error.
+func (m *Migrator) BeforeEach(fn func(m *Migration) error) {
+	m.beforeEach = fn
+}
+
+// AfterEach sets a hook called after each attempted migration, with the
+// error it failed with, if any, including errors from the BeforeEach hook
+func (m *Migrator) AfterEach(fn func(m *Migration, err error)) {
+	m.afterEach = fn
+}
+
+// runBeforeEach calls the BeforeEach hook, if any
+func (m *Migrator) runBeforeEach(migration *Migration) error {
+	if m.beforeEach == nil {
+		return nil
+	}
+	if err := m.beforeEach(migration); err != nil {
+		return fmt.Errorf("migration %s rejected by BeforeEach: %w", migration.Name, err)
+	}
+	return nil
+}
+
 // Initialize creates the migrations table if it doesn't exist
-func (m *Migrator) Initialize() error {
+func (m *Migrator) Initialize(ctx context.Context) error {
+	return m.initialize(ctx, m.conn())
+}
+
+// initialize creates the migrations table in db if it doesn't exist
+func (m *Migrator) initialize(ctx context.Context, db querier) error {
 	sql := `
-		CREATE TABLE IF NOT EXISTS migrations (
-			id TEXT PRIMARY KEY,
+		CREATE TABLE IF NOT EXISTS ` + m.table + ` (
+			id VARCHAR(255) PRIMARY KEY,
 			name TEXT NOT NULL,
 			timestamp INTEGER NOT NULL,
 			applied INTEGER NOT NULL,
-			batch INTEGER NOT NULL DEFAULT 1
+			batch INTEGER NOT NULL DEFAULT 1,
+			squashed_by TEXT
 		)
 	`
-	_, err := m.db.Exec(sql)
+	if _, err := db.ExecContext(ctx, sql); err != nil {
+		return err
+	}
+
+	// Tables created before squashing was supported lack squashed_by
+	rows, err := db.QueryContext(ctx, "SELECT squashed_by FROM "+m.table+" WHERE 1 = 0")
+	if err == nil {
+		return rows.Close()
+	}
+	_, err = db.ExecContext(ctx, "ALTER TABLE "+m.table+" ADD COLUMN squashed_by TEXT")
 	return err
 }
 
-// validateSQLType checks if a SQL type is valid for SQLite
+// validSQLTypes lists the accepted column type names, without parameters
+var validSQLTypes = map[string]bool{
+	"INTEGER":   true,
+	"INT":       true,
+	"TINYINT":   true,
+	"SMALLINT":  true,
+	"BIGINT":    true,
+	"TEXT":      true,
+	"CHAR":      true,
+	"VARCHAR":   true,
+	"REAL":      true,
+	"DOUBLE":    true,
+	"FLOAT":     true,
+	"NUMERIC":   true,
+	"DECIMAL":   true,
+	"BOOLEAN":   true,
+	"DATE":      true,
+	"DATETIME":  true,
+	"TIMESTAMP": true,
+	"BLOB":      true,
+	"JSON":      true,
+	"JSONB":     true,
+	"UUID":      true,
+	"ENUM":      true,
+}
+
+// validateSQLType checks if a SQL type is valid. Parameters such as the
+// length in VARCHAR(100) are ignored.
 func (m *Migrator) validateSQLType(sqlType string) bool {
-	validTypes := map[string]bool{
-		"INTEGER": true,
-		"TEXT":    true,
-		"REAL":    true,
-		"BLOB":    true,
+	if i := strings.Index(sqlType, "("); i >= 0 {
+		if !strings.HasSuffix(sqlType, ")") {
+			return false
+		}
+		sqlType = sqlType[:i]
 	}
-	return validTypes[strings.ToUpper(sqlType)]
+	return validSQLTypes[strings.ToUpper(strings.TrimSpace(sqlType))]
 }
 
-// validateOperation checks if an operation is valid
-func (m *Migrator) validateOperation(op Operation) error {
+// validateOperation checks if an operation is valid for the dialect
+func (m *Migrator) validateOperation(op Operation, dialect string) error {
+	if err := validateDialect(op, dialect); err != nil {
+		return err
+	}
+
+	if err := validateForeignKeys(op); err != nil {
+		return err
+	}
+
 	switch o := op.(type) {
 	case *CreateTable:
 		for _, col := range o.Columns {
@@ -79,33 +275,94 @@ func (m *Migrator) validateOperation(op Operation) error {
 	return nil
 }
 
+// validateForeignKeys checks the referential actions of the foreign keys
+// an operation adds
+func validateForeignKeys(op Operation) error {
+	switch o := op.(type) {
+	case *CreateTable:
+		for _, fk := range o.ForeignKeys {
+			if err := validateForeignKey(fk); err != nil {
+				return err
+			}
+		}
+	case *AddForeignKey:
+		return validateForeignKey(o.ForeignKey)
+	}
+	return nil
+}
+
 // getNextBatchNumber gets the next batch number
-func (m *Migrator) getNextBatchNumber() (int, error) {
+func (m *Migrator) getNextBatchNumber(ctx context.Context, db querier) (int, error) {
 	var batch int
-	err := m.db.QueryRow("SELECT COALESCE(MAX(batch), 0) + 1 FROM migrations").Scan(&batch)
+	err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(batch), 0) + 1 FROM "+m.table).Scan(&batch)
 	if err != nil {
 		return 0, err
 	}
 	return batch, nil
 }
 
+// MigrationResult describes the outcome of a migration run
+type MigrationResult struct {
+	// Applied holds the IDs of the migrations applied (or rolled back) in this run
+	Applied []string
+	// Skipped holds the IDs of the migrations skipped by their SkipIf query
+	Skipped []string
+	// Failed holds the ID of the migration that failed, if any
+	Failed *string
+	// Duration is the total time spent on the run
+	Duration time.Duration
+}
+
+// failed records the failing migration. When the run used a transaction,
+// nothing from this run persists, so Applied is cleared.
+func (r *MigrationResult) failed(id string, useTx bool) {
+	r.Failed = &id
+	if useTx {
+		r.Applied = nil
+	}
+}
+
 // Up runs all pending migrations
-func (m *Migrator) Up() error {
-	return m.UpWithBatch(true)
+func (m *Migrator) Up(ctx context.Context) (MigrationResult, error) {
+	return m.UpWithBatch(ctx, true)
 }
 
 // UpWithBatch runs all pending migrations, optionally using a transaction
-func (m *Migrator) UpWithBatch(useTx bool) error {
-	// Get applied migrations
-	records, err := m.getAppliedMigrations()
+func (m *Migrator) UpWithBatch(ctx context.Context, useTx bool) (result MigrationResult, err error) {
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	// The whole run uses the database it started with, even if SetDB is
+	// called meanwhile
+	db := m.conn()
+	dialect := m.dialectOf(db)
+
+	// Everything below runs on the connection holding the lock
+	conn, unlock, err := m.lock(ctx, db, dialect)
 	if err != nil {
-		return err
+		return result, err
+	}
+	defer func() {
+		if unlockErr := unlock(); unlockErr != nil && err == nil {
+			err = unlockErr
+		}
+	}()
+
+	// Get applied migrations, including squashed ones
+	records, squashed, err := m.getMigrationRecords(ctx, conn)
+	if err != nil {
+		return result, err
 	}
 
 	applied := make(map[string]bool)
 	for _, record := range records {
 		applied[record.ID] = true
 	}
+	for id := range squashed {
+		applied[id] = true
+	}
 
 	// Sort migrations by timestamp
 	sort.Slice(m.migrations, func(i, j int) bool {
@@ -113,91 +370,213 @@ func (m *Migrator) UpWithBatch(useTx bool) error {
 	})
 
 	// Get next batch number
-	batch, err := m.getNextBatchNumber()
+	batch, err := m.getNextBatchNumber(ctx, conn)
 	if err != nil {
-		return err
+		return result, err
 	}
 
 	// Start transaction if requested
 	var tx *sql.Tx
 	if useTx {
-		tx, err = m.db.Begin()
+		tx, err = conn.BeginTx(ctx, nil)
 		if err != nil {
+			return result, err
+		}
+		// Rolling back after a successful commit is a no-op
+		defer tx.Rollback()
+	}
+
+	exec := func(query string, args ...interface{}) (err error) {
+		query = rebind(query, dialect)
+		defer m.logQuery(query, args, time.Now(), &err)
+		if useTx {
+			_, err = tx.ExecContext(ctx, query, args...)
 			return err
 		}
-		defer func() {
-			if err != nil {
-				tx.Rollback()
-			}
-		}()
+		_, err = conn.ExecContext(ctx, query, args...)
+		return err
+	}
+
+	// hasRows reports whether a query returns any rows
+	hasRows := func(query string) (_ bool, err error) {
+		defer m.logQuery(query, nil, time.Now(), &err)
+		var rows *sql.Rows
+		if useTx {
+			rows, err = tx.QueryContext(ctx, query)
+		} else {
+			rows, err = conn.QueryContext(ctx, query)
+		}
+		if err != nil {
+			return false, err
+		}
+		defer rows.Close()
+		return rows.Next(), rows.Err()
 	}
 
 	// Run pending migrations
 	for _, migration := range m.migrations {
-		if !applied[migration.ID] {
-			// Validate operations
-			for _, op := range migration.Up {
-				if err := m.validateOperation(op); err != nil {
-					return fmt.Errorf("invalid operation in migration %s: %v", migration.Name, err)
-				}
-			}
+		if applied[migration.ID] {
+			continue
+		}
 
-			// Execute operations
-			for _, op := range migration.Up {
-				sql := op.SQL()
-				if useTx {
-					_, err = tx.Exec(sql)
-				} else {
-					_, err = m.db.Exec(sql)
-				}
-				if err != nil {
-					return fmt.Errorf("failed to execute migration %s: %v", migration.Name, err)
+		if migration.SkipIf != "" {
+			skip, err := hasRows(migration.SkipIf)
+			if err != nil {
+				result.failed(migration.ID, useTx)
+				return result, fmt.Errorf("failed to check SkipIf of migration %s: %w", migration.Name, err)
+			}
+			if skip {
+				if m.output != nil {
+					fmt.Fprintf(m.output, "[%s] Skipping: %s\n", time.Now().Format("2006-01-02 15:04:05"), migration.Name)
 				}
+				result.Skipped = append(result.Skipped, migration.ID)
+				continue
 			}
+		}
 
-			// Record migration
-			now := time.Now().Unix()
-			sql := `
-				INSERT INTO migrations (id, name, timestamp, applied, batch)
-				VALUES (?, ?, ?, ?, ?)
-			`
-			if useTx {
-				_, err = tx.Exec(sql, migration.ID, migration.Name, migration.Timestamp.Unix(), now, batch)
-			} else {
-				_, err = m.db.Exec(sql, migration.ID, migration.Name, migration.Timestamp.Unix(), now, batch)
+		done := m.progress("Applying", migration)
+		if err := m.runBeforeEach(migration); err != nil {
+			done(err)
+			result.failed(migration.ID, useTx)
+			return result, err
+		}
+
+		// Validate operations
+		for _, op := range migration.Up {
+			if err := m.validateOperation(op, dialect); err != nil {
+				done(err)
+				result.failed(migration.ID, useTx)
+				return result, fmt.Errorf("invalid operation in migration %s: %w", migration.Name, err)
 			}
-			if err != nil {
-				return fmt.Errorf("failed to record migration %s: %v", migration.Name, err)
+		}
+
+		// Execute operations
+		for _, op := range migration.Up {
+			if err := exec(DialectSQL(op, dialect), op.Args()...); err != nil {
+				done(err)
+				result.failed(migration.ID, useTx)
+				return result, fmt.Errorf("failed to execute migration %s: %w", migration.Name, err)
 			}
 		}
+
+		// Record migration
+		now := time.Now().Unix()
+		sql := `
+			INSERT INTO ` + m.table + ` (id, name, timestamp, applied, batch)
+			VALUES (?, ?, ?, ?, ?)
+		`
+		if err := exec(sql, migration.ID, migration.Name, migration.Timestamp.Unix(), now, batch); err != nil {
+			done(err)
+			result.failed(migration.ID, useTx)
+			return result, fmt.Errorf("failed to record migration %s: %w", migration.Name, err)
+		}
+		done(nil)
+
+		result.Applied = append(result.Applied, migration.ID)
 	}
 
 	// Commit transaction if used
 	if useTx {
 		err = tx.Commit()
 		if err != nil {
-			return fmt.Errorf("failed to commit transaction: %v", err)
+			result.Applied = nil
+			return result, fmt.Errorf("failed to commit transaction: %w", err)
 		}
 	}
 
+	return result, nil
+}
+
+// RunSQL registers a one-off migration that runs upSQL, and downSQL when
+// rolled back, and applies it right away like Up, recording it with a
+// generated ID. Other pending migrations are applied along with it. If the
+// run fails, the migration is unregistered again.
+func (m *Migrator) RunSQL(ctx context.Context, upSQL, downSQL string) error {
+	migration := &Migration{
+		ID:        generateID() + "_run_sql",
+		Timestamp: time.Now(),
+		Name:      "run_sql",
+		Up:        []Operation{&CustomSQL{Query: upSQL}},
+	}
+	if downSQL != "" {
+		migration.Down = []Operation{&CustomSQL{Query: downSQL}}
+	}
+
+	m.Add(migration)
+	if _, err := m.Up(ctx); err != nil {
+		// Do not leave the failed statement to be retried by the next Up
+		for i, registered := range m.migrations {
+			if registered == migration {
+				m.migrations = append(m.migrations[:i], m.migrations[i+1:]...)
+				break
+			}
+		}
+		return err
+	}
 	return nil
 }
 
+// Apply runs a single migration with the migrator's database, settings and
+// hooks, leaving other pending migrations alone, and registers it once it is
+// applied. A migration that is already recorded as applied is skipped.
+func (m *Migrator) Apply(ctx context.Context, migration *Migration) (MigrationResult, error) {
+	m.mu.RLock()
+	single := &Migrator{
+		db:         m.db,
+		dialect:    m.dialect,
+		table:      m.table,
+		migrations: []*Migration{migration},
+		output:     m.output,
+		logger:     m.logger,
+		beforeEach: m.beforeEach,
+		afterEach:  m.afterEach,
+	}
+	m.mu.RUnlock()
+
+	result, err := single.Up(ctx)
+	if err != nil {
+		return result, err
+	}
+	m.Add(migration)
+	return result, nil
+}
+
 // Down rolls back the last batch of migrations
-func (m *Migrator) Down() error {
-	return m.DownWithBatch(true)
+func (m *Migrator) Down(ctx context.Context) (MigrationResult, error) {
+	return m.DownWithBatch(ctx, true)
 }
 
 // DownWithBatch rolls back the last batch of migrations, optionally using a transaction
-func (m *Migrator) DownWithBatch(useTx bool) error {
+func (m *Migrator) DownWithBatch(ctx context.Context, useTx bool) (result MigrationResult, err error) {
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	// The whole run uses the database it started with, even if SetDB is
+	// called meanwhile
+	db := m.conn()
+	dialect := m.dialectOf(db)
+
+	// Everything below runs on the connection holding the lock
+	conn, unlock, err := m.lock(ctx, db, dialect)
+	if err != nil {
+		return result, err
+	}
+	defer func() {
+		if unlockErr := unlock(); unlockErr != nil && err == nil {
+			err = unlockErr
+		}
+	}()
+
 	// Get applied migrations
-	records, err := m.getAppliedMigrations()
+	records, err := m.getAppliedMigrations(ctx, conn)
 	if err != nil {
-		return err
+		return result, err
 	}
 
 	if len(records) == 0 {
-		return nil
+		return result, nil
 	}
 
 	// Get last batch number
@@ -214,15 +593,23 @@ func (m *Migrator) DownWithBatch(useTx bool) error {
 	// Start transaction if requested
 	var tx *sql.Tx
 	if useTx {
-		tx, err = m.db.Begin()
+		tx, err = conn.BeginTx(ctx, nil)
 		if err != nil {
+			return result, err
+		}
+		// Rolling back after a successful commit is a no-op
+		defer tx.Rollback()
+	}
+
+	exec := func(query string, args ...interface{}) (err error) {
+		query = rebind(query, dialect)
+		defer m.logQuery(query, args, time.Now(), &err)
+		if useTx {
+			_, err = tx.ExecContext(ctx, query, args...)
 			return err
 		}
-		defer func() {
-			if err != nil {
-				tx.Rollback()
-			}
-		}()
+		_, err = conn.ExecContext(ctx, query, args...)
+		return err
 	}
 
 	// Roll back migrations in reverse order
@@ -238,59 +625,77 @@ func (m *Migrator) DownWithBatch(useTx bool) error {
 			}
 		}
 		if migration == nil {
-			return fmt.Errorf("migration %s not found", record.ID)
+			result.failed(record.ID, useTx)
+			return result, fmt.Errorf("migration %s not found", record.ID)
 		}
 
-		// Execute down operations
+		done := m.progress("Rolling back", migration)
+		if err := m.runBeforeEach(migration); err != nil {
+			done(err)
+			result.failed(migration.ID, useTx)
+			return result, err
+		}
+
+		// Execute down operations. Column types are not checked, so
+		// migrations recorded before a type was rejected can be rolled back.
 		for _, op := range migration.Down {
-			sql := op.SQL()
-			if useTx {
-				_, err = tx.Exec(sql)
-			} else {
-				_, err = m.db.Exec(sql)
+			err := validateDialect(op, dialect)
+			if err == nil {
+				err = validateForeignKeys(op)
 			}
 			if err != nil {
-				return fmt.Errorf("failed to roll back migration %s: %v", migration.Name, err)
+				done(err)
+				result.failed(migration.ID, useTx)
+				return result, fmt.Errorf("invalid operation in migration %s: %w", migration.Name, err)
+			}
+			if err := exec(DialectSQL(op, dialect), op.Args()...); err != nil {
+				done(err)
+				result.failed(migration.ID, useTx)
+				return result, fmt.Errorf("failed to roll back migration %s: %w", migration.Name, err)
 			}
 		}
 
 		// Remove migration record
-		sql := "DELETE FROM migrations WHERE id = ?"
-		if useTx {
-			_, err = tx.Exec(sql, record.ID)
-		} else {
-			_, err = m.db.Exec(sql, record.ID)
-		}
-		if err != nil {
-			return fmt.Errorf("failed to remove migration record %s: %v", migration.Name, err)
+		if err := exec("DELETE FROM "+m.table+" WHERE id = ?", record.ID); err != nil {
+			done(err)
+			result.failed(migration.ID, useTx)
+			return result, fmt.Errorf("failed to remove migration record %s: %w", migration.Name, err)
 		}
+		done(nil)
+
+		result.Applied = append(result.Applied, migration.ID)
 	}
 
 	// Commit transaction if used
 	if useTx {
 		err = tx.Commit()
 		if err != nil {
-			return fmt.Errorf("failed to commit transaction: %v", err)
+			result.Applied = nil
+			return result, fmt.Errorf("failed to commit transaction: %w", err)
 		}
 	}
 
-	return nil
+	return result, nil
 }
 
-// Status returns the status of all migrations
+// Status returns the status of all migrations. Registered migrations that
+// were squashed are left out.
 func (m *Migrator) Status() ([]struct {
 	Migration *Migration
 	Applied   *time.Time
 	Batch     int
 }, error) {
+	ctx := context.Background()
+
 	// Initialize migrations table if it doesn't exist
-	err := m.Initialize()
+	db := m.conn()
+	err := m.initialize(ctx, db)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize migrations table: %v", err)
+		return nil, fmt.Errorf("failed to initialize migrations table: %w", err)
 	}
 
 	// Get applied migrations
-	records, err := m.getAppliedMigrations()
+	records, squashed, err := m.getMigrationRecords(ctx, db)
 	if err != nil {
 		return nil, err
 	}
@@ -317,6 +722,9 @@ func (m *Migrator) Status() ([]struct {
 	}
 
 	for _, migration := range m.migrations {
+		if _, ok := squashed[migration.ID]; ok {
+			continue
+		}
 		if record, ok := applied[migration.ID]; ok {
 			appliedTime := record.time
 			status = append(status, struct {
@@ -344,35 +752,262 @@ func (m *Migrator) Status() ([]struct {
 	return status, nil
 }
 
-// getAppliedMigrations returns all applied migrations
-func (m *Migrator) getAppliedMigrations() ([]MigrationRecord, error) {
+// ListApplied returns the applied migrations recorded in the database,
+// oldest first. Squashed migrations are left out.
+func (m *Migrator) ListApplied() ([]MigrationRecord, error) {
+	return m.getAppliedMigrations(context.Background(), m.conn())
+}
+
+// ExportHistory returns the applied migrations as an indented JSON array,
+// oldest first, for keeping an audit trail in a repository. Times are in
+// UTC so the output does not depend on the machine exporting it.
+func (m *Migrator) ExportHistory() ([]byte, error) {
+	records, err := m.ListApplied()
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]MigrationRecord, len(records))
+	for i, record := range records {
+		record.Timestamp = record.Timestamp.UTC()
+		record.Applied = record.Applied.UTC()
+		history[i] = record
+	}
+	return json.MarshalIndent(history, "", "  ")
+}
+
+// ListPending returns the registered migrations that have not been applied,
+// in the order Up would apply them
+func (m *Migrator) ListPending() ([]*Migration, error) {
+	records, squashed, err := m.getMigrationRecords(context.Background(), m.conn())
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[string]bool, len(records)+len(squashed))
+	for _, record := range records {
+		applied[record.ID] = true
+	}
+	for id := range squashed {
+		applied[id] = true
+	}
+
+	var pending []*Migration
+	for _, migration := range m.migrations {
+		if !applied[migration.ID] {
+			pending = append(pending, migration)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].Timestamp.Before(pending[j].Timestamp)
+	})
+	return pending, nil
+}
+
+// Version returns the ID of the most recently applied migration, or an
+// empty string when no migration has been applied
+func (m *Migrator) Version() (string, error) {
+	ctx := context.Background()
+
+	// Initialize migrations table if it doesn't exist
+	db := m.conn()
+	if err := m.initialize(ctx, db); err != nil {
+		return "", fmt.Errorf("failed to initialize migrations table: %w", err)
+	}
+
+	// Applied times have second precision, so ties are broken by batch and
+	// then by the order migrations run in within a batch
+	var id string
+	err := db.QueryRowContext(ctx, `
+		SELECT id FROM `+m.table+`
+		WHERE squashed_by IS NULL
+		ORDER BY applied DESC, batch DESC, timestamp DESC
+		LIMIT 1
+	`).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return id, err
+}
+
+// Verify checks that every migration recorded as applied is still registered
+// with the migrator. Rolling back an unregistered migration fails, so the IDs
+// of any such migrations are returned wrapped in ErrOrphanedMigration.
+func (m *Migrator) Verify() error {
+	records, err := m.getAppliedMigrations(context.Background(), m.conn())
+	if err != nil {
+		return err
+	}
+
+	registered := make(map[string]bool, len(m.migrations))
+	for _, migration := range m.migrations {
+		registered[migration.ID] = true
+	}
+
+	var orphaned []string
+	for _, record := range records {
+		if !registered[record.ID] {
+			orphaned = append(orphaned, record.ID)
+		}
+	}
+	if len(orphaned) > 0 {
+		return fmt.Errorf("%w: %s", ErrOrphanedMigration, strings.Join(orphaned, ", "))
+	}
+	return nil
+}
+
+// DotGraph returns the registered migrations as a Graphviz digraph, with an
+// edge from each migration to the migrations depending on it. Applied
+// migrations are drawn in green. If the applied migrations cannot be read,
+// every migration is drawn as pending.
+func (m *Migrator) DotGraph() string {
+	applied := make(map[string]bool)
+	if records, err := m.getAppliedMigrations(context.Background(), m.conn()); err == nil {
+		for _, record := range records {
+			applied[record.ID] = true
+		}
+	}
+
+	migrations := append([]*Migration(nil), m.migrations...)
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return migrations[i].Timestamp.Before(migrations[j].Timestamp)
+	})
+
+	var out strings.Builder
+	out.WriteString("digraph migrations {\n")
+	for _, migration := range migrations {
+		color := "gray"
+		if applied[migration.ID] {
+			color = "green"
+		}
+		fmt.Fprintf(&out, "\t%q [label=%q, color=%q];\n", migration.ID, migration.Name, color)
+	}
+	for _, migration := range migrations {
+		for _, dependency := range migration.DependsOn {
+			fmt.Fprintf(&out, "\t%q -> %q;\n", dependency, migration.ID)
+		}
+	}
+	out.WriteString("}\n")
+	return out.String()
+}
+
+// getAppliedMigrations returns all applied migrations recorded in db that
+// were not squashed
+func (m *Migrator) getAppliedMigrations(ctx context.Context, db querier) ([]MigrationRecord, error) {
+	records, _, err := m.getMigrationRecords(ctx, db)
+	return records, err
+}
+
+// getMigrationRecords returns the applied migrations recorded in db that
+// were not squashed, along with the IDs of squashed migrations mapped to the
+// ID of the migration replacing them
+func (m *Migrator) getMigrationRecords(ctx context.Context, db querier) ([]MigrationRecord, map[string]string, error) {
 	// Initialize migrations table if it doesn't exist
-	err := m.Initialize()
+	err := m.initialize(ctx, db)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize migrations table: %v", err)
+		return nil, nil, fmt.Errorf("failed to initialize migrations table: %w", err)
 	}
 
-	rows, err := m.db.Query(`
-		SELECT id, name, timestamp, applied, batch
-		FROM migrations
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, name, timestamp, applied, batch, squashed_by
+		FROM `+m.table+`
 		ORDER BY timestamp ASC
 	`)
-	if err != nil && err != sql.ErrNoRows {
-		return nil, err
+	if err != nil {
+		return nil, nil, err
 	}
+	defer rows.Close()
 
 	var records []MigrationRecord
+	squashed := make(map[string]string)
 	for rows.Next() {
 		var record MigrationRecord
 		var timestamp, applied int64
-		err := rows.Scan(&record.ID, &record.Name, &timestamp, &applied, &record.Batch)
+		var squashedBy sql.NullString
+		err := rows.Scan(&record.ID, &record.Name, &timestamp, &applied, &record.Batch, &squashedBy)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		if squashedBy.Valid {
+			squashed[record.ID] = squashedBy.String
+			continue
 		}
 		record.Timestamp = time.Unix(timestamp, 0)
 		record.Applied = time.Unix(applied, 0)
 		records = append(records, record)
 	}
 
-	return records, nil
+	return records, squashed, rows.Err()
+}
+
+// MarkSquashed records that the applied migrations ids were squashed into
+// the registered migration replacedBy, so they no longer count as applied
+// and can be removed from the code. If replacedBy is not recorded yet, it
+// is recorded as applied in the batch of the last squashed migration
+// without running it, as its changes are already in the database.
+func (m *Migrator) MarkSquashed(ids []string, replacedBy string) error {
+	ctx := context.Background()
+
+	var replacement *Migration
+	for _, migration := range m.migrations {
+		if migration.ID == replacedBy {
+			replacement = migration
+			break
+		}
+	}
+	if replacement == nil {
+		return fmt.Errorf("replacement migration %s is not registered", replacedBy)
+	}
+
+	db := m.conn()
+	dialect := m.dialectOf(db)
+	records, _, err := m.getMigrationRecords(ctx, db)
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]MigrationRecord, len(records))
+	for _, record := range records {
+		byID[record.ID] = record
+	}
+
+	batch := 0
+	for _, id := range ids {
+		record, ok := byID[id]
+		if !ok || id == replacedBy {
+			return fmt.Errorf("cannot squash migration %s: not applied", id)
+		}
+		if record.Batch > batch {
+			batch = record.Batch
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rolling back after a successful commit is a no-op
+	defer tx.Rollback()
+
+	exec := func(query string, args ...interface{}) (err error) {
+		query = rebind(query, dialect)
+		defer m.logQuery(query, args, time.Now(), &err)
+		_, err = tx.ExecContext(ctx, query, args...)
+		return err
+	}
+
+	for _, id := range ids {
+		if err := exec("UPDATE "+m.table+" SET squashed_by = ? WHERE id = ?", replacedBy, id); err != nil {
+			return fmt.Errorf("failed to mark migration %s as squashed: %w", id, err)
+		}
+	}
+	if _, ok := byID[replacedBy]; !ok {
+		sql := `
+			INSERT INTO ` + m.table + ` (id, name, timestamp, applied, batch)
+			VALUES (?, ?, ?, ?, ?)
+		`
+		if err := exec(sql, replacement.ID, replacement.Name, replacement.Timestamp.Unix(), time.Now().Unix(), batch); err != nil {
+			return fmt.Errorf("failed to record migration %s: %w", replacement.Name, err)
+		}
+	}
+	return tx.Commit()
 }
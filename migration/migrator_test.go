@@ -1,10 +1,20 @@
 package migration
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 func setupTestDB(t *testing.T) (*sql.DB, func()) {
@@ -24,7 +34,7 @@ func TestMigrator(t *testing.T) {
 	migrator := NewMigrator(db)
 
 	// Test Initialize
-	err := migrator.Initialize()
+	err := migrator.Initialize(context.Background())
 	if err != nil {
 		t.Fatalf("Migrator.Initialize() error = %v", err)
 	}
@@ -60,7 +70,7 @@ func TestMigrator(t *testing.T) {
 	migrator.Add(migration2)
 
 	// Test Up with batch
-	err = migrator.UpWithBatch(true)
+	_, err = migrator.UpWithBatch(context.Background(), true)
 	if err != nil {
 		t.Fatalf("Migrator.UpWithBatch() error = %v", err)
 	}
@@ -101,7 +111,7 @@ func TestMigrator(t *testing.T) {
 	}
 
 	migrator.Add(migration3)
-	err = migrator.UpWithBatch(true)
+	_, err = migrator.UpWithBatch(context.Background(), true)
 	if err != nil {
 		t.Fatalf("Migrator.UpWithBatch() error = %v", err)
 	}
@@ -134,7 +144,7 @@ func TestMigrator(t *testing.T) {
 	}
 
 	// Test Down with batch
-	err = migrator.DownWithBatch(true)
+	_, err = migrator.DownWithBatch(context.Background(), true)
 	if err != nil {
 		t.Fatalf("Migrator.DownWithBatch() error = %v", err)
 	}
@@ -165,7 +175,7 @@ func TestMigratorErrorHandling(t *testing.T) {
 	migrator := NewMigrator(db)
 
 	// Test Initialize error handling
-	err := migrator.Initialize()
+	err := migrator.Initialize(context.Background())
 	if err != nil {
 		t.Fatalf("Migrator.Initialize() error = %v", err)
 	}
@@ -193,7 +203,7 @@ func TestMigratorErrorHandling(t *testing.T) {
 	}
 
 	migrator.Add(invalidMigration)
-	err = migrator.UpWithBatch(true)
+	_, err = migrator.UpWithBatch(context.Background(), true)
 	if err == nil {
 		t.Error("Migrator.UpWithBatch() expected error for invalid SQL")
 	}
@@ -220,3 +230,964 @@ func TestMigratorErrorHandling(t *testing.T) {
 		t.Error("migrations table contains rows after failed migration")
 	}
 }
+
+func TestMigrationRecordString(t *testing.T) {
+	record := MigrationRecord{
+		ID:      "20240101000000_create_users",
+		Name:    "create_users",
+		Applied: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC),
+		Batch:   3,
+	}
+
+	want := "[20240101000000_create_users] create_users applied at 2024-01-02 15:04:05 in batch 3"
+	if got := record.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := fmt.Sprint(record); got != want {
+		t.Errorf("fmt.Sprint() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateSQLType(t *testing.T) {
+	migrator := NewMigrator(nil)
+
+	for _, sqlType := range []string{"INTEGER", "varchar(255)", "TINYINT(1)", "DATETIME", "ENUM('draft','published')", "DECIMAL(10,2)"} {
+		if !migrator.validateSQLType(sqlType) {
+			t.Errorf("validateSQLType(%q) = false, want true", sqlType)
+		}
+	}
+	for _, sqlType := range []string{"", "INVALID_TYPE", "VARCHAR(255", "ENUMS('a')"} {
+		if migrator.validateSQLType(sqlType) {
+			t.Errorf("validateSQLType(%q) = true, want false", sqlType)
+		}
+	}
+}
+
+func TestMigratorContextCanceled(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	migrator := NewMigrator(db)
+
+	m := NewMigration("create_users")
+	m.Up = []Operation{
+		&CreateTable{
+			Name: "users",
+			Columns: []Column{
+				{Name: "id", Type: "INTEGER", IsPK: true, IsAuto: true},
+			},
+		},
+	}
+	m.Down = []Operation{
+		&DropTable{Name: "users"},
+	}
+	migrator.Add(m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := migrator.Initialize(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Migrator.Initialize() error = %v, want %v", err, context.Canceled)
+	}
+
+	_, err = migrator.Up(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Migrator.Up() error = %v, want %v", err, context.Canceled)
+	}
+
+	_, err = migrator.Down(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Migrator.Down() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestMigrationResult(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	migrator := NewMigrator(db)
+
+	m1 := NewMigration("create_users")
+	m1.Up = []Operation{
+		&CreateTable{
+			Name: "users",
+			Columns: []Column{
+				{Name: "id", Type: "INTEGER", IsPK: true, IsAuto: true},
+			},
+		},
+	}
+	m1.Down = []Operation{
+		&DropTable{Name: "users"},
+	}
+
+	m2 := NewMigration("add_users_name")
+	m2.Up = []Operation{
+		&AddColumn{Table: "users", Column: Column{Name: "name", Type: "TEXT", IsNull: true}},
+	}
+	m2.Down = []Operation{
+		&DropColumn{Table: "users", Column: "name"},
+	}
+
+	migrator.Add(m1)
+	migrator.Add(m2)
+
+	result, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Migrator.Up() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(result.Applied, []string{m1.ID, m2.ID}) {
+		t.Errorf("Up() Applied = %v, want %v", result.Applied, []string{m1.ID, m2.ID})
+	}
+	if result.Failed != nil {
+		t.Errorf("Up() Failed = %v, want nil", *result.Failed)
+	}
+	if result.Duration <= 0 {
+		t.Error("Up() Duration not set")
+	}
+
+	result, err = migrator.Down(ctx)
+	if err != nil {
+		t.Fatalf("Migrator.Down() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(result.Applied, []string{m2.ID, m1.ID}) {
+		t.Errorf("Down() Applied = %v, want %v", result.Applied, []string{m2.ID, m1.ID})
+	}
+}
+
+func TestMigrationResultPartialFailure(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	migrator := NewMigrator(db)
+
+	good := NewMigration("create_users")
+	good.Up = []Operation{
+		&CreateTable{
+			Name: "users",
+			Columns: []Column{
+				{Name: "id", Type: "INTEGER", IsPK: true, IsAuto: true},
+			},
+		},
+	}
+
+	bad := NewMigration("add_posts_title")
+	bad.Up = []Operation{
+		&AddColumn{Table: "posts", Column: Column{Name: "title", Type: "TEXT", IsNull: true}},
+	}
+
+	migrator.Add(good)
+	migrator.Add(bad)
+
+	result, err := migrator.UpWithBatch(context.Background(), false)
+	if err == nil {
+		t.Fatal("Migrator.UpWithBatch() expected error for missing table")
+	}
+
+	if result.Failed == nil || *result.Failed != bad.ID {
+		t.Errorf("UpWithBatch() Failed = %v, want %v", result.Failed, bad.ID)
+	}
+	if !reflect.DeepEqual(result.Applied, []string{good.ID}) {
+		t.Errorf("UpWithBatch() Applied = %v, want %v", result.Applied, []string{good.ID})
+	}
+}
+
+func TestListAppliedAndPending(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	migrator := NewMigrator(db)
+
+	var migrations []*Migration
+	for i, name := range []string{"create_a", "create_b", "create_c", "create_d"} {
+		mig := NewMigration(name)
+		mig.ID = fmt.Sprintf("%d_%s", i+1, name)
+		mig.Timestamp = time.Unix(int64(i+1), 0)
+		mig.Up = []Operation{&CreateTable{Name: name[len("create_"):], Columns: []Column{{Name: "id", Type: "INTEGER", IsPK: true}}}}
+		migrations = append(migrations, mig)
+	}
+
+	migrator.Add(migrations[0])
+	migrator.Add(migrations[1])
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	migrator.Add(migrations[3])
+	migrator.Add(migrations[2])
+
+	applied, err := migrator.ListApplied()
+	if err != nil {
+		t.Fatalf("ListApplied() error = %v", err)
+	}
+	if len(applied) != 2 || applied[0].ID != "1_create_a" || applied[1].ID != "2_create_b" {
+		t.Errorf("ListApplied() = %+v, want 1_create_a and 2_create_b", applied)
+	}
+
+	pending, err := migrator.ListPending()
+	if err != nil {
+		t.Fatalf("ListPending() error = %v", err)
+	}
+	if len(pending) != 2 || pending[0].ID != "3_create_c" || pending[1].ID != "4_create_d" {
+		t.Errorf("ListPending() = %v, want 3_create_c and 4_create_d", pending)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	migrator := NewMigrator(db)
+
+	version, err := migrator.Version()
+	if err != nil {
+		t.Fatalf("Version() error = %v", err)
+	}
+	if version != "" {
+		t.Errorf("Version() = %q on a fresh database, want empty", version)
+	}
+
+	for i, name := range []string{"create_a", "create_b", "create_c"} {
+		mig := NewMigration(name)
+		mig.ID = fmt.Sprintf("%d_%s", i+1, name)
+		mig.Timestamp = time.Unix(int64(i+1), 0)
+		mig.Up = []Operation{&CreateTable{Name: name[len("create_"):], Columns: []Column{{Name: "id", Type: "INTEGER", IsPK: true}}}}
+		migrator.Add(mig)
+
+		// The first two run in one batch, the last in its own
+		if i == 0 {
+			continue
+		}
+		if _, err := migrator.Up(ctx); err != nil {
+			t.Fatalf("Up() error = %v", err)
+		}
+
+		version, err := migrator.Version()
+		if err != nil {
+			t.Fatalf("Version() error = %v", err)
+		}
+		if version != mig.ID {
+			t.Errorf("Version() = %q, want %q", version, mig.ID)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	migrator := NewMigrator(db)
+
+	mig := NewMigration("create_users")
+	mig.ID = "1_create_users"
+	mig.Up = []Operation{&CreateTable{Name: "users", Columns: []Column{{Name: "id", Type: "INTEGER", IsPK: true}}}}
+	mig.Down = []Operation{&DropTable{Name: "users"}}
+	migrator.Add(mig)
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if err := migrator.Verify(); err != nil {
+		t.Errorf("Verify() error = %v, want nil", err)
+	}
+
+	// A migrator without the migration registered sees it as orphaned
+	migrator = NewMigrator(db)
+	err := migrator.Verify()
+	if !errors.Is(err, ErrOrphanedMigration) {
+		t.Fatalf("Verify() error = %v, want ErrOrphanedMigration", err)
+	}
+	if !strings.Contains(err.Error(), mig.ID) {
+		t.Errorf("Verify() error = %q, want it to list %s", err, mig.ID)
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	migrator := NewMigrator(db)
+
+	var out bytes.Buffer
+	migrator.SetOutput(&out)
+
+	mig := NewMigration("create_users")
+	mig.Up = []Operation{&CreateTable{Name: "users", Columns: []Column{{Name: "id", Type: "INTEGER", IsPK: true}}}}
+	mig.Down = []Operation{&DropTable{Name: "users"}}
+	migrator.Add(mig)
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if _, err := migrator.Down(ctx); err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	patterns := []string{
+		`^\[\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\] Applying: create_users \.\.\. done \(\d+ms\)$`,
+		`^\[\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\] Rolling back: create_users \.\.\. done \(\d+ms\)$`,
+	}
+	if len(lines) != len(patterns) {
+		t.Fatalf("output = %q, want %d lines", out.String(), len(patterns))
+	}
+	for i, pattern := range patterns {
+		if !regexp.MustCompile(pattern).MatchString(lines[i]) {
+			t.Errorf("line %d = %q, want match for %s", i, lines[i], pattern)
+		}
+	}
+}
+
+func TestDotGraph(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	migrator := NewMigrator(db)
+
+	users := NewMigration("create_users")
+	users.ID = "1_create_users"
+	users.Timestamp = time.Unix(1, 0)
+	users.Up = []Operation{&CreateTable{Name: "users", Columns: []Column{{Name: "id", Type: "INTEGER", IsPK: true}}}}
+	migrator.Add(users)
+
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	posts := NewMigration("create_posts")
+	posts.ID = "2_create_posts"
+	posts.Timestamp = time.Unix(2, 0)
+	posts.DependsOn = []string{users.ID}
+	migrator.Add(posts)
+
+	comments := NewMigration("create_comments")
+	comments.ID = "3_create_comments"
+	comments.Timestamp = time.Unix(3, 0)
+	comments.DependsOn = []string{users.ID, posts.ID}
+	migrator.Add(comments)
+
+	graph := migrator.DotGraph()
+	if !strings.HasPrefix(graph, "digraph migrations {\n") || !strings.HasSuffix(graph, "}\n") {
+		t.Errorf("DotGraph() = %q, want a digraph", graph)
+	}
+
+	for _, want := range []string{
+		`"1_create_users" [label="create_users", color="green"];`,
+		`"2_create_posts" [label="create_posts", color="gray"];`,
+		`"3_create_comments" [label="create_comments", color="gray"];`,
+		`"1_create_users" -> "2_create_posts";`,
+		`"1_create_users" -> "3_create_comments";`,
+		`"2_create_posts" -> "3_create_comments";`,
+	} {
+		if !strings.Contains(graph, want) {
+			t.Errorf("DotGraph() = %q, want it to contain %s", graph, want)
+		}
+	}
+	if n := strings.Count(graph, "->"); n != 3 {
+		t.Errorf("DotGraph() has %d edges, want 3", n)
+	}
+}
+
+// blockingOp pauses the migration running it until released
+type blockingOp struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (op *blockingOp) SQL() string {
+	close(op.started)
+	<-op.release
+	return "CREATE TABLE accounts (id INTEGER PRIMARY KEY)"
+}
+
+func (op *blockingOp) Args() []interface{} {
+	return nil
+}
+
+func TestSetDB(t *testing.T) {
+	open := func(name string) *sql.DB {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), name))
+		if err != nil {
+			t.Fatalf("Failed to open test database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	oldDB, newDB := open("old.db"), open("new.db")
+
+	op := &blockingOp{started: make(chan struct{}), release: make(chan struct{})}
+	createAccounts := NewMigration("create_accounts")
+	createAccounts.Up = []Operation{op}
+
+	migrator := NewMigrator(oldDB)
+	migrator.Add(createAccounts)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := migrator.Up(context.Background())
+		errs <- err
+	}()
+
+	// Swap the database while the migration is running
+	<-op.started
+	swapped := make(chan struct{})
+	go func() {
+		migrator.SetDB(newDB)
+		close(swapped)
+	}()
+	<-swapped
+	close(op.release)
+
+	if err := <-errs; err != nil {
+		t.Fatalf("Migrator.Up() error = %v", err)
+	}
+
+	// The running migration finished on the old database
+	var count int
+	if err := oldDB.QueryRow("SELECT COUNT(*) FROM migrations WHERE id = ?", createAccounts.ID).Scan(&count); err != nil || count != 1 {
+		t.Errorf("expected migration recorded in the old database, got %d, %v", count, err)
+	}
+	if _, err := oldDB.Exec("INSERT INTO accounts (id) VALUES (1)"); err != nil {
+		t.Errorf("expected accounts table in the old database: %v", err)
+	}
+	if _, err := newDB.Exec("SELECT 1 FROM accounts"); err == nil {
+		t.Error("expected no accounts table in the new database")
+	}
+
+	// Later calls use the new database
+	version, err := migrator.Version()
+	if err != nil || version != "" {
+		t.Errorf("Version() on the new database = %q, %v, want none", version, err)
+	}
+}
+
+func TestBeforeAndAfterEach(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	createUsers := NewMigration("create_users")
+	createUsers.Up = []Operation{&CreateTable{Name: "users", Columns: []Column{{Name: "id", Type: "INTEGER", IsPK: true}}}}
+	skipPosts := NewMigration("skip_create_posts")
+	skipPosts.Timestamp = createUsers.Timestamp.Add(time.Second)
+	skipPosts.Up = []Operation{&CreateTable{Name: "posts", Columns: []Column{{Name: "id", Type: "INTEGER", IsPK: true}}}}
+
+	migrator := NewMigrator(db)
+	migrator.Add(createUsers)
+	migrator.Add(skipPosts)
+
+	errSkipped := errors.New("skipped")
+	migrator.BeforeEach(func(m *Migration) error {
+		if strings.HasPrefix(m.Name, "skip_") {
+			return errSkipped
+		}
+		return nil
+	})
+
+	attempted := make(map[string]error)
+	migrator.AfterEach(func(m *Migration, err error) {
+		attempted[m.Name] = err
+	})
+
+	result, err := migrator.UpWithBatch(context.Background(), false)
+	if !errors.Is(err, errSkipped) {
+		t.Fatalf("UpWithBatch() error = %v, want %v", err, errSkipped)
+	}
+	if !reflect.DeepEqual(result.Applied, []string{createUsers.ID}) {
+		t.Errorf("Applied = %v, want only %s", result.Applied, createUsers.ID)
+	}
+
+	pending, err := migrator.ListPending()
+	if err != nil {
+		t.Fatalf("ListPending() error = %v", err)
+	}
+	if len(pending) != 1 || pending[0] != skipPosts {
+		t.Errorf("expected %s to stay pending, got %v", skipPosts.Name, pending)
+	}
+	if _, err := db.Exec("SELECT 1 FROM posts"); err == nil {
+		t.Error("expected posts table not to be created")
+	}
+
+	if len(attempted) != 2 {
+		t.Fatalf("expected AfterEach for 2 migrations, got %v", attempted)
+	}
+	if err := attempted["create_users"]; err != nil {
+		t.Errorf("AfterEach(create_users) error = %v, want nil", err)
+	}
+	if err := attempted["skip_create_posts"]; !errors.Is(err, errSkipped) {
+		t.Errorf("AfterEach(skip_create_posts) error = %v, want %v", err, errSkipped)
+	}
+}
+
+func TestExportHistory(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	migrator := NewMigrator(db)
+
+	for i, name := range []string{"create_a", "create_b"} {
+		mig := NewMigration(name)
+		mig.ID = fmt.Sprintf("%d_%s", i+1, name)
+		mig.Timestamp = time.Unix(int64(i+1), 0)
+		mig.Up = []Operation{&CreateTable{Name: name[len("create_"):], Columns: []Column{{Name: "id", Type: "INTEGER", IsPK: true}}}}
+		migrator.Add(mig)
+		if _, err := migrator.Up(ctx); err != nil {
+			t.Fatalf("Up() error = %v", err)
+		}
+	}
+
+	data, err := migrator.ExportHistory()
+	if err != nil {
+		t.Fatalf("ExportHistory() error = %v", err)
+	}
+
+	var history []MigrationRecord
+	if err := json.Unmarshal(data, &history); err != nil {
+		t.Fatalf("failed to unmarshal history: %v\n%s", err, data)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 records, got %d:\n%s", len(history), data)
+	}
+
+	applied, err := migrator.ListApplied()
+	if err != nil {
+		t.Fatalf("ListApplied() error = %v", err)
+	}
+	for i, want := range []struct {
+		id, name string
+		batch    int
+	}{
+		{"1_create_a", "create_a", 1},
+		{"2_create_b", "create_b", 2},
+	} {
+		got := history[i]
+		if got.ID != want.id || got.Name != want.name || got.Batch != want.batch {
+			t.Errorf("record %d = %+v, want ID %s, name %s, batch %d", i, got, want.id, want.name, want.batch)
+		}
+		if !got.Timestamp.Equal(time.Unix(int64(i+1), 0)) {
+			t.Errorf("record %d timestamp = %v, want %v", i, got.Timestamp, time.Unix(int64(i+1), 0))
+		}
+		if !got.Applied.Equal(applied[i].Applied) || got.Applied.Location() != time.UTC {
+			t.Errorf("record %d applied = %v, want %v in UTC", i, got.Applied, applied[i].Applied)
+		}
+	}
+
+	if !strings.Contains(string(data), `"id": "1_create_a"`) {
+		t.Errorf("expected lowercase JSON keys, got:\n%s", data)
+	}
+}
+
+func TestRunSQL(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	migrator := NewMigrator(db)
+
+	err := migrator.RunSQL(ctx, "CREATE TABLE audit (id INTEGER PRIMARY KEY)", "DROP TABLE audit")
+	if err != nil {
+		t.Fatalf("RunSQL() error = %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO audit (id) VALUES (1)"); err != nil {
+		t.Fatalf("expected audit table to exist: %v", err)
+	}
+
+	applied, err := migrator.ListApplied()
+	if err != nil {
+		t.Fatalf("ListApplied() error = %v", err)
+	}
+	if len(applied) != 1 || applied[0].Name != "run_sql" || !strings.HasSuffix(applied[0].ID, "_run_sql") {
+		t.Fatalf("expected a run_sql migration record, got %+v", applied)
+	}
+
+	if _, err := migrator.Down(ctx); err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+	if _, err := db.Exec("SELECT 1 FROM audit"); err == nil {
+		t.Error("expected Down to drop the audit table")
+	}
+	if applied, _ := migrator.ListApplied(); len(applied) != 0 {
+		t.Errorf("expected no applied migrations after Down, got %+v", applied)
+	}
+
+	if err := migrator.RunSQL(ctx, "CREATE TABLE broken (", ""); err == nil {
+		t.Fatal("expected RunSQL to fail for invalid SQL")
+	}
+	if pending, _ := migrator.ListPending(); len(pending) != 1 {
+		t.Errorf("expected only the rolled back migration to be pending, got %v", pending)
+	}
+}
+
+func TestSkipIf(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, migrated INTEGER NOT NULL DEFAULT 0)"); err != nil {
+		t.Fatalf("failed to create users: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO users (id, migrated) VALUES (1, 0)"); err != nil {
+		t.Fatalf("failed to insert user: %v", err)
+	}
+
+	backfill := NewMigration("backfill_users")
+	backfill.SkipIf = "SELECT 1 FROM users WHERE migrated = 1"
+	backfill.Up = []Operation{&CustomSQL{Query: "INSERT INTO users (id, migrated) VALUES (2, 1)"}}
+
+	for _, useTx := range []bool{true, false} {
+		migrator := NewMigrator(db)
+		migrator.Add(backfill)
+
+		if _, err := db.Exec("UPDATE users SET migrated = 1 WHERE id = 1"); err != nil {
+			t.Fatalf("failed to mark user migrated: %v", err)
+		}
+		result, err := migrator.UpWithBatch(ctx, useTx)
+		if err != nil {
+			t.Fatalf("UpWithBatch(%v) error = %v", useTx, err)
+		}
+		if !reflect.DeepEqual(result.Skipped, []string{backfill.ID}) || len(result.Applied) != 0 {
+			t.Errorf("expected the migration to be skipped, got %+v", result)
+		}
+
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil || count != 1 {
+			t.Errorf("expected the skipped migration not to run, got %d users (%v)", count, err)
+		}
+		if applied, _ := migrator.ListApplied(); len(applied) != 0 {
+			t.Errorf("expected the skipped migration not to be recorded, got %+v", applied)
+		}
+
+		if _, err := db.Exec("UPDATE users SET migrated = 0"); err != nil {
+			t.Fatalf("failed to reset users: %v", err)
+		}
+	}
+
+	migrator := NewMigrator(db)
+	migrator.Add(backfill)
+	result, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if !reflect.DeepEqual(result.Applied, []string{backfill.ID}) || len(result.Skipped) != 0 {
+		t.Errorf("expected the migration to be applied once the condition no longer holds, got %+v", result)
+	}
+
+	broken := NewMigration("broken_skip_if")
+	broken.SkipIf = "SELECT FROM missing_table"
+	migrator.Add(broken)
+	if _, err := migrator.Up(ctx); err == nil {
+		t.Error("expected an invalid SkipIf query to fail the run")
+	}
+}
+
+// captureLogger records the lines logged through it
+type captureLogger struct {
+	lines []string
+}
+
+func (l *captureLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestWithLogger(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	logger := &captureLogger{}
+	migrator := NewMigrator(db).WithLogger(logger)
+
+	mig := NewMigration("create_users")
+	mig.Up = []Operation{&CreateTable{Name: "users", Columns: []Column{{Name: "id", Type: "INTEGER", IsPK: true}}}}
+	mig.Down = []Operation{&DropTable{Name: "users"}}
+	migrator.Add(mig)
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if _, err := migrator.Down(ctx); err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+
+	duration := `\[[0-9.]+[nµm]?s\]`
+	for _, pattern := range []string{
+		`(?s)^CREATE TABLE users \(.*\) \[\] ` + duration + `$`,
+		`(?s)^\s*INSERT INTO migrations .* \[` + regexp.QuoteMeta(mig.ID) + ` create_users .*\] ` + duration + `$`,
+		`^Applying create_users ` + duration + `$`,
+		`^DROP TABLE users \[\] ` + duration + `$`,
+		`^Rolling back create_users ` + duration + `$`,
+	} {
+		re := regexp.MustCompile(pattern)
+		found := false
+		for _, line := range logger.lines {
+			if re.MatchString(line) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("expected a logged line matching %s, got %q", pattern, logger.lines)
+		}
+	}
+
+	failing := NewMigration("broken")
+	failing.Up = []Operation{&CustomSQL{Query: "SELECT FROM missing_table"}}
+	migrator.Add(failing)
+	if _, err := migrator.Up(ctx); err == nil {
+		t.Fatal("expected Up() to fail")
+	}
+	errorLines := 0
+	for _, line := range logger.lines {
+		if strings.Contains(line, "error:") {
+			errorLines++
+		}
+	}
+	if errorLines != 2 {
+		t.Errorf("expected the failing statement and migration to be logged with their error, got %q", logger.lines)
+	}
+}
+
+func TestSetTableName(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	migrator := NewMigrator(db)
+	migrator.SetTableName("schema_history")
+
+	pending := NewMigration("create_teams")
+	pending.Up = []Operation{&CreateTable{Name: "teams", Columns: []Column{{Name: "id", Type: "INTEGER", IsPK: true}}}}
+	migrator.Add(pending)
+
+	mig := NewMigration("create_users")
+	mig.Up = []Operation{&CreateTable{Name: "users", Columns: []Column{{Name: "id", Type: "INTEGER", IsPK: true}}}}
+	mig.Down = []Operation{&DropTable{Name: "users"}}
+	result, err := migrator.Apply(ctx, mig)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if !reflect.DeepEqual(result.Applied, []string{mig.ID}) {
+		t.Errorf("expected only the applied migration to run, got %+v", result)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_history WHERE id = ?", mig.ID).Scan(&count); err != nil || count != 1 {
+		t.Errorf("expected the migration to be recorded in schema_history, got %d (%v)", count, err)
+	}
+	if _, err := db.Exec("SELECT 1 FROM migrations"); err == nil {
+		t.Error("expected the default migrations table not to be created")
+	}
+
+	schema, err := migrator.ExportSchema(ctx)
+	if err != nil {
+		t.Fatalf("ExportSchema() error = %v", err)
+	}
+	if strings.Contains(schema, "schema_history") {
+		t.Errorf("expected the migrations table to be left out of the schema, got %q", schema)
+	}
+
+	if pending, err := migrator.ListPending(); err != nil || len(pending) != 1 {
+		t.Errorf("ListPending() = %v, %v, want create_teams", pending, err)
+	}
+	migrator.SetTableName("")
+	if got := migrator.TableName(); got != DefaultTableName {
+		t.Errorf("TableName() = %q, want %q", got, DefaultTableName)
+	}
+}
+
+func TestMarkSquashed(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	migrator := NewMigrator(db)
+
+	var ids []string
+	for i, name := range []string{"create_a", "create_b", "create_c"} {
+		mig := NewMigration(name)
+		mig.ID = fmt.Sprintf("%d_%s", i+1, name)
+		mig.Timestamp = time.Unix(int64(i+1), 0)
+		mig.Up = []Operation{&CreateTable{Name: name[len("create_"):], Columns: []Column{{Name: "id", Type: "INTEGER", IsPK: true}}}}
+		migrator.Add(mig)
+		ids = append(ids, mig.ID)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	squashed := NewMigration("create_a_b_c")
+	squashed.ID = "3_create_a_b_c"
+	squashed.Timestamp = time.Unix(3, 0)
+	migrator.Add(squashed)
+
+	if err := migrator.MarkSquashed(ids, "missing"); err == nil {
+		t.Error("expected error for an unregistered replacement")
+	}
+	if err := migrator.MarkSquashed([]string{"4_missing"}, squashed.ID); err == nil {
+		t.Error("expected error for a migration that was not applied")
+	}
+	if err := migrator.MarkSquashed(ids, squashed.ID); err != nil {
+		t.Fatalf("MarkSquashed() error = %v", err)
+	}
+
+	status, err := migrator.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if len(status) != 1 || status[0].Migration.ID != squashed.ID || status[0].Applied == nil || status[0].Batch != 1 {
+		t.Errorf("Status() = %+v, want only %s, applied in batch 1", status, squashed.ID)
+	}
+
+	// Neither the squashed migrations nor their replacement run again
+	result, err := migrator.Up(ctx)
+	if err != nil || len(result.Applied) != 0 {
+		t.Errorf("Up() = %+v, %v, want nothing applied", result, err)
+	}
+	if pending, err := migrator.ListPending(); err != nil || len(pending) != 0 {
+		t.Errorf("ListPending() = %v, %v, want none", pending, err)
+	}
+	if version, err := migrator.Version(); err != nil || version != squashed.ID {
+		t.Errorf("Version() = %q, %v, want %s", version, err, squashed.ID)
+	}
+}
+
+func TestInitializeAddsSquashedBy(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// A migrations table from before squashing was supported
+	if _, err := db.Exec(`CREATE TABLE migrations (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		timestamp INTEGER NOT NULL,
+		applied INTEGER NOT NULL,
+		batch INTEGER NOT NULL DEFAULT 1
+	)`); err != nil {
+		t.Fatalf("failed to create migrations table: %v", err)
+	}
+
+	migrator := NewMigrator(db)
+	for i := 0; i < 2; i++ {
+		if err := migrator.Initialize(context.Background()); err != nil {
+			t.Fatalf("Initialize() error = %v", err)
+		}
+	}
+	if _, err := db.Exec("SELECT squashed_by FROM migrations"); err != nil {
+		t.Errorf("expected squashed_by column to be added, got %v", err)
+	}
+}
+
+// advisoryLocks records the advisory lock calls made through the
+// sqlite3_pg driver
+var advisoryLocks []string
+
+func init() {
+	// sqlite3_pg provides no-op stand-ins for the PostgreSQL functions the
+	// migrator calls, so PostgreSQL statements can run on SQLite
+	sql.Register("sqlite3_pg", &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("hashtext", func(s string) int64 { return int64(len(s)) }, true); err != nil {
+				return err
+			}
+			for _, name := range []string{"pg_advisory_lock", "pg_advisory_unlock"} {
+				name := name
+				lock := func(key int64) int64 {
+					advisoryLocks = append(advisoryLocks, name)
+					return 1
+				}
+				if err := conn.RegisterFunc(name, lock, false); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+func TestPostgresPlaceholders(t *testing.T) {
+	db, err := sql.Open("sqlite3_pg", filepath.Join(t.TempDir(), "pg.db"))
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer db.Close()
+	advisoryLocks = nil
+
+	// SQLite accepts $N placeholders too, so the PostgreSQL statements run
+	logger := &captureLogger{}
+	migrator := NewMigrator(db).WithLogger(logger)
+	migrator.SetDialect(DialectPostgres)
+
+	mig := NewMigration("create_notes")
+	mig.Up = []Operation{&CustomSQL{Query: "CREATE TABLE notes (body TEXT DEFAULT '?')"}}
+	mig.Down = []Operation{&CustomSQL{Query: "DROP TABLE notes"}}
+	migrator.Add(mig)
+
+	ctx := context.Background()
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if _, err := migrator.Down(ctx); err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+
+	logged := strings.Join(logger.lines, "\n")
+	for _, want := range []string{
+		"VALUES ($1, $2, $3, $4, $5)",
+		"DELETE FROM migrations WHERE id = $1",
+		"DEFAULT '?'",
+	} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("expected %q to be logged, got:\n%s", want, logged)
+		}
+	}
+
+	// Up and Down each hold the advisory lock while they run
+	want := []string{"pg_advisory_lock", "pg_advisory_unlock", "pg_advisory_lock", "pg_advisory_unlock"}
+	if !reflect.DeepEqual(advisoryLocks, want) {
+		t.Errorf("advisory lock calls = %v, want %v", advisoryLocks, want)
+	}
+}
+
+func TestLockName(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	long := NewMigrator(db)
+	long.SetTableName(strings.Repeat("m", 100))
+	if name := long.lockName(); len(name) != 64 {
+		t.Errorf("lockName() has %d characters, want 64", len(name))
+	}
+}
+
+func TestLockSingleConnection(t *testing.T) {
+	db, err := sql.Open("sqlite3_pg", filepath.Join(t.TempDir(), "pg.db"))
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer db.Close()
+	// The migration must run on the connection holding the lock rather
+	// than wait for a second one
+	db.SetMaxOpenConns(1)
+
+	migrator := NewMigrator(db)
+	migrator.SetDialect(DialectPostgres)
+	mig := NewMigration("create_notes")
+	mig.Up = []Operation{&CustomSQL{Query: "CREATE TABLE notes (body TEXT)"}}
+	mig.Down = []Operation{&CustomSQL{Query: "DROP TABLE notes"}}
+	migrator.Add(mig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if _, err := migrator.Down(ctx); err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ExportSchema returns a CREATE TABLE statement for every table in the live
+// database, sorted by table name, one statement per line. Whitespace is
+// normalized so the output is stable enough to commit to version control.
+// The table migrations are recorded in is left out. SQLite statements come
+// from sqlite_master; PostgreSQL and MySQL ones are built from
+// information_schema.
+func (m *Migrator) ExportSchema(ctx context.Context) (string, error) {
+	var statements []string
+	var err error
+	switch dialect := m.Dialect(); dialect {
+	case DialectSQLite:
+		statements, err = m.sqliteSchema(ctx)
+	case DialectMySQL:
+		statements, err = m.informationSchema(ctx, dialect, "DATABASE()")
+	default:
+		statements, err = m.informationSchema(ctx, dialect, "current_schema()")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to export schema: %w", err)
+	}
+
+	var out strings.Builder
+	for _, statement := range statements {
+		out.WriteString(statement)
+		out.WriteString(";\n")
+	}
+	return out.String(), nil
+}
+
+// sqliteSchema returns the stored CREATE TABLE statements of a SQLite
+// database
+func (m *Migrator) sqliteSchema(ctx context.Context) ([]string, error) {
+	rows, err := m.conn().QueryContext(ctx, `
+		SELECT sql FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name <> ?
+		ORDER BY name
+	`, m.table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statements []string
+	for rows.Next() {
+		var sql string
+		if err := rows.Scan(&sql); err != nil {
+			return nil, err
+		}
+		statements = append(statements, normalizeSQL(sql))
+	}
+	return statements, rows.Err()
+}
+
+// informationSchema builds CREATE TABLE statements from the column
+// definitions in information_schema, for the tables of the schema returned
+// by the schema SQL function
+func (m *Migrator) informationSchema(ctx context.Context, dialect, schema string) ([]string, error) {
+	rows, err := m.conn().QueryContext(ctx, rebind(`
+		SELECT table_name, column_name, data_type, is_nullable
+		FROM information_schema.columns
+		WHERE table_schema = `+schema+` AND table_name <> ?
+		ORDER BY table_name, ordinal_position
+	`, dialect), m.table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	columns := make(map[string][]string)
+	for rows.Next() {
+		var table, column, dataType, nullable string
+		if err := rows.Scan(&table, &column, &dataType, &nullable); err != nil {
+			return nil, err
+		}
+		def := column + " " + strings.ToUpper(dataType)
+		if nullable == "NO" {
+			def += " NOT NULL"
+		}
+		if _, ok := columns[table]; !ok {
+			tables = append(tables, table)
+		}
+		columns[table] = append(columns[table], def)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statements := make([]string, 0, len(tables))
+	for _, table := range tables {
+		statements = append(statements, fmt.Sprintf("CREATE TABLE %s (%s)", table, strings.Join(columns[table], ", ")))
+	}
+	return statements, nil
+}
+
+// normalizeSQL collapses runs of whitespace into single spaces and removes
+// spaces just inside parentheses
+func normalizeSQL(sql string) string {
+	sql = strings.Join(strings.Fields(sql), " ")
+	sql = strings.ReplaceAll(sql, "( ", "(")
+	return strings.ReplaceAll(sql, " )", ")")
+}
@@ -0,0 +1,49 @@
+package migration
+
+import (
+	"context"
+	"testing"
+)
+
+func TestExportSchema(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	migrator := NewMigrator(db)
+
+	mig := NewMigration("create_tables")
+	mig.Up = []Operation{
+		&CreateTable{Name: "users", Columns: []Column{
+			{Name: "id", Type: "INTEGER", IsPK: true, IsAuto: true},
+			{Name: "email", Type: "TEXT", IsUnique: true},
+		}},
+		&CreateTable{Name: "accounts", Columns: []Column{
+			{Name: "id", Type: "INTEGER", IsPK: true},
+			{Name: "name", Type: "TEXT", IsNull: true},
+		}},
+	}
+	migrator.Add(mig)
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	schema, err := migrator.ExportSchema(ctx)
+	if err != nil {
+		t.Fatalf("ExportSchema() error = %v", err)
+	}
+
+	want := "CREATE TABLE accounts (id INTEGER PRIMARY KEY, name TEXT);\n" +
+		"CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT NOT NULL UNIQUE);\n"
+	if schema != want {
+		t.Errorf("ExportSchema() =\n%s\nwant\n%s", schema, want)
+	}
+
+	again, err := migrator.ExportSchema(ctx)
+	if err != nil {
+		t.Fatalf("ExportSchema() error = %v", err)
+	}
+	if again != schema {
+		t.Error("ExportSchema() is not deterministic")
+	}
+}
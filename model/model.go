@@ -1,8 +1,13 @@
 package model
 
 import (
+	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 	"unicode"
 )
 
@@ -14,20 +19,68 @@ type Model interface {
 
 // Metadata holds the model's metadata information
 type Metadata struct {
-	TableName string
-	Fields    []Field
+	TableName     string
+	Fields        []Field
+	Indexes       []Index
+	Relationships []Relationship
+
+	// Field lookup maps, built on first use by FieldByDBName and FieldByName
+	fieldsMu      sync.Mutex
+	fieldsIndexed atomic.Bool
+	byDBName      map[string]*Field
+	byName        map[string]*Field
+}
+
+// Relationship kinds
+const (
+	HasMany    = "has_many"
+	ManyToMany = "many2many"
+)
+
+// Relationship describes a field holding associated models, such as
+// Posts []Post. Relationship fields are not columns of the model's table.
+type Relationship struct {
+	Name string       // Name of the struct field
+	Kind string       // HasMany or ManyToMany
+	Type reflect.Type // Struct type of the associated models
+
+	// ForeignKey is the column referencing the owner: on the associated
+	// table for HasMany, on the join table for ManyToMany
+	ForeignKey string
+	// References is the owner column the foreign key points to
+	References string
+
+	// JoinTable and JoinForeignKey describe the join table of a ManyToMany
+	// relationship. JoinForeignKey references the associated model.
+	JoinTable      string
+	JoinForeignKey string
+}
+
+// Index represents an index declared on a model via the theory_index tag
+type Index struct {
+	Name     string
+	Columns  []string
+	IsUnique bool
+	Where    string // Condition of a partial index, set via the partial= option
 }
 
 // Field represents a model field's metadata
 type Field struct {
-	Name       string
-	DBName     string
-	Type       reflect.Type
-	IsPK       bool
-	IsAuto     bool
-	IsNull     bool
-	MaxLength  int
-	IsPKHandled bool // Internal flag to track if PK is handled by Model interface
+	Name         string
+	DBName       string
+	Type         reflect.Type
+	IsPK         bool
+	IsAuto       bool
+	IsNull       bool
+	IsUnique     bool
+	MaxLength    int
+	TypeOverride string // Column type set via the type= tag option
+	PKStrategy   string // Primary key strategy set via the strategy= tag option
+	Generated    string // Expression computing the column, set via the generated= tag option
+	IsStored     bool   // Whether a generated column is stored rather than virtual
+	Precision    int    // Total digits of a DECIMAL column, set via the precision=p,s tag option
+	Scale        int    // Digits after the decimal point of a DECIMAL column
+	IsPKHandled  bool   // Internal flag to track if PK is handled by Model interface
 }
 
 // MetadataProvider is an interface that models can implement to provide their own metadata
@@ -35,12 +88,35 @@ type MetadataProvider interface {
 	ExtractMetadata() (*Metadata, error)
 }
 
-// ExtractMetadata extracts metadata from a model struct using reflection
+// ExtractMetadata extracts metadata from a model struct using reflection,
+// naming tables and columns with the strategy set by SetNamingStrategy
 func ExtractMetadata(m interface{}) (*Metadata, error) {
+	return ExtractMetadataWith(m, nil)
+}
+
+// ExtractMetadataWith extracts metadata like ExtractMetadata, naming tables
+// and columns with the given strategy. A nil strategy uses the one set by
+// SetNamingStrategy.
+func ExtractMetadataWith(m interface{}, strategy NamingStrategy) (*Metadata, error) {
 	if m == nil {
 		return nil, &Error{Message: "nil model provided"}
 	}
 
+	v := reflect.ValueOf(m)
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, &Error{Message: "nil model pointer provided"}
+		}
+	case reflect.Struct:
+		// Work on a pointer so methods with pointer receivers are found
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		m = ptr.Interface()
+	case reflect.Slice, reflect.Array:
+		return nil, &Error{Message: fmt.Sprintf("model must be a struct, got %s; pass a single struct instead", v.Type())}
+	}
+
 	// First check if the model implements MetadataProvider
 	if provider, ok := m.(MetadataProvider); ok {
 		return provider.ExtractMetadata()
@@ -55,8 +131,12 @@ func ExtractMetadata(m interface{}) (*Metadata, error) {
 		return nil, ErrNotAStruct
 	}
 
+	if strategy == nil {
+		strategy = naming()
+	}
+
 	metadata := &Metadata{
-		TableName: getTableName(t, m),
+		TableName: getTableName(t, m, strategy),
 		Fields:    make([]Field, 0),
 	}
 
@@ -83,16 +163,46 @@ func ExtractMetadata(m interface{}) (*Metadata, error) {
 			continue
 		}
 
+		if rel, ok := parseRelationship(field, t); ok {
+			metadata.Relationships = append(metadata.Relationships, rel)
+			continue
+		}
+
 		f := Field{
 			Name:   field.Name,
-			DBName: getDBFieldName(field),
+			DBName: getDBFieldName(field, strategy),
 			Type:   field.Type,
 		}
 
 		// Parse db tag options
 		if dbTag != "" {
-			parts := strings.Split(dbTag, ",")
-			for _, part := range parts[1:] { // Skip the first part (field name)
+			parts := splitTagOptions(dbTag)
+			for i := 1; i < len(parts); i++ { // Skip the first part (field name)
+				part := parts[i]
+				if strings.HasPrefix(part, "type=") {
+					f.TypeOverride = strings.TrimPrefix(part, "type=")
+					continue
+				}
+				if strings.HasPrefix(part, "strategy=") {
+					f.PKStrategy = strings.TrimPrefix(part, "strategy=")
+					continue
+				}
+				if strings.HasPrefix(part, "precision=") {
+					// The scale follows as the next option, as in precision=10,2
+					f.Precision, _ = strconv.Atoi(strings.TrimPrefix(part, "precision="))
+					if i+1 < len(parts) {
+						if scale, err := strconv.Atoi(parts[i+1]); err == nil {
+							f.Scale = scale
+							i++
+						}
+					}
+					continue
+				}
+				if strings.HasPrefix(part, "generated=") {
+					f.Generated = trimParens(strings.TrimPrefix(part, "generated="))
+					continue
+				}
+
 				switch part {
 				case "pk":
 					// If primary key is already handled, do not set IsPK to true
@@ -103,16 +213,90 @@ func ExtractMetadata(m interface{}) (*Metadata, error) {
 					f.IsAuto = true
 				case "null":
 					f.IsNull = true
+				case "unique":
+					f.IsUnique = true
+				case "stored":
+					f.IsStored = true
 				}
 			}
 		}
 
 		metadata.Fields = append(metadata.Fields, f)
+
+		if indexTag := field.Tag.Get("theory_index"); indexTag != "" {
+			metadata.Indexes = append(metadata.Indexes, parseIndexTag(indexTag, f.DBName)...)
+		}
+	}
+
+	// Foreign keys point to the owner's primary key
+	references := "id"
+	if pk := metadata.PrimaryKey(); pk != nil {
+		references = pk.DBName
+	}
+	for i := range metadata.Relationships {
+		if metadata.Relationships[i].References == "" {
+			metadata.Relationships[i].References = references
+		}
 	}
 
 	return metadata, nil
 }
 
+// parseRelationship detects relationship fields: slices of structs or struct
+// pointers. A theory:"many2many:join_table" tag makes the relationship
+// many-to-many; otherwise it is has-many, which a theory:"has_many:Type" tag
+// states explicitly. Foreign keys follow the <type>_id convention, e.g.
+// user_id for a User owner, and reference the owner's primary key; the
+// foreign_key:column and references:column options override them.
+func parseRelationship(field reflect.StructField, owner reflect.Type) (Relationship, bool) {
+	if field.Type.Kind() != reflect.Slice {
+		return Relationship{}, false
+	}
+	elem := field.Type.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct || elem == reflect.TypeOf(time.Time{}) {
+		return Relationship{}, false
+	}
+
+	rel := Relationship{
+		Name:       field.Name,
+		Kind:       HasMany,
+		Type:       elem,
+		ForeignKey: toSnakeCase(owner.Name()) + "_id",
+	}
+
+	for _, option := range strings.Split(field.Tag.Get("theory"), ",") {
+		switch {
+		case strings.HasPrefix(option, "many2many:"):
+			rel.Kind = ManyToMany
+			rel.JoinTable = strings.TrimPrefix(option, "many2many:")
+			if rel.JoinForeignKey == "" {
+				rel.JoinForeignKey = toSnakeCase(elem.Name()) + "_id"
+			}
+		case strings.HasPrefix(option, "has_many:"):
+			rel.Kind = HasMany
+		case strings.HasPrefix(option, "foreign_key:"):
+			rel.ForeignKey = strings.TrimPrefix(option, "foreign_key:")
+		case strings.HasPrefix(option, "references:"):
+			rel.References = strings.TrimPrefix(option, "references:")
+		}
+	}
+
+	return rel, true
+}
+
+// Relationship returns the relationship held by the named struct field
+func (m *Metadata) Relationship(name string) (*Relationship, bool) {
+	for i := range m.Relationships {
+		if m.Relationships[i].Name == name {
+			return &m.Relationships[i], true
+		}
+	}
+	return nil, false
+}
+
 // Helper function to check if a field name already exists in the fields slice
 func containsField(fields []Field, name string) bool {
 	for _, f := range fields {
@@ -133,6 +317,87 @@ func containsPKHandledField(fields []Field, name string) bool {
 	return false
 }
 
+// splitTagOptions splits a db tag on commas, keeping commas inside
+// parentheses so types like DECIMAL(10,2) stay intact
+func splitTagOptions(tag string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range tag {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, tag[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, tag[start:])
+}
+
+// trimParens removes parentheses enclosing the whole of s, so a generated
+// expression may be written either as generated=a+b or generated=(a, b)
+func trimParens(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return s
+	}
+	depth := 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			// The opening parenthesis closes before the end, as in (a) + (b)
+			if depth == 0 && i < len(s)-1 {
+				return s
+			}
+		}
+	}
+	return s[1 : len(s)-1]
+}
+
+// parseIndexTag parses a theory_index tag of the form
+// "idx_name,col1,col2,unique,partial=condition". Several indexes can be
+// separated by ";". An index without columns covers the tagged field's
+// column. A partial index only covers the rows matching its condition.
+func parseIndexTag(tag string, column string) []Index {
+	var indexes []Index
+	for _, def := range strings.Split(tag, ";") {
+		parts := splitTagOptions(def)
+		name := strings.TrimSpace(parts[0])
+		if name == "" {
+			continue
+		}
+
+		idx := Index{Name: name}
+		for _, part := range parts[1:] {
+			part = strings.TrimSpace(part)
+			switch {
+			case part == "":
+			case part == "unique":
+				idx.IsUnique = true
+			case strings.HasPrefix(part, "partial="):
+				idx.Where = strings.TrimSpace(strings.TrimPrefix(part, "partial="))
+			default:
+				idx.Columns = append(idx.Columns, part)
+			}
+		}
+		if len(idx.Columns) == 0 {
+			idx.Columns = []string{column}
+		}
+
+		indexes = append(indexes, idx)
+	}
+	return indexes
+}
+
 // PrimaryKey returns the primary key field of the model, if any
 func (m *Metadata) PrimaryKey() *Field {
 	for _, field := range m.Fields {
@@ -143,15 +408,167 @@ func (m *Metadata) PrimaryKey() *Field {
 	return nil
 }
 
+// FieldByDBName returns the field stored in the given column
+func (m *Metadata) FieldByDBName(name string) (*Field, bool) {
+	m.indexFields()
+	field, ok := m.byDBName[name]
+	return field, ok
+}
+
+// FieldByName returns the field with the given struct field name
+func (m *Metadata) FieldByName(name string) (*Field, bool) {
+	m.indexFields()
+	field, ok := m.byName[name]
+	return field, ok
+}
+
+// indexFields builds the field lookup maps once. Fields must not be changed
+// after the first lookup.
+func (m *Metadata) indexFields() {
+	if m.fieldsIndexed.Load() {
+		return
+	}
+
+	m.fieldsMu.Lock()
+	defer m.fieldsMu.Unlock()
+	if m.fieldsIndexed.Load() {
+		return
+	}
+
+	m.byDBName = make(map[string]*Field, len(m.Fields))
+	m.byName = make(map[string]*Field, len(m.Fields))
+	for i := range m.Fields {
+		m.byDBName[m.Fields[i].DBName] = &m.Fields[i]
+		m.byName[m.Fields[i].Name] = &m.Fields[i]
+	}
+	m.fieldsIndexed.Store(true)
+}
+
+// IsJSON reports whether the field is stored as JSON. Fields of interface
+// type, such as interface{} or any, hold values of any type and are encoded
+// as JSON text.
+func (f *Field) IsJSON() bool {
+	return f.Type != nil && f.Type.Kind() == reflect.Interface
+}
+
+// IsSoftDelete reports whether the field marks soft-deleted records. Models
+// opt into soft deletes with a DeletedAt field of type *time.Time.
+func (f *Field) IsSoftDelete() bool {
+	return f.Name == "DeletedAt" && f.Type == reflect.TypeOf((*time.Time)(nil))
+}
+
+// SoftDeleteField returns the soft delete field of the model, if any
+func (m *Metadata) SoftDeleteField() *Field {
+	for i := range m.Fields {
+		if m.Fields[i].IsSoftDelete() {
+			return &m.Fields[i]
+		}
+	}
+	return nil
+}
+
+// SqlType converts a Go type to SQL type
+func SqlType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "INTEGER"
+	case reflect.Float32, reflect.Float64:
+		return "REAL"
+	case reflect.String:
+		return "TEXT"
+	case reflect.Bool:
+		return "INTEGER"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "BLOB"
+		}
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return "INTEGER" // Store as Unix timestamp
+		}
+	case reflect.Interface:
+		return "TEXT" // Store as JSON
+	}
+	return "TEXT"
+}
+
+// ColumnType returns the column type of the field: its type= override, or
+// the type mapped from its Go type. Soft delete fields hold a DATETIME and
+// fields with a precision a DECIMAL, whose parameters are added by
+// migrations.
+func (f *Field) ColumnType() string {
+	switch {
+	case f.TypeOverride != "":
+		return f.TypeOverride
+	case f.Precision > 0:
+		return "DECIMAL"
+	case f.IsSoftDelete():
+		return "DATETIME"
+	}
+	return SqlType(f.Type)
+}
+
+// Nullable reports whether the field's column accepts NULL. Besides fields
+// tagged null, records that are not deleted have no deletion time and a nil
+// interface field is stored as NULL.
+func (f *Field) Nullable() bool {
+	return f.IsNull || f.IsSoftDelete() || f.IsJSON()
+}
+
+// UsesPKStrategy reports whether the field's value is generated by the
+// application before inserting rather than by the database. This is the case
+// for auto fields that are strings, such as UUIDs, or that name a strategy.
+func (f *Field) UsesPKStrategy() bool {
+	return f.IsAuto && (f.Type.Kind() == reflect.String || f.PKStrategy != "")
+}
+
+// IsGenerated reports whether the database computes the field's column from
+// an expression. Generated columns are read but never written.
+func (f *Field) IsGenerated() bool {
+	return f.Generated != ""
+}
+
+// String returns the table name and its columns, one per line, as in
+// "Table: users\n  id INTEGER PK AUTO\n  email TEXT NULL UNIQUE"
+func (m *Metadata) String() string {
+	var b strings.Builder
+	b.WriteString("Table: ")
+	b.WriteString(m.TableName)
+	for i := range m.Fields {
+		f := &m.Fields[i]
+		b.WriteString("\n  ")
+		b.WriteString(f.DBName)
+		b.WriteString(" ")
+		b.WriteString(f.ColumnType())
+		if f.IsPK {
+			b.WriteString(" PK")
+		}
+		if f.IsAuto {
+			b.WriteString(" AUTO")
+		}
+		if f.Nullable() {
+			b.WriteString(" NULL")
+		}
+		if f.IsUnique {
+			b.WriteString(" UNIQUE")
+		}
+	}
+	return b.String()
+}
+
 // getTableName extracts the table name from the model type
-func getTableName(t reflect.Type, m interface{}) string {
+func getTableName(t reflect.Type, m interface{}, strategy NamingStrategy) string {
 	// First check if the model implements Model interface
 	if model, ok := m.(Model); ok {
 		return model.TableName()
 	}
 
-	// Convert CamelCase to snake_case
-	name := t.Name()
+	return strategy.TableName(t.Name())
+}
+
+// toSnakeCase converts a CamelCase name to snake_case
+func toSnakeCase(name string) string {
 	var result strings.Builder
 	for i, r := range name {
 		if i > 0 && 'A' <= r && r <= 'Z' {
@@ -159,24 +576,14 @@ func getTableName(t reflect.Type, m interface{}) string {
 		}
 		result.WriteByte(byte(unicode.ToLower(r)))
 	}
-	
 	return result.String()
 }
 
 // getDBFieldName extracts the database field name from struct field
-func getDBFieldName(field reflect.StructField) string {
+func getDBFieldName(field reflect.StructField, strategy NamingStrategy) string {
 	dbTag := field.Tag.Get("db")
 	if dbTag == "" {
-		// Convert field name to snake_case
-		var result strings.Builder
-		name := field.Name
-		for i, r := range name {
-			if i > 0 && 'A' <= r && r <= 'Z' {
-				result.WriteByte('_')
-			}
-			result.WriteByte(byte(unicode.ToLower(r)))
-		}
-		return result.String()
+		return strategy.ColumnName(field.Name)
 	}
 
 	parts := strings.Split(dbTag, ",")
@@ -2,7 +2,11 @@ package model
 
 import (
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // Mock structs for testing
@@ -218,3 +222,489 @@ func TestTableName(t *testing.T) {
 		})
 	}
 }
+
+type UserWithIndexes struct {
+	ID        int    `db:"id,pk,auto"`
+	FirstName string `db:"first_name" theory_index:"idx_users_full_name,first_name,last_name,unique"`
+	LastName  string `db:"last_name"`
+	Email     string `db:"email" theory_index:"idx_users_email;idx_users_email_name,email,first_name"`
+	Status    string `db:"status" theory_index:"idx_users_active,email,unique,partial=status IN ('active', 'trial')"`
+}
+
+func TestExtractMetadataIndexes(t *testing.T) {
+	metadata, err := ExtractMetadata(&UserWithIndexes{})
+	if err != nil {
+		t.Fatalf("ExtractMetadata() error = %v", err)
+	}
+
+	want := []Index{
+		{Name: "idx_users_full_name", Columns: []string{"first_name", "last_name"}, IsUnique: true},
+		{Name: "idx_users_email", Columns: []string{"email"}},
+		{Name: "idx_users_email_name", Columns: []string{"email", "first_name"}},
+		{Name: "idx_users_active", Columns: []string{"email"}, IsUnique: true, Where: "status IN ('active', 'trial')"},
+	}
+
+	if !reflect.DeepEqual(metadata.Indexes, want) {
+		t.Errorf("ExtractMetadata() indexes = %v, want %v", metadata.Indexes, want)
+	}
+}
+
+type UserWithTypeOverrides struct {
+	ID    string  `db:"id,pk,type=CHAR(36)"`
+	Name  string  `db:"name,type=VARCHAR(100)"`
+	Total float64 `db:"total,type=DECIMAL(10,2),null"`
+}
+
+func TestExtractMetadataTypeOverride(t *testing.T) {
+	metadata, err := ExtractMetadata(&UserWithTypeOverrides{})
+	if err != nil {
+		t.Fatalf("ExtractMetadata() error = %v", err)
+	}
+
+	want := []Field{
+		{Name: "ID", DBName: "id", Type: reflect.TypeOf(""), IsPK: true, TypeOverride: "CHAR(36)"},
+		{Name: "Name", DBName: "name", Type: reflect.TypeOf(""), TypeOverride: "VARCHAR(100)"},
+		{Name: "Total", DBName: "total", Type: reflect.TypeOf(0.0), IsNull: true, TypeOverride: "DECIMAL(10,2)"},
+	}
+
+	if !reflect.DeepEqual(metadata.Fields, want) {
+		t.Errorf("ExtractMetadata() fields = %v, want %v", metadata.Fields, want)
+	}
+}
+
+func TestExtractMetadataInputs(t *testing.T) {
+	var nilUser *UserWithTableName
+
+	tests := []struct {
+		name      string
+		model     interface{}
+		wantTable string
+		wantErr   string
+	}{
+		{
+			name:      "pointer",
+			model:     &UserWithTableName{},
+			wantTable: "custom_users",
+		},
+		{
+			name:      "value",
+			model:     UserWithTableName{},
+			wantTable: "custom_users",
+		},
+		{
+			name:      "value with tags",
+			model:     UserWithTags{},
+			wantTable: "user_with_tags",
+		},
+		{
+			name:    "slice of structs",
+			model:   []UserWithTags{},
+			wantErr: "model must be a struct, got []model.UserWithTags; pass a single struct instead",
+		},
+		{
+			name:    "nil pointer",
+			model:   nilUser,
+			wantErr: "nil model pointer provided",
+		},
+		{
+			name:    "non-struct",
+			model:   42,
+			wantErr: ErrNotAStruct.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractMetadata(tt.model)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("ExtractMetadata() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractMetadata() error = %v", err)
+			}
+			if got.TableName != tt.wantTable {
+				t.Errorf("TableName = %v, want %v", got.TableName, tt.wantTable)
+			}
+			if len(got.Fields) != 3 {
+				t.Errorf("got %d fields, want 3", len(got.Fields))
+			}
+		})
+	}
+}
+
+func TestExtractMetadataUnique(t *testing.T) {
+	type UserWithUniqueEmail struct {
+		ID    int    `db:"id,pk,auto"`
+		Email string `db:"email,unique"`
+	}
+
+	metadata, err := ExtractMetadata(&UserWithUniqueEmail{})
+	if err != nil {
+		t.Fatalf("ExtractMetadata() error = %v", err)
+	}
+
+	if metadata.Fields[0].IsUnique {
+		t.Error("expected id not to be unique")
+	}
+	if !metadata.Fields[1].IsUnique {
+		t.Error("expected email to be unique")
+	}
+}
+
+func TestExtractMetadataGenerated(t *testing.T) {
+	type Order struct {
+		ID       int     `db:"id,pk,auto"`
+		Price    float64 `db:"price"`
+		Total    float64 `db:"total,generated=(price * 2),stored"`
+		Rounded  float64 `db:"rounded,generated=round(price, 1)"`
+		Adjusted float64 `db:"adjusted,generated=(price) + (total)"`
+	}
+
+	metadata, err := ExtractMetadata(&Order{})
+	if err != nil {
+		t.Fatalf("ExtractMetadata() error = %v", err)
+	}
+
+	if metadata.Fields[1].IsGenerated() {
+		t.Error("expected price not to be generated")
+	}
+	for i, want := range []struct {
+		expr   string
+		stored bool
+	}{
+		{"price * 2", true},
+		{"round(price, 1)", false},
+		{"(price) + (total)", false},
+	} {
+		f := metadata.Fields[i+2]
+		if !f.IsGenerated() || f.Generated != want.expr || f.IsStored != want.stored {
+			t.Errorf("%s: Generated = %q, IsStored = %v, want %q, %v", f.Name, f.Generated, f.IsStored, want.expr, want.stored)
+		}
+	}
+}
+
+func TestExtractMetadataPrecision(t *testing.T) {
+	type Invoice struct {
+		ID     int     `db:"id,pk,auto"`
+		Amount float64 `db:"amount,precision=10,2,null"`
+		Rate   float64 `db:"rate,precision=5"`
+	}
+
+	metadata, err := ExtractMetadata(&Invoice{})
+	if err != nil {
+		t.Fatalf("ExtractMetadata() error = %v", err)
+	}
+
+	amount, rate := metadata.Fields[1], metadata.Fields[2]
+	if amount.Precision != 10 || amount.Scale != 2 || !amount.IsNull || amount.ColumnType() != "DECIMAL" {
+		t.Errorf("amount = %+v, want DECIMAL with precision 10, scale 2 and null", amount)
+	}
+	if rate.Precision != 5 || rate.Scale != 0 || rate.ColumnType() != "DECIMAL" {
+		t.Errorf("rate = %+v, want DECIMAL with precision 5, scale 0", rate)
+	}
+	if metadata.Fields[0].ColumnType() != "INTEGER" {
+		t.Errorf("id type = %s, want INTEGER", metadata.Fields[0].ColumnType())
+	}
+}
+
+func TestFieldLookup(t *testing.T) {
+	metadata, err := ExtractMetadata(&UserWithTags{})
+	if err != nil {
+		t.Fatalf("ExtractMetadata() error = %v", err)
+	}
+
+	field, ok := metadata.FieldByDBName("email")
+	if !ok || field.Name != "Email" {
+		t.Errorf("FieldByDBName(email) = %v, %v, want Email", field, ok)
+	}
+	field, ok = metadata.FieldByName("ID")
+	if !ok || field.DBName != "id" {
+		t.Errorf("FieldByName(ID) = %v, %v, want id", field, ok)
+	}
+	if field, ok := metadata.FieldByDBName("missing"); ok {
+		t.Errorf("FieldByDBName(missing) = %v, want not found", field)
+	}
+	if field, ok := metadata.FieldByName("email"); ok {
+		t.Errorf("FieldByName(email) = %v, want not found", field)
+	}
+}
+
+func TestFieldLookupConcurrent(t *testing.T) {
+	metadata, err := ExtractMetadata(&UserWithTags{})
+	if err != nil {
+		t.Fatalf("ExtractMetadata() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := metadata.FieldByDBName("name"); !ok {
+				t.Error("FieldByDBName(name) not found")
+			}
+			if _, ok := metadata.FieldByName("Name"); !ok {
+				t.Error("FieldByName(Name) not found")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSoftDeleteField(t *testing.T) {
+	type SoftDeleted struct {
+		ID        int        `db:"id,pk,auto"`
+		DeletedAt *time.Time `db:"deleted_at"`
+	}
+	type WrongType struct {
+		ID        int    `db:"id,pk,auto"`
+		DeletedAt string `db:"deleted_at"`
+	}
+
+	metadata, err := ExtractMetadata(&SoftDeleted{})
+	if err != nil {
+		t.Fatalf("ExtractMetadata() error = %v", err)
+	}
+	if field := metadata.SoftDeleteField(); field == nil || field.DBName != "deleted_at" {
+		t.Errorf("SoftDeleteField() = %v, want deleted_at", field)
+	}
+
+	metadata, err = ExtractMetadata(&WrongType{})
+	if err != nil {
+		t.Fatalf("ExtractMetadata() error = %v", err)
+	}
+	if field := metadata.SoftDeleteField(); field != nil {
+		t.Errorf("SoftDeleteField() = %v, want nil", field)
+	}
+}
+
+func TestExtractMetadataRelationships(t *testing.T) {
+	type Post struct {
+		ID int `db:"id,pk,auto"`
+	}
+	type Role struct {
+		ID int `db:"id,pk,auto"`
+	}
+	type Author struct {
+		ID    int     `db:"author_id,pk,auto"`
+		Posts []Post
+		Roles []*Role `theory:"many2many:author_roles"`
+	}
+
+	metadata, err := ExtractMetadata(&Author{})
+	if err != nil {
+		t.Fatalf("ExtractMetadata() error = %v", err)
+	}
+
+	if len(metadata.Fields) != 1 {
+		t.Errorf("expected relationship fields not to be columns, got %d fields", len(metadata.Fields))
+	}
+
+	want := []Relationship{
+		{Name: "Posts", Kind: HasMany, Type: reflect.TypeOf(Post{}), ForeignKey: "author_id", References: "author_id"},
+		{Name: "Roles", Kind: ManyToMany, Type: reflect.TypeOf(Role{}), ForeignKey: "author_id", References: "author_id", JoinTable: "author_roles", JoinForeignKey: "role_id"},
+	}
+	if !reflect.DeepEqual(metadata.Relationships, want) {
+		t.Errorf("Relationships = %+v, want %+v", metadata.Relationships, want)
+	}
+
+	if _, ok := metadata.Relationship("Missing"); ok {
+		t.Error("expected no relationship for unknown field")
+	}
+}
+
+func TestExtractMetadataRelationshipTags(t *testing.T) {
+	type Comment struct {
+		ID int `db:"id,pk,auto"`
+	}
+	type Account struct {
+		ID       int       `db:"id,pk,auto"`
+		Handle   string    `db:"handle,unique"`
+		Comments []Comment `theory:"has_many:Comment,foreign_key:author_handle,references:handle"`
+		Replies  []Comment `theory:"has_many:Comment,foreign_key:writer_id"`
+	}
+
+	metadata, err := ExtractMetadata(&Account{})
+	if err != nil {
+		t.Fatalf("ExtractMetadata() error = %v", err)
+	}
+
+	want := []Relationship{
+		{Name: "Comments", Kind: HasMany, Type: reflect.TypeOf(Comment{}), ForeignKey: "author_handle", References: "handle"},
+		{Name: "Replies", Kind: HasMany, Type: reflect.TypeOf(Comment{}), ForeignKey: "writer_id", References: "id"},
+	}
+	if !reflect.DeepEqual(metadata.Relationships, want) {
+		t.Errorf("Relationships = %+v, want %+v", metadata.Relationships, want)
+	}
+}
+
+func TestPluralNamingStrategy(t *testing.T) {
+	names := map[string]string{
+		"UserProfile": "user_profiles",
+		"Category":    "categories",
+		"Day":         "days",
+		"Address":     "addresses",
+		"Box":         "boxes",
+		"Branch":      "branches",
+	}
+	for typeName, want := range names {
+		if got := (PluralNamingStrategy{}).TableName(typeName); got != want {
+			t.Errorf("TableName(%q) = %q, want %q", typeName, got, want)
+		}
+	}
+
+	type UserProfile struct {
+		ID          int `db:"id,pk,auto"`
+		DisplayName string
+	}
+
+	SetNamingStrategy(PluralNamingStrategy{})
+	defer SetNamingStrategy(nil)
+
+	metadata, err := ExtractMetadata(&UserProfile{})
+	if err != nil {
+		t.Fatalf("ExtractMetadata() error = %v", err)
+	}
+	if metadata.TableName != "user_profiles" {
+		t.Errorf("TableName = %q, want user_profiles", metadata.TableName)
+	}
+	if _, ok := metadata.FieldByDBName("display_name"); !ok {
+		t.Errorf("expected column display_name, got %+v", metadata.Fields)
+	}
+
+	// Models naming their own table are not affected
+	metadata, err = ExtractMetadata(&UserWithTableName{})
+	if err != nil {
+		t.Fatalf("ExtractMetadata() error = %v", err)
+	}
+	if metadata.TableName != "custom_users" {
+		t.Errorf("TableName = %q, want custom_users", metadata.TableName)
+	}
+}
+
+func TestExtractMetadataWith(t *testing.T) {
+	type UserProfile struct {
+		ID int `db:"id,pk,auto"`
+	}
+
+	metadata, err := ExtractMetadataWith(&UserProfile{}, PluralNamingStrategy{})
+	if err != nil {
+		t.Fatalf("ExtractMetadataWith() error = %v", err)
+	}
+	if metadata.TableName != "user_profiles" {
+		t.Errorf("TableName = %q, want user_profiles", metadata.TableName)
+	}
+
+	// The process-wide strategy is left alone
+	metadata, err = ExtractMetadata(&UserProfile{})
+	if err != nil {
+		t.Fatalf("ExtractMetadata() error = %v", err)
+	}
+	if metadata.TableName != "user_profile" {
+		t.Errorf("TableName = %q, want user_profile", metadata.TableName)
+	}
+}
+
+func TestMetadataString(t *testing.T) {
+	type Account struct {
+		ID        int        `db:"id,pk,auto"`
+		Name      string     `db:"name"`
+		Email     string     `db:"email,null,unique"`
+		Balance   float64    `db:"balance,type=DECIMAL(10,2)"`
+		DeletedAt *time.Time `db:"deleted_at"`
+	}
+
+	metadata, err := ExtractMetadata(&Account{})
+	if err != nil {
+		t.Fatalf("ExtractMetadata() error = %v", err)
+	}
+
+	want := "Table: account\n" +
+		"  id INTEGER PK AUTO\n" +
+		"  name TEXT\n" +
+		"  email TEXT NULL UNIQUE\n" +
+		"  balance DECIMAL(10,2)\n" +
+		"  deleted_at DATETIME NULL"
+	if got := metadata.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	metadata.Fields = append(metadata.Fields, Field{Name: "Active", DBName: "active", Type: reflect.TypeOf(true)})
+	if got := metadata.String(); got != want+"\n  active INTEGER" {
+		t.Errorf("String() after adding a field = %q", got)
+	}
+}
+
+// WideModel has enough fields to make metadata extraction costs visible
+type WideModel struct {
+	ID        int        `db:"id,pk,auto"`
+	Name      string     `db:"name"`
+	Email     string     `db:"email,unique"`
+	Phone     string     `db:"phone,null"`
+	Street    string     `db:"street"`
+	City      string     `db:"city"`
+	State     string     `db:"state"`
+	Zip       string     `db:"zip"`
+	Country   string     `db:"country"`
+	Company   string     `db:"company,null"`
+	Title     string     `db:"title,null"`
+	Age       int        `db:"age"`
+	Score     float64    `db:"score"`
+	Balance   float64    `db:"balance,type=DECIMAL(10,2)"`
+	Active    bool       `db:"active"`
+	Verified  bool       `db:"verified"`
+	Logins    int64      `db:"logins"`
+	Notes     string     `db:"notes,null"`
+	Locale    string     `db:"locale"`
+	Timezone  string     `db:"timezone"`
+	CreatedAt time.Time  `db:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at"`
+	DeletedAt *time.Time `db:"deleted_at"`
+	Internal  string     `db:"-"`
+}
+
+// BenchmarkExtractMetadataCold measures extraction without any cached
+// metadata. ExtractMetadata has no cache yet; once it has one, it must be
+// cleared before each call here, and a cached counterpart belongs next to
+// this benchmark.
+func BenchmarkExtractMetadataCold(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ExtractMetadata(&WideModel{}); err != nil {
+			b.Fatalf("ExtractMetadata() error = %v", err)
+		}
+	}
+}
+
+func FuzzExtractMetadataTags(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		",",
+		",pk",
+		",pk,auto",
+		"id,pk,auto,null,unique",
+		"name,type=",
+		"-",
+		"名前,unique",
+		"\u00e9l\u00e8ve,null",
+		strings.Repeat("x", 4096),
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, tag string) {
+		typ := reflect.StructOf([]reflect.StructField{
+			{Name: "ID", Type: reflect.TypeOf(0), Tag: reflect.StructTag(`db:` + strconv.Quote(tag))},
+			{Name: "Name", Type: reflect.TypeOf(""), Tag: reflect.StructTag(`db:` + strconv.Quote(tag))},
+		})
+
+		// Errors are fine, panics are not
+		metadata, err := ExtractMetadata(reflect.New(typ).Interface())
+		if err == nil && metadata == nil {
+			t.Fatal("ExtractMetadata() returned neither metadata nor an error")
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"strings"
+	"sync"
+)
+
+// NamingStrategy derives table and column names from Go type and field
+// names. It applies to models without a TableName method and to fields
+// without a column name in their db tag.
+type NamingStrategy interface {
+	TableName(typeName string) string
+	ColumnName(fieldName string) string
+}
+
+// DefaultNamingStrategy converts names to snake_case: UserProfile becomes
+// user_profile
+type DefaultNamingStrategy struct{}
+
+// TableName returns the snake_case type name
+func (DefaultNamingStrategy) TableName(typeName string) string {
+	return toSnakeCase(typeName)
+}
+
+// ColumnName returns the snake_case field name
+func (DefaultNamingStrategy) ColumnName(fieldName string) string {
+	return toSnakeCase(fieldName)
+}
+
+// PluralNamingStrategy is like DefaultNamingStrategy but pluralizes table
+// names: UserProfile becomes user_profiles
+type PluralNamingStrategy struct{}
+
+// TableName returns the pluralized snake_case type name
+func (PluralNamingStrategy) TableName(typeName string) string {
+	return pluralize(toSnakeCase(typeName))
+}
+
+// ColumnName returns the snake_case field name
+func (PluralNamingStrategy) ColumnName(fieldName string) string {
+	return toSnakeCase(fieldName)
+}
+
+// pluralize applies the regular English plural rules to a word
+func pluralize(word string) string {
+	switch {
+	case word == "":
+		return word
+	case strings.HasSuffix(word, "s"), strings.HasSuffix(word, "x"), strings.HasSuffix(word, "z"),
+		strings.HasSuffix(word, "ch"), strings.HasSuffix(word, "sh"):
+		return word + "es"
+	case strings.HasSuffix(word, "y") && len(word) > 1 && !strings.ContainsRune("aeiou", rune(word[len(word)-2])):
+		return word[:len(word)-1] + "ies"
+	}
+	return word + "s"
+}
+
+var (
+	namingMu       sync.RWMutex
+	namingStrategy NamingStrategy = DefaultNamingStrategy{}
+)
+
+// SetNamingStrategy sets the naming strategy used by ExtractMetadata, and by
+// ExtractMetadataWith when given no strategy. It is process-wide; nil
+// restores DefaultNamingStrategy.
+func SetNamingStrategy(s NamingStrategy) {
+	if s == nil {
+		s = DefaultNamingStrategy{}
+	}
+	namingMu.Lock()
+	defer namingMu.Unlock()
+	namingStrategy = s
+}
+
+// naming returns the current naming strategy
+func naming() NamingStrategy {
+	namingMu.RLock()
+	defer namingMu.RUnlock()
+	return namingStrategy
+}
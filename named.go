@@ -0,0 +1,139 @@
+package theory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// NamedExec runs a statement with :name parameters on the primary. The
+// values come from arg, a map[string]interface{} or a struct whose fields
+// are named by their database column.
+func (db *DB) NamedExec(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	db = db.inContextTx(ctx)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	expanded, args, err := db.expandNamed(query, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := db.exec(ctx, expanded, args...)
+	if err != nil {
+		return nil, wrapError("named exec", "", err)
+	}
+	return result, nil
+}
+
+// NamedQuery runs a query with :name parameters on the primary, taking the
+// values from arg as NamedExec does. The caller must close the rows. As the
+// rows outlive the call, the per-query timeout set with WithTimeout does not
+// apply, and the query runs on the pool rather than on a connection checked
+// by SetConnValidator.
+func (db *DB) NamedQuery(ctx context.Context, query string, arg interface{}) (*sql.Rows, error) {
+	db = db.inContextTx(ctx)
+	expanded, args, err := db.expandNamed(query, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	if db.dryRun {
+		db.logDryRun(expanded, args)
+		return nil, nil
+	}
+
+	var exec executor = db.Primary()
+	if db.tx != nil {
+		exec = db.tx
+	}
+
+	start := time.Now()
+	rows, err := exec.QueryContext(ctx, expanded, args...)
+	db.logQuery(expanded, args, time.Since(start), err)
+	if err != nil {
+		return nil, wrapError("named query", "", err)
+	}
+	return rows, nil
+}
+
+// expandNamed replaces :name parameters with positional placeholders, ? or
+// $N on PostgreSQL, and returns the matching arguments. Quoted strings and
+// :: casts are left alone.
+func (db *DB) expandNamed(query string, arg interface{}) (string, []interface{}, error) {
+	values, err := db.namedArgs(arg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var out strings.Builder
+	var args []interface{}
+	inString := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inString = !inString
+		case inString || c != ':':
+		case i+1 < len(query) && query[i+1] == ':':
+			// A cast such as value::text
+			out.WriteString("::")
+			i++
+			continue
+		case i+1 < len(query) && isNameStart(query[i+1]):
+			end := i + 1
+			for end < len(query) && isNamePart(query[end]) {
+				end++
+			}
+			name := query[i+1 : end]
+			value, ok := values[name]
+			if !ok {
+				return "", nil, fmt.Errorf("missing value for named parameter :%s", name)
+			}
+			args = append(args, value)
+			if db.isPostgres() {
+				fmt.Fprintf(&out, "$%d", len(args))
+			} else {
+				out.WriteByte('?')
+			}
+			i = end - 1
+			continue
+		}
+		out.WriteByte(c)
+	}
+	return out.String(), args, nil
+}
+
+// namedArgs returns the parameter values of a map or struct argument
+func (db *DB) namedArgs(arg interface{}) (map[string]interface{}, error) {
+	if values, ok := arg.(map[string]interface{}); ok {
+		return values, nil
+	}
+
+	metadata, err := db.metadata(arg)
+	if err != nil {
+		return nil, fmt.Errorf("named arguments must be a map or a struct: %w", err)
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(arg))
+	values := make(map[string]interface{}, len(metadata.Fields))
+	for i := range metadata.Fields {
+		value, err := columnValue(v, &metadata.Fields[i])
+		if err != nil {
+			return nil, err
+		}
+		values[metadata.Fields[i].DBName] = value
+	}
+	return values, nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isNamePart(c byte) bool {
+	return isNameStart(c) || '0' <= c && c <= '9'
+}
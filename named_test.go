@@ -0,0 +1,106 @@
+package theory
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestExpandNamed(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user := TestUser{ID: 7, Name: "Alice", Email: "alice@example.com"}
+	query, args, err := db.expandNamed("UPDATE test_user SET name = :name, email = :email WHERE id = :id", &user)
+	if err != nil {
+		t.Fatalf("expandNamed() error = %v", err)
+	}
+	if query != "UPDATE test_user SET name = ?, email = ? WHERE id = ?" {
+		t.Errorf("expanded query = %q", query)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"Alice", "alice@example.com", 7}) {
+		t.Errorf("args = %v", args)
+	}
+
+	// Quoted strings and casts are not parameters; names may repeat
+	query, args, err = db.expandNamed("SELECT ':skip', id::text FROM t WHERE a = :a OR b = :a", map[string]interface{}{"a": 1})
+	if err != nil {
+		t.Fatalf("expandNamed() error = %v", err)
+	}
+	if query != "SELECT ':skip', id::text FROM t WHERE a = ? OR b = ?" {
+		t.Errorf("expanded query = %q", query)
+	}
+	if !reflect.DeepEqual(args, []interface{}{1, 1}) {
+		t.Errorf("args = %v", args)
+	}
+
+	if _, _, err := db.expandNamed("SELECT :missing", map[string]interface{}{}); err == nil {
+		t.Error("expected an error for a missing parameter")
+	}
+
+	// PostgreSQL uses numbered placeholders
+	pg := &DB{driver: "postgres"}
+	query, _, err = pg.expandNamed("SELECT * FROM t WHERE a = :a AND b = :b", map[string]interface{}{"a": 1, "b": 2})
+	if err != nil {
+		t.Fatalf("expandNamed() error = %v", err)
+	}
+	if query != "SELECT * FROM t WHERE a = $1 AND b = $2" {
+		t.Errorf("expanded query = %q", query)
+	}
+}
+
+func TestNamedExecAndQuery(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	result, err := db.NamedExec(ctx, "INSERT INTO test_user (name, email) VALUES (:name, :email)",
+		TestUser{Name: "Alice", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("NamedExec() error = %v", err)
+	}
+	if n, _ := result.RowsAffected(); n != 1 {
+		t.Errorf("expected 1 row affected, got %d", n)
+	}
+
+	rows, err := db.NamedQuery(ctx, "SELECT email FROM test_user WHERE name = :name", map[string]interface{}{"name": "Alice"})
+	if err != nil {
+		t.Fatalf("NamedQuery() error = %v", err)
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			t.Fatalf("failed to scan: %v", err)
+		}
+		emails = append(emails, email)
+	}
+	if !reflect.DeepEqual(emails, []string{"alice@example.com"}) {
+		t.Errorf("emails = %v", emails)
+	}
+}
+
+func TestNamedQueryValidator(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	validated := 0
+	db.SetConnValidator(func(ctx context.Context, conn *sql.Conn) error {
+		validated++
+		return nil
+	})
+
+	// The rows outlive the call, so no validated connection is held for them
+	ctx := context.Background()
+	rows, err := db.NamedQuery(ctx, "SELECT name FROM test_user WHERE name = :name", map[string]interface{}{"name": "Alice"})
+	if err != nil {
+		t.Fatalf("NamedQuery() error = %v", err)
+	}
+	rows.Close()
+	if validated != 0 {
+		t.Errorf("expected no connection to be validated, got %d", validated)
+	}
+}
@@ -0,0 +1,89 @@
+package theory
+
+import (
+	"crypto/rand"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/wilburhimself/theory/model"
+)
+
+// PKStrategy generates primary key values on the application side, for keys
+// the database cannot generate, such as UUIDs or Snowflake IDs
+type PKStrategy interface {
+	GeneratePK() (interface{}, error)
+}
+
+// DefaultPKStrategy is the strategy used by string auto fields that do not
+// name one with the strategy= tag option
+const DefaultPKStrategy = "uuid"
+
+// UUIDv4Strategy generates random (version 4) UUIDs in their canonical
+// 36-character string form
+type UUIDv4Strategy struct{}
+
+// GeneratePK returns a new random UUID
+func (UUIDv4Strategy) GeneratePK() (interface{}, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return nil, err
+	}
+	u[6] = u[6]&0x0f | 0x40 // version 4
+	u[8] = u[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]), nil
+}
+
+// pkStrategies holds the registered primary key strategies. Copies of a DB
+// share it.
+type pkStrategies struct {
+	mu     sync.RWMutex
+	byName map[string]PKStrategy
+}
+
+func newPKStrategies() *pkStrategies {
+	return &pkStrategies{byName: map[string]PKStrategy{DefaultPKStrategy: UUIDv4Strategy{}}}
+}
+
+// SetPKStrategy registers a primary key strategy under name, replacing any
+// strategy registered under the same name. Fields select it with the
+// strategy= tag option, as in `db:"id,pk,auto,strategy=snowflake"`. A
+// UUIDv4Strategy is registered as DefaultPKStrategy.
+func (db *DB) SetPKStrategy(name string, s PKStrategy) {
+	db.pkStrategies.mu.Lock()
+	defer db.pkStrategies.mu.Unlock()
+	db.pkStrategies.byName[name] = s
+}
+
+// generatePK sets an application-generated primary key on the field of v,
+// unless the caller already set one
+func (db *DB) generatePK(v reflect.Value, field *model.Field) error {
+	fv := v.FieldByName(field.Name)
+	if !fv.IsZero() {
+		return nil
+	}
+
+	name := field.PKStrategy
+	if name == "" {
+		name = DefaultPKStrategy
+	}
+	db.pkStrategies.mu.RLock()
+	strategy, ok := db.pkStrategies.byName[name]
+	db.pkStrategies.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no primary key strategy registered as %q", name)
+	}
+
+	value, err := strategy.GeneratePK()
+	if err != nil {
+		return fmt.Errorf("failed to generate primary key: %w", err)
+	}
+
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() || !rv.Type().ConvertibleTo(fv.Type()) ||
+		(rv.Kind() == reflect.String) != (fv.Kind() == reflect.String) {
+		return fmt.Errorf("primary key strategy %q generated %T, which cannot be stored in %s", name, value, fv.Type())
+	}
+	fv.Set(rv.Convert(fv.Type()))
+	return nil
+}
@@ -0,0 +1,101 @@
+package theory
+
+import (
+	"context"
+	"regexp"
+	"sync/atomic"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestUUIDv4Strategy(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		value, err := UUIDv4Strategy{}.GeneratePK()
+		if err != nil {
+			t.Fatalf("GeneratePK() error = %v", err)
+		}
+		id, ok := value.(string)
+		if !ok || !uuidPattern.MatchString(id) {
+			t.Fatalf("GeneratePK() = %v, want a version 4 UUID", value)
+		}
+		if seen[id] {
+			t.Fatalf("GeneratePK() returned %s twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+type TestArticle struct {
+	ID    string `db:"id,pk,auto"`
+	Title string `db:"title"`
+}
+
+type TestEvent struct {
+	ID   int64  `db:"id,pk,auto,strategy=sequential"`
+	Name string `db:"name"`
+}
+
+type TestTicket struct {
+	ID   string `db:"id,pk,auto,strategy=missing"`
+	Name string `db:"name"`
+}
+
+// sequentialStrategy hands out increasing IDs starting at 1000
+type sequentialStrategy struct {
+	next int64
+}
+
+func (s *sequentialStrategy) GeneratePK() (interface{}, error) {
+	return atomic.AddInt64(&s.next, 1) + 999, nil
+}
+
+func TestPKStrategy(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := db.AutoMigrate(ctx, &TestArticle{}, &TestEvent{}, &TestTicket{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	article := &TestArticle{Title: "Draft"}
+	if err := db.Create(ctx, article); err != nil {
+		t.Fatalf("failed to create article: %v", err)
+	}
+	if !uuidPattern.MatchString(article.ID) {
+		t.Fatalf("expected a UUID primary key, got %q", article.ID)
+	}
+
+	var found TestArticle
+	if err := db.First(ctx, &found, article.ID); err != nil {
+		t.Fatalf("failed to find article: %v", err)
+	}
+	if found.Title != "Draft" {
+		t.Errorf("expected title Draft, got %q", found.Title)
+	}
+
+	preset := &TestArticle{ID: "article-1", Title: "Preset"}
+	if err := db.Create(ctx, preset); err != nil {
+		t.Fatalf("failed to create article: %v", err)
+	}
+	if preset.ID != "article-1" {
+		t.Errorf("expected a preset primary key to be kept, got %q", preset.ID)
+	}
+
+	db.SetPKStrategy("sequential", &sequentialStrategy{})
+	for want := int64(1000); want < 1002; want++ {
+		event := &TestEvent{Name: "signup"}
+		if err := db.Create(ctx, event); err != nil {
+			t.Fatalf("failed to create event: %v", err)
+		}
+		if event.ID != want {
+			t.Errorf("expected event ID %d, got %d", want, event.ID)
+		}
+	}
+
+	if err := db.Create(ctx, &TestTicket{Name: "bug"}); err == nil {
+		t.Error("expected an error for an unregistered strategy")
+	}
+}
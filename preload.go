@@ -0,0 +1,172 @@
+package theory
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/wilburhimself/theory/model"
+)
+
+// Preload loads the named relationship fields of dest, a pointer to a model
+// or to a slice of models that were already retrieved. The associated
+// records of all models are loaded with one query per relationship (two for
+// many-to-many), matching the relationship's foreign key against the
+// referenced owner column.
+func (db *DB) Preload(ctx context.Context, dest interface{}, fields ...string) error {
+	d, err := parseDest(dest)
+	if err != nil {
+		return err
+	}
+	metadata, err := d.metadata(db.naming)
+	if err != nil {
+		return err
+	}
+
+	var owners []reflect.Value
+	if d.isSlice {
+		for i := 0; i < d.value.Len(); i++ {
+			owners = append(owners, reflect.Indirect(d.value.Index(i)))
+		}
+	} else {
+		owners = append(owners, d.value)
+	}
+
+	for _, field := range fields {
+		rel, ok := metadata.Relationship(field)
+		if !ok {
+			return fmt.Errorf("%s has no relationship field %s", d.elemType.Name(), field)
+		}
+		if err := db.preload(ctx, owners, metadata, rel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// preload sets one relationship field on each owner
+func (db *DB) preload(ctx context.Context, owners []reflect.Value, metadata *model.Metadata, rel *model.Relationship) error {
+	ref, ok := metadata.FieldByDBName(rel.References)
+	if !ok {
+		return fmt.Errorf("%s has no column %s referenced by %s", metadata.TableName, rel.References, rel.Name)
+	}
+	assocMetadata, err := db.metadata(reflect.New(rel.Type).Interface())
+	if err != nil {
+		return err
+	}
+
+	// Keys are compared in their printed form, as drivers may scan a
+	// foreign key into a different integer type than the owner's key
+	var keys []interface{}
+	seen := make(map[string]bool)
+	for _, owner := range owners {
+		key := owner.FieldByName(ref.Name)
+		if key.IsZero() {
+			continue
+		}
+		if k := fmt.Sprint(key.Interface()); !seen[k] {
+			seen[k] = true
+			keys = append(keys, key.Interface())
+		}
+	}
+
+	related := make(map[string][]reflect.Value)
+	if len(keys) > 0 {
+		switch rel.Kind {
+		case model.HasMany:
+			err = db.preloadHasMany(ctx, rel, assocMetadata, keys, related)
+		case model.ManyToMany:
+			err = db.preloadManyToMany(ctx, rel, assocMetadata, keys, related)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, owner := range owners {
+		field := owner.FieldByName(rel.Name)
+		records := reflect.MakeSlice(field.Type(), 0, 0)
+		if key := owner.FieldByName(ref.Name); !key.IsZero() {
+			for _, record := range related[fmt.Sprint(key.Interface())] {
+				if field.Type().Elem().Kind() == reflect.Ptr {
+					records = reflect.Append(records, record)
+				} else {
+					records = reflect.Append(records, record.Elem())
+				}
+			}
+		}
+		field.Set(records)
+	}
+	return nil
+}
+
+// preloadHasMany loads the records whose foreign key is one of keys into
+// related, grouped by foreign key
+func (db *DB) preloadHasMany(ctx context.Context, rel *model.Relationship, assocMetadata *model.Metadata, keys []interface{}, related map[string][]reflect.Value) error {
+	fk, ok := assocMetadata.FieldByDBName(rel.ForeignKey)
+	if !ok {
+		return fmt.Errorf("%s has no foreign key column %s", assocMetadata.TableName, rel.ForeignKey)
+	}
+
+	records := reflect.New(reflect.SliceOf(reflect.PtrTo(rel.Type)))
+	if err := db.Find(ctx, records.Interface(), fmt.Sprintf("%s IN (%s)", rel.ForeignKey, placeholders(len(keys))), keys...); err != nil {
+		return err
+	}
+
+	for i := 0; i < records.Elem().Len(); i++ {
+		record := records.Elem().Index(i)
+		key := reflect.Indirect(record.Elem().FieldByName(fk.Name))
+		if !key.IsValid() {
+			continue
+		}
+		k := fmt.Sprint(key.Interface())
+		related[k] = append(related[k], record)
+	}
+	return nil
+}
+
+// preloadManyToMany loads the records linked to keys through the join table
+// into related, grouped by owner key
+func (db *DB) preloadManyToMany(ctx context.Context, rel *model.Relationship, assocMetadata *model.Metadata, keys []interface{}, related map[string][]reflect.Value) error {
+	pk := assocMetadata.PrimaryKey()
+	if pk == nil {
+		return fmt.Errorf("no primary key field found")
+	}
+
+	links, err := db.ScanMaps(ctx, fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s IN (%s)",
+		rel.ForeignKey, rel.JoinForeignKey, rel.JoinTable, rel.ForeignKey, placeholders(len(keys))), keys...)
+	if err != nil {
+		return err
+	}
+	if len(links) == 0 {
+		return nil
+	}
+
+	var ids []interface{}
+	for _, link := range links {
+		ids = append(ids, link[rel.JoinForeignKey])
+	}
+	records := reflect.New(reflect.SliceOf(reflect.PtrTo(rel.Type)))
+	if err := db.Find(ctx, records.Interface(), fmt.Sprintf("%s IN (%s)", pk.DBName, placeholders(len(ids))), ids...); err != nil {
+		return err
+	}
+
+	byID := make(map[string]reflect.Value, records.Elem().Len())
+	for i := 0; i < records.Elem().Len(); i++ {
+		record := records.Elem().Index(i)
+		byID[fmt.Sprint(record.Elem().FieldByName(pk.Name).Interface())] = record
+	}
+	for _, link := range links {
+		if record, ok := byID[fmt.Sprint(link[rel.JoinForeignKey])]; ok {
+			k := fmt.Sprint(link[rel.ForeignKey])
+			related[k] = append(related[k], record)
+		}
+	}
+	return nil
+}
+
+// placeholders returns n comma-separated ? placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,136 @@
+package theory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPreload(t *testing.T) {
+	db, owner := setupAssociationDB(t)
+	ctx := context.Background()
+
+	other := &TestOwner{Name: "Other"}
+	if err := db.Create(ctx, other); err != nil {
+		t.Fatalf("failed to create owner: %v", err)
+	}
+	empty := &TestOwner{Name: "Empty"}
+	if err := db.Create(ctx, empty); err != nil {
+		t.Fatalf("failed to create owner: %v", err)
+	}
+
+	if err := db.Association(ctx, owner, "Notes").Append(&TestNote{Title: "First"}, &TestNote{Title: "Second"}); err != nil {
+		t.Fatalf("failed to append notes: %v", err)
+	}
+	if err := db.Association(ctx, other, "Notes").Append(&TestNote{Title: "Third"}); err != nil {
+		t.Fatalf("failed to append notes: %v", err)
+	}
+	if err := db.Association(ctx, owner, "Tags").Append(&TestTag{Name: "go"}); err != nil {
+		t.Fatalf("failed to append tags: %v", err)
+	}
+
+	var owners []TestOwner
+	if err := db.Find(ctx, &owners, "1 = 1 ORDER BY id"); err != nil {
+		t.Fatalf("failed to find owners: %v", err)
+	}
+	if err := db.Preload(ctx, &owners, "Notes", "Tags"); err != nil {
+		t.Fatalf("Preload() error = %v", err)
+	}
+
+	titles := func(notes []TestNote) []string {
+		var titles []string
+		for _, n := range notes {
+			titles = append(titles, n.Title)
+		}
+		return titles
+	}
+	if got := titles(owners[0].Notes); !reflect.DeepEqual(got, []string{"First", "Second"}) {
+		t.Errorf("owner notes = %v, want [First Second]", got)
+	}
+	if got := titles(owners[1].Notes); !reflect.DeepEqual(got, []string{"Third"}) {
+		t.Errorf("other notes = %v, want [Third]", got)
+	}
+	if owners[2].Notes == nil || len(owners[2].Notes) != 0 {
+		t.Errorf("expected empty notes for the owner without notes, got %v", owners[2].Notes)
+	}
+	if len(owners[0].Tags) != 1 || owners[0].Tags[0].Name != "go" || len(owners[1].Tags) != 0 {
+		t.Errorf("unexpected tags: %+v, %+v", owners[0].Tags, owners[1].Tags)
+	}
+
+	var single TestOwner
+	if err := db.First(ctx, &single, other.ID); err != nil {
+		t.Fatalf("failed to find owner: %v", err)
+	}
+	if err := db.Preload(ctx, &single, "Notes"); err != nil {
+		t.Fatalf("Preload() error = %v", err)
+	}
+	if got := titles(single.Notes); !reflect.DeepEqual(got, []string{"Third"}) {
+		t.Errorf("notes = %v, want [Third]", got)
+	}
+
+	if err := db.Preload(ctx, &single, "Missing"); err == nil {
+		t.Error("expected error for unknown relationship")
+	}
+}
+
+type TestWriter struct {
+	ID       int              `db:"id,pk,auto"`
+	Handle   string           `db:"handle,unique"`
+	Articles []*TestPublished `theory:"has_many:TestPublished,foreign_key:author_handle,references:handle"`
+}
+
+type TestPublished struct {
+	ID           int    `db:"id,pk,auto"`
+	Title        string `db:"title"`
+	AuthorHandle string `db:"author_handle"`
+}
+
+func TestPreloadCustomForeignKey(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := db.AutoMigrate(ctx, &TestWriter{}, &TestPublished{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	writers := []*TestWriter{{Handle: "ada"}, {Handle: "grace"}}
+	for _, w := range writers {
+		if err := db.Create(ctx, w); err != nil {
+			t.Fatalf("failed to create writer: %v", err)
+		}
+	}
+	for _, p := range []*TestPublished{
+		{Title: "Notes", AuthorHandle: "ada"},
+		{Title: "Compilers", AuthorHandle: "grace"},
+		{Title: "Engines", AuthorHandle: "ada"},
+	} {
+		if err := db.Create(ctx, p); err != nil {
+			t.Fatalf("failed to create article: %v", err)
+		}
+	}
+
+	if err := db.Preload(ctx, &writers, "Articles"); err != nil {
+		t.Fatalf("Preload() error = %v", err)
+	}
+	for _, tt := range []struct {
+		writer *TestWriter
+		want   []string
+	}{
+		{writers[0], []string{"Notes", "Engines"}},
+		{writers[1], []string{"Compilers"}},
+	} {
+		var got []string
+		for _, a := range tt.writer.Articles {
+			got = append(got, a.Title)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s articles = %v, want %v", tt.writer.Handle, got, tt.want)
+		}
+	}
+
+	count, err := db.Association(ctx, writers[0], "Articles").Count()
+	if err != nil || count != 2 {
+		t.Errorf("Association().Count() = %d, %v, want 2", count, err)
+	}
+}
@@ -2,6 +2,7 @@ package query
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -9,14 +10,34 @@ import (
 type Builder struct {
 	table     string
 	columns   []string
+	joins     []string
+	colArgs   []interface{}
+	values    []interface{}
 	where     []string
 	args      []interface{}
+	exists    []existsClause
+	ctes      []cte
+	groupBy   []string
 	orderBy   string
 	limit     int
 	offset    int
 	operation string
 }
 
+// existsClause is an EXISTS or NOT EXISTS condition on a subquery
+type existsClause struct {
+	operator string
+	sub      *Builder
+}
+
+// cte is a named subquery in a WITH clause. Recursive CTEs combine sub,
+// the anchor, with recursive using UNION ALL.
+type cte struct {
+	name      string
+	sub       *Builder
+	recursive *Builder
+}
+
 // NewBuilder creates a new query builder for the specified table
 func NewBuilder(table string) *Builder {
 	return &Builder{
@@ -31,6 +52,80 @@ func NewBuilder(table string) *Builder {
 func (b *Builder) Select(columns ...string) *Builder {
 	b.operation = "SELECT"
 	b.columns = columns
+	b.colArgs = nil
+	return b
+}
+
+// Insert makes the builder build an INSERT of the given values into columns
+func (b *Builder) Insert(columns []string, values []interface{}) *Builder {
+	b.operation = "INSERT"
+	b.columns = columns
+	b.values = values
+	return b
+}
+
+// Update makes the builder build an UPDATE setting columns to values. Only
+// the WHERE clause applies to updates.
+func (b *Builder) Update(columns []string, values []interface{}) *Builder {
+	b.operation = "UPDATE"
+	b.columns = columns
+	b.values = values
+	return b
+}
+
+// Delete makes the builder build a DELETE. Only the WHERE clause applies to
+// deletes.
+func (b *Builder) Delete() *Builder {
+	b.operation = "DELETE"
+	return b
+}
+
+// SelectExpr adds an expression, such as a CaseWhen, to the SELECT list.
+// Its args come before the WHERE args.
+func (b *Builder) SelectExpr(expr CaseExpr) *Builder {
+	b.operation = "SELECT"
+	b.columns = append(b.columns, expr.SQL())
+	b.colArgs = append(b.colArgs, expr.Args()...)
+	return b
+}
+
+// SelectCount selects COUNT(column), or COUNT(*) when column is "*"
+func (b *Builder) SelectCount(column string) *Builder {
+	return b.selectAggregate("COUNT", column)
+}
+
+// SelectSum selects SUM(column)
+func (b *Builder) SelectSum(column string) *Builder {
+	return b.selectAggregate("SUM", column)
+}
+
+// SelectMin selects MIN(column)
+func (b *Builder) SelectMin(column string) *Builder {
+	return b.selectAggregate("MIN", column)
+}
+
+// SelectMax selects MAX(column)
+func (b *Builder) SelectMax(column string) *Builder {
+	return b.selectAggregate("MAX", column)
+}
+
+// SelectAvg selects AVG(column)
+func (b *Builder) SelectAvg(column string) *Builder {
+	return b.selectAggregate("AVG", column)
+}
+
+// selectAggregate sets the selected column to an aggregate function call
+func (b *Builder) selectAggregate(function, column string) *Builder {
+	b.operation = "SELECT"
+	b.columns = []string{fmt.Sprintf("%s(%s)", function, column)}
+	b.colArgs = nil
+	return b
+}
+
+// Join adds a join clause, such as "JOIN posts p ON p.user_id = u.id", to a
+// SELECT. Joins are rendered after the table in the order they were added.
+func (b *Builder) Join(join string) *Builder {
+	b.joins = append(b.joins, join)
 	return b
 }
 
@@ -41,6 +136,44 @@ func (b *Builder) Where(condition string, args ...interface{}) *Builder {
 	return b
 }
 
+// WhereExists adds a WHERE EXISTS (subquery) condition. The subquery selects
+// 1 unless it has columns of its own. EXISTS conditions come first in the
+// WHERE clause, so their args precede the outer WHERE args.
+func (b *Builder) WhereExists(sub *Builder) *Builder {
+	b.exists = append(b.exists, existsClause{operator: "EXISTS", sub: sub.Clone()})
+	return b
+}
+
+// WhereNotExists adds a WHERE NOT EXISTS (subquery) condition
+func (b *Builder) WhereNotExists(sub *Builder) *Builder {
+	b.exists = append(b.exists, existsClause{operator: "NOT EXISTS", sub: sub.Clone()})
+	return b
+}
+
+// With adds a common table expression, rendered as WITH name AS (subquery)
+// before the main query. The subquery selects all columns unless it has a
+// SELECT of its own. CTE args come before all other args.
+func (b *Builder) With(name string, sub *Builder) *Builder {
+	b.ctes = append(b.ctes, cte{name: name, sub: sub.Clone()})
+	return b
+}
+
+// WithRecursive adds a recursive common table expression, rendered as
+// WITH RECURSIVE name AS (anchor UNION ALL recursive), for walking
+// hierarchies such as category trees. The recursive query refers to name,
+// usually in a join; name may list the CTE's columns, as in
+// "tree(id, parent_id)". Anchor args come before recursive args.
+func (b *Builder) WithRecursive(name string, anchor *Builder, recursive *Builder) *Builder {
+	b.ctes = append(b.ctes, cte{name: name, sub: anchor.Clone(), recursive: recursive.Clone()})
+	return b
+}
+
+// GroupBy adds a GROUP BY clause to the query
+func (b *Builder) GroupBy(columns ...string) *Builder {
+	b.groupBy = append(b.groupBy, columns...)
+	return b
+}
+
 // OrderBy adds an ORDER BY clause to the query
 func (b *Builder) OrderBy(orderBy string) *Builder {
 	b.orderBy = orderBy
@@ -59,9 +192,92 @@ func (b *Builder) Offset(offset int) *Builder {
 	return b
 }
 
+// ResetWhere removes all WHERE conditions and their arguments
+func (b *Builder) ResetWhere() *Builder {
+	b.where = make([]string, 0)
+	b.args = make([]interface{}, 0)
+	b.exists = nil
+	return b
+}
+
+// ResetOrderBy removes the ORDER BY clause
+func (b *Builder) ResetOrderBy() *Builder {
+	b.orderBy = ""
+	return b
+}
+
+// ResetLimit removes the LIMIT clause
+func (b *Builder) ResetLimit() *Builder {
+	b.limit = 0
+	return b
+}
+
+// ResetOffset removes the OFFSET clause
+func (b *Builder) ResetOffset() *Builder {
+	b.offset = 0
+	return b
+}
+
+// ResetColumns selects all columns again
+func (b *Builder) ResetColumns() *Builder {
+	b.columns = make([]string, 0)
+	b.colArgs = nil
+	return b
+}
+
+// Clone returns a deep copy of the builder. Changes to the clone do not
+// affect the original and vice versa.
+func (b *Builder) Clone() *Builder {
+	clone := *b
+	clone.columns = append(make([]string, 0, len(b.columns)), b.columns...)
+	clone.joins = append([]string(nil), b.joins...)
+	clone.colArgs = append([]interface{}(nil), b.colArgs...)
+	clone.values = append([]interface{}(nil), b.values...)
+	clone.where = append(make([]string, 0, len(b.where)), b.where...)
+	clone.args = append(make([]interface{}, 0, len(b.args)), b.args...)
+	clone.exists = append([]existsClause(nil), b.exists...)
+	clone.ctes = append([]cte(nil), b.ctes...)
+	clone.groupBy = append([]string(nil), b.groupBy...)
+	return &clone
+}
+
+// sizeHint estimates the length of the built query so it can be written
+// with a single allocation in the common case
+func (b *Builder) sizeHint() int {
+	n := 64 + len(b.table) + len(b.orderBy)
+	for _, parts := range [][]string{b.columns, b.joins, b.where, b.groupBy} {
+		for _, part := range parts {
+			n += len(part) + 5
+		}
+	}
+	return n
+}
+
 // Build constructs and returns the SQL query and its arguments
 func (b *Builder) Build() (string, []interface{}) {
 	var query strings.Builder
+	query.Grow(b.sizeHint())
+	args := make([]interface{}, 0, len(b.colArgs)+len(b.args))
+
+	if len(b.ctes) > 0 {
+		// RECURSIVE applies to the whole WITH clause
+		keyword := "WITH "
+		definitions := make([]string, 0, len(b.ctes))
+		for _, c := range b.ctes {
+			subQuery, subArgs := c.sub.buildSubquery()
+			args = append(args, subArgs...)
+			if c.recursive != nil {
+				keyword = "WITH RECURSIVE "
+				recursiveQuery, recursiveArgs := c.recursive.buildSubquery()
+				subQuery += " UNION ALL " + recursiveQuery
+				args = append(args, recursiveArgs...)
+			}
+			definitions = append(definitions, fmt.Sprintf("%s AS (%s)", c.name, subQuery))
+		}
+		query.WriteString(keyword)
+		query.WriteString(strings.Join(definitions, ", "))
+		query.WriteString(" ")
+	}
 
 	switch b.operation {
 	case "SELECT":
@@ -69,15 +285,68 @@ func (b *Builder) Build() (string, []interface{}) {
 		if len(b.columns) == 0 {
 			query.WriteString("*")
 		} else {
-			query.WriteString(strings.Join(b.columns, ", "))
+			writeJoined(&query, b.columns, ", ")
 		}
 		query.WriteString(" FROM ")
 		query.WriteString(b.table)
+		for _, join := range b.joins {
+			query.WriteString(" ")
+			query.WriteString(join)
+		}
+	case "INSERT":
+		placeholders := make([]string, len(b.columns))
+		for i := range placeholders {
+			placeholders[i] = "?"
+		}
+		query.WriteString(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+			b.table,
+			strings.Join(b.columns, ", "),
+			strings.Join(placeholders, ", ")))
+		return query.String(), append(args, b.values...)
+	case "UPDATE":
+		assignments := make([]string, len(b.columns))
+		for i, column := range b.columns {
+			assignments[i] = column + " = ?"
+		}
+		query.WriteString(fmt.Sprintf("UPDATE %s SET %s", b.table, strings.Join(assignments, ", ")))
+		args = append(args, b.values...)
+	case "DELETE":
+		query.WriteString("DELETE FROM ")
+		query.WriteString(b.table)
 	}
 
-	if len(b.where) > 0 {
+	args = append(args, b.colArgs...)
+	if len(b.exists)+len(b.where) > 0 {
 		query.WriteString(" WHERE ")
-		query.WriteString(strings.Join(b.where, " AND "))
+	}
+	for i, e := range b.exists {
+		sub := e.sub
+		if len(sub.columns) == 0 {
+			sub = sub.Clone().Select("1")
+		}
+		subQuery, subArgs := sub.Build()
+		if i > 0 {
+			query.WriteString(" AND ")
+		}
+		query.WriteString(e.operator)
+		query.WriteString(" (")
+		query.WriteString(subQuery)
+		query.WriteString(")")
+		args = append(args, subArgs...)
+	}
+	if len(b.exists) > 0 && len(b.where) > 0 {
+		query.WriteString(" AND ")
+	}
+	writeJoined(&query, b.where, " AND ")
+	args = append(args, b.args...)
+
+	if b.operation == "UPDATE" || b.operation == "DELETE" {
+		return query.String(), args
+	}
+
+	if len(b.groupBy) > 0 {
+		query.WriteString(" GROUP BY ")
+		writeJoined(&query, b.groupBy, ", ")
 	}
 
 	if b.orderBy != "" {
@@ -86,12 +355,59 @@ func (b *Builder) Build() (string, []interface{}) {
 	}
 
 	if b.limit > 0 {
-		query.WriteString(fmt.Sprintf(" LIMIT %d", b.limit))
+		query.WriteString(" LIMIT ")
+		writeInt(&query, b.limit)
 	}
 
 	if b.offset > 0 {
-		query.WriteString(fmt.Sprintf(" OFFSET %d", b.offset))
+		query.WriteString(" OFFSET ")
+		writeInt(&query, b.offset)
 	}
 
-	return query.String(), b.args
+	return query.String(), args
+}
+
+// buildSubquery builds b as a subquery, selecting all columns unless b has
+// a SELECT of its own
+func (b *Builder) buildSubquery() (string, []interface{}) {
+	if b.operation == "" {
+		return b.Clone().Select().Build()
+	}
+	return b.Build()
+}
+
+// writeJoined writes items to w separated by sep, like strings.Join without
+// the intermediate string
+func writeJoined(w *strings.Builder, items []string, sep string) {
+	for i, item := range items {
+		if i > 0 {
+			w.WriteString(sep)
+		}
+		w.WriteString(item)
+	}
+}
+
+// writeInt writes n in decimal to w without allocating
+func writeInt(w *strings.Builder, n int) {
+	var buf [20]byte
+	w.Write(strconv.AppendInt(buf[:0], int64(n), 10))
+}
+
+// String returns the built SQL for debugging, with each placeholder replaced
+// by <arg_N>, numbered from 1, so argument positions are easy to follow. The
+// result is not meant to be executed.
+func (b *Builder) String() string {
+	sql, args := b.Build()
+
+	var out strings.Builder
+	n := 0
+	for _, r := range sql {
+		if r == '?' && n < len(args) {
+			n++
+			fmt.Fprintf(&out, "<arg_%d>", n)
+			continue
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
 }
@@ -1,7 +1,9 @@
 package query
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -148,3 +150,504 @@ func TestBuilder_Chaining(t *testing.T) {
 		t.Errorf("Builder chaining gotArgs = %v, want %v", gotArgs, wantArgs)
 	}
 }
+
+func TestBuilder_Clone(t *testing.T) {
+	base := NewBuilder("users").
+		Select("id", "name").
+		Where("status = ?", "active")
+
+	recent := base.Clone().OrderBy("created_at DESC").Limit(5)
+	named := base.Clone().Where("name LIKE ?", "%john%").OrderBy("name ASC")
+
+	tests := []struct {
+		name      string
+		builder   *Builder
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "original",
+			builder:   base,
+			wantQuery: "SELECT id, name FROM users WHERE status = ?",
+			wantArgs:  []interface{}{"active"},
+		},
+		{
+			name:      "clone with order and limit",
+			builder:   recent,
+			wantQuery: "SELECT id, name FROM users WHERE status = ? ORDER BY created_at DESC LIMIT 5",
+			wantArgs:  []interface{}{"active"},
+		},
+		{
+			name:      "clone with extra where",
+			builder:   named,
+			wantQuery: "SELECT id, name FROM users WHERE status = ? AND name LIKE ? ORDER BY name ASC",
+			wantArgs:  []interface{}{"active", "%john%"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotQuery, gotArgs := tt.builder.Build()
+			if gotQuery != tt.wantQuery {
+				t.Errorf("Builder.Build() gotQuery = %v, want %v", gotQuery, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+				t.Errorf("Builder.Build() gotArgs = %v, want %v", gotArgs, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestBuilder_CloneIndependence(t *testing.T) {
+	original := NewBuilder("users").Select("id").Where("id > ?", 1)
+	clone := original.Clone()
+
+	// Appending to both must not overwrite each other's state
+	original.Where("name = ?", "john").Select("id", "name")
+	clone.Where("age > ?", 18)
+
+	gotQuery, gotArgs := original.Build()
+	if gotQuery != "SELECT id, name FROM users WHERE id > ? AND name = ?" {
+		t.Errorf("original query = %v", gotQuery)
+	}
+	if !reflect.DeepEqual(gotArgs, []interface{}{1, "john"}) {
+		t.Errorf("original args = %v, want %v", gotArgs, []interface{}{1, "john"})
+	}
+
+	gotQuery, gotArgs = clone.Build()
+	if gotQuery != "SELECT id FROM users WHERE id > ? AND age > ?" {
+		t.Errorf("clone query = %v", gotQuery)
+	}
+	if !reflect.DeepEqual(gotArgs, []interface{}{1, 18}) {
+		t.Errorf("clone args = %v, want %v", gotArgs, []interface{}{1, 18})
+	}
+}
+
+func TestBuilder_Reset(t *testing.T) {
+	full := func() *Builder {
+		return NewBuilder("users").
+			Select("id", "name").
+			Where("age > ?", 18).
+			OrderBy("name ASC").
+			Limit(10).
+			Offset(20)
+	}
+
+	tests := []struct {
+		name      string
+		reset     func(b *Builder) *Builder
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "reset where",
+			reset:     (*Builder).ResetWhere,
+			wantQuery: "SELECT id, name FROM users ORDER BY name ASC LIMIT 10 OFFSET 20",
+			wantArgs:  []interface{}{},
+		},
+		{
+			name:      "reset order by",
+			reset:     (*Builder).ResetOrderBy,
+			wantQuery: "SELECT id, name FROM users WHERE age > ? LIMIT 10 OFFSET 20",
+			wantArgs:  []interface{}{18},
+		},
+		{
+			name:      "reset limit",
+			reset:     (*Builder).ResetLimit,
+			wantQuery: "SELECT id, name FROM users WHERE age > ? ORDER BY name ASC OFFSET 20",
+			wantArgs:  []interface{}{18},
+		},
+		{
+			name:      "reset offset",
+			reset:     (*Builder).ResetOffset,
+			wantQuery: "SELECT id, name FROM users WHERE age > ? ORDER BY name ASC LIMIT 10",
+			wantArgs:  []interface{}{18},
+		},
+		{
+			name:      "reset columns",
+			reset:     (*Builder).ResetColumns,
+			wantQuery: "SELECT * FROM users WHERE age > ? ORDER BY name ASC LIMIT 10 OFFSET 20",
+			wantArgs:  []interface{}{18},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotQuery, gotArgs := tt.reset(full()).Build()
+			if gotQuery != tt.wantQuery {
+				t.Errorf("Builder.Build() gotQuery = %v, want %v", gotQuery, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+				t.Errorf("Builder.Build() gotArgs = %v, want %v", gotArgs, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestBuilder_ResetWhereReuse(t *testing.T) {
+	b := NewBuilder("users").Select().Where("id = ?", 1)
+	b.ResetWhere().Where("name = ?", "john")
+
+	gotQuery, gotArgs := b.Build()
+	if gotQuery != "SELECT * FROM users WHERE name = ?" {
+		t.Errorf("Builder.Build() gotQuery = %v", gotQuery)
+	}
+	if !reflect.DeepEqual(gotArgs, []interface{}{"john"}) {
+		t.Errorf("Builder.Build() gotArgs = %v", gotArgs)
+	}
+}
+
+func TestBuilder_Aggregates(t *testing.T) {
+	tests := []struct {
+		name      string
+		builder   *Builder
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "count all",
+			builder:   NewBuilder("users").SelectCount("*"),
+			wantQuery: "SELECT COUNT(*) FROM users",
+			wantArgs:  []interface{}{},
+		},
+		{
+			name:      "count column with where",
+			builder:   NewBuilder("users").SelectCount("email").Where("age > ?", 18),
+			wantQuery: "SELECT COUNT(email) FROM users WHERE age > ?",
+			wantArgs:  []interface{}{18},
+		},
+		{
+			name:      "sum with where and group by",
+			builder:   NewBuilder("orders").SelectSum("total").Where("status = ?", "paid").GroupBy("user_id"),
+			wantQuery: "SELECT SUM(total) FROM orders WHERE status = ? GROUP BY user_id",
+			wantArgs:  []interface{}{"paid"},
+		},
+		{
+			name:      "min with group by",
+			builder:   NewBuilder("orders").SelectMin("total").GroupBy("user_id", "status"),
+			wantQuery: "SELECT MIN(total) FROM orders GROUP BY user_id, status",
+			wantArgs:  []interface{}{},
+		},
+		{
+			name:      "max with where",
+			builder:   NewBuilder("orders").SelectMax("created_at").Where("user_id = ?", 7),
+			wantQuery: "SELECT MAX(created_at) FROM orders WHERE user_id = ?",
+			wantArgs:  []interface{}{7},
+		},
+		{
+			name:      "avg with where, group by and order by",
+			builder:   NewBuilder("orders").SelectAvg("total").Where("total > ?", 0).GroupBy("user_id").OrderBy("user_id"),
+			wantQuery: "SELECT AVG(total) FROM orders WHERE total > ? GROUP BY user_id ORDER BY user_id",
+			wantArgs:  []interface{}{0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotQuery, gotArgs := tt.builder.Build()
+			if gotQuery != tt.wantQuery {
+				t.Errorf("Builder.Build() gotQuery = %v, want %v", gotQuery, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+				t.Errorf("Builder.Build() gotArgs = %v, want %v", gotArgs, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestBuilder_WhereExists(t *testing.T) {
+	posts := NewBuilder("posts").
+		Where("posts.user_id = users.id").
+		Where("posts.published = ?", true)
+
+	tests := []struct {
+		name      string
+		builder   *Builder
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "exists",
+			builder:   NewBuilder("users").Select("id", "name").WhereExists(posts),
+			wantQuery: "SELECT id, name FROM users WHERE EXISTS (SELECT 1 FROM posts WHERE posts.user_id = users.id AND posts.published = ?)",
+			wantArgs:  []interface{}{true},
+		},
+		{
+			name:      "not exists with outer where",
+			builder:   NewBuilder("users").Select().Where("age > ?", 18).WhereNotExists(posts),
+			wantQuery: "SELECT * FROM users WHERE NOT EXISTS (SELECT 1 FROM posts WHERE posts.user_id = users.id AND posts.published = ?) AND age > ?",
+			wantArgs:  []interface{}{true, 18},
+		},
+		{
+			name: "nested subqueries",
+			builder: NewBuilder("users").Select("id").Where("status = ?", "active").WhereExists(
+				NewBuilder("posts").
+					Where("posts.user_id = users.id").
+					WhereExists(NewBuilder("comments").Where("comments.post_id = posts.id").Where("comments.flagged = ?", false)),
+			),
+			wantQuery: "SELECT id FROM users WHERE EXISTS (SELECT 1 FROM posts WHERE EXISTS (SELECT 1 FROM comments WHERE comments.post_id = posts.id AND comments.flagged = ?) AND posts.user_id = users.id) AND status = ?",
+			wantArgs:  []interface{}{false, "active"},
+		},
+		{
+			name:      "subquery with explicit columns",
+			builder:   NewBuilder("users").Select("id").WhereExists(NewBuilder("posts").Select("id").Where("posts.user_id = users.id")),
+			wantQuery: "SELECT id FROM users WHERE EXISTS (SELECT id FROM posts WHERE posts.user_id = users.id)",
+			wantArgs:  []interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotQuery, gotArgs := tt.builder.Build()
+			if gotQuery != tt.wantQuery {
+				t.Errorf("Builder.Build() gotQuery = %v, want %v", gotQuery, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+				t.Errorf("Builder.Build() gotArgs = %v, want %v", gotArgs, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestBuilder_With(t *testing.T) {
+	active := NewBuilder("users").Select("id", "name").Where("status = ?", "active")
+	recent := NewBuilder("posts").Select("user_id").Where("created_at > ?", 1700000000)
+
+	tests := []struct {
+		name      string
+		builder   *Builder
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "single cte",
+			builder:   NewBuilder("active_users").Select("name").With("active_users", active).Where("name LIKE ?", "A%"),
+			wantQuery: "WITH active_users AS (SELECT id, name FROM users WHERE status = ?) SELECT name FROM active_users WHERE name LIKE ?",
+			wantArgs:  []interface{}{"active", "A%"},
+		},
+		{
+			name: "multiple ctes",
+			builder: NewBuilder("active_users").
+				Select("name").
+				With("active_users", active).
+				With("recent_posters", recent).
+				Where("id IN (SELECT user_id FROM recent_posters)").
+				Where("name <> ?", "admin"),
+			wantQuery: "WITH active_users AS (SELECT id, name FROM users WHERE status = ?), recent_posters AS (SELECT user_id FROM posts WHERE created_at > ?) SELECT name FROM active_users WHERE id IN (SELECT user_id FROM recent_posters) AND name <> ?",
+			wantArgs:  []interface{}{"active", 1700000000, "admin"},
+		},
+		{
+			name:      "cte without select",
+			builder:   NewBuilder("admins").Select().With("admins", NewBuilder("users").Where("role = ?", "admin")),
+			wantQuery: "WITH admins AS (SELECT * FROM users WHERE role = ?) SELECT * FROM admins",
+			wantArgs:  []interface{}{"admin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotQuery, gotArgs := tt.builder.Build()
+			if gotQuery != tt.wantQuery {
+				t.Errorf("Builder.Build() gotQuery = %v, want %v", gotQuery, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+				t.Errorf("Builder.Build() gotArgs = %v, want %v", gotArgs, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestBuilder_WithRecursive(t *testing.T) {
+	anchor := NewBuilder("categories").Select("id", "parent_id", "name").Where("id = ?", 1)
+	recursive := NewBuilder("categories c").
+		Select("c.id", "c.parent_id", "c.name").
+		Join("JOIN tree t ON c.parent_id = t.id").
+		Where("c.name <> ?", "archived")
+
+	gotQuery, gotArgs := NewBuilder("tree").
+		Select("name").
+		WithRecursive("tree(id, parent_id, name)", anchor, recursive).
+		OrderBy("name").
+		Build()
+
+	wantQuery := "WITH RECURSIVE tree(id, parent_id, name) AS (" +
+		"SELECT id, parent_id, name FROM categories WHERE id = ? UNION ALL " +
+		"SELECT c.id, c.parent_id, c.name FROM categories c JOIN tree t ON c.parent_id = t.id WHERE c.name <> ?" +
+		") SELECT name FROM tree ORDER BY name"
+	if gotQuery != wantQuery {
+		t.Errorf("Builder.Build() gotQuery = %v, want %v", gotQuery, wantQuery)
+	}
+	for _, want := range []string{"WITH RECURSIVE", "UNION ALL", "FROM categories c JOIN tree t", "FROM tree"} {
+		if !strings.Contains(gotQuery, want) {
+			t.Errorf("expected query to contain %q, got %q", want, gotQuery)
+		}
+	}
+	if wantArgs := []interface{}{1, "archived"}; !reflect.DeepEqual(gotArgs, wantArgs) {
+		t.Errorf("Builder.Build() gotArgs = %v, want %v", gotArgs, wantArgs)
+	}
+
+	// RECURSIVE appears once, before all CTEs
+	gotQuery, _ = NewBuilder("tree").
+		With("roots", NewBuilder("categories").Where("parent_id IS NULL")).
+		WithRecursive("tree", NewBuilder("roots"), recursive).
+		Select().
+		Build()
+	if !strings.HasPrefix(gotQuery, "WITH RECURSIVE roots AS (SELECT * FROM categories WHERE parent_id IS NULL), tree AS (SELECT * FROM roots UNION ALL ") ||
+		strings.Count(gotQuery, "RECURSIVE") != 1 {
+		t.Errorf("unexpected query with mixed CTEs: %q", gotQuery)
+	}
+}
+
+func TestBuilder_Write(t *testing.T) {
+	tests := []struct {
+		name      string
+		builder   *Builder
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "insert",
+			builder:   NewBuilder("users").Insert([]string{"name", "email"}, []interface{}{"John", "john@example.com"}),
+			wantQuery: "INSERT INTO users (name, email) VALUES (?, ?)",
+			wantArgs:  []interface{}{"John", "john@example.com"},
+		},
+		{
+			name:      "update",
+			builder:   NewBuilder("users").Update([]string{"name", "email"}, []interface{}{"Jane", "jane@example.com"}).Where("id = ?", 1),
+			wantQuery: "UPDATE users SET name = ?, email = ? WHERE id = ?",
+			wantArgs:  []interface{}{"Jane", "jane@example.com", 1},
+		},
+		{
+			name:      "delete",
+			builder:   NewBuilder("users").Delete().Where("id = ?", 1).OrderBy("id").Limit(1),
+			wantQuery: "DELETE FROM users WHERE id = ?",
+			wantArgs:  []interface{}{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotQuery, gotArgs := tt.builder.Build()
+			if gotQuery != tt.wantQuery {
+				t.Errorf("Builder.Build() gotQuery = %v, want %v", gotQuery, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+				t.Errorf("Builder.Build() gotArgs = %v, want %v", gotArgs, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestBuilder_String(t *testing.T) {
+	b := NewBuilder("users").
+		Select("id", "name").
+		Where("age > ?", 18).
+		Where("status IN (?, ?)", "active", "pending").
+		Limit(10)
+
+	want := "SELECT id, name FROM users WHERE age > <arg_1> AND status IN (<arg_2>, <arg_3>) LIMIT 10"
+	if got := b.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := fmt.Sprint(b); got != want {
+		t.Errorf("fmt.Sprint() = %q, want %q", got, want)
+	}
+
+	// Build still returns the placeholders and the original args
+	sql, args := b.Build()
+	if sql != "SELECT id, name FROM users WHERE age > ? AND status IN (?, ?) LIMIT 10" {
+		t.Errorf("Build() sql = %q", sql)
+	}
+	if !reflect.DeepEqual(args, []interface{}{18, "active", "pending"}) {
+		t.Errorf("Build() args = %v", args)
+	}
+
+	if got := NewBuilder("users").Select().String(); got != "SELECT * FROM users" {
+		t.Errorf("String() = %q, want %q", got, "SELECT * FROM users")
+	}
+}
+
+func TestBuilder_Join(t *testing.T) {
+	b := NewBuilder("users u").
+		Select("u.name", "p.title").
+		Join("JOIN posts p ON p.user_id = u.id").
+		Join("LEFT JOIN comments c ON c.post_id = p.id").
+		Where("u.active = ?", true)
+
+	wantQuery := "SELECT u.name, p.title FROM users u JOIN posts p ON p.user_id = u.id LEFT JOIN comments c ON c.post_id = p.id WHERE u.active = ?"
+	gotQuery, _ := b.Build()
+	if gotQuery != wantQuery {
+		t.Errorf("Build() gotQuery = %v, want %v", gotQuery, wantQuery)
+	}
+
+	clone := b.Clone().Join("JOIN tags t ON t.post_id = p.id")
+	if gotQuery, _ := b.Build(); gotQuery != wantQuery {
+		t.Errorf("Join on clone changed original: %v", gotQuery)
+	}
+	if cloneQuery, _ := clone.Build(); cloneQuery == wantQuery {
+		t.Error("expected clone to have the extra join")
+	}
+}
+
+func BenchmarkBuilderBuild(b *testing.B) {
+	builder := NewBuilder("users u").
+		Select("u.id", "u.name", "p.title", "c.body").
+		Join("JOIN posts p ON p.user_id = u.id").
+		Join("LEFT JOIN comments c ON c.post_id = p.id").
+		Join("JOIN accounts a ON a.id = u.account_id").
+		Where("u.age > ?", 18).
+		Where("u.status = ?", "active").
+		Where("p.published = ?", true).
+		Where("c.flagged = ?", false).
+		Where("a.plan IN (?, ?)", "pro", "team").
+		Where("u.created_at > ?", "2024-01-01").
+		OrderBy("u.name ASC").
+		Limit(50).
+		Offset(100)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		builder.Build()
+	}
+}
+
+func FuzzBuilderWhere(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"alice",
+		"?",
+		"' OR '1'='1",
+		"1; DROP TABLE users; --",
+		"%s %d %v",
+		"name = ? AND 1=1",
+		"\x00\n\t",
+		"caf\u00e9 \U0001F600",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		query, args := NewBuilder("users").
+			Select("id").
+			Where("name = ?", value).
+			Where("email = ? OR nickname = ?", value, value).
+			Limit(1).
+			Build()
+
+		want := "SELECT id FROM users WHERE name = ? AND email = ? OR nickname = ? LIMIT 1"
+		if query != want {
+			t.Fatalf("Build() query = %q, want %q", query, want)
+		}
+		if placeholders := strings.Count(query, "?"); placeholders != len(args) {
+			t.Fatalf("query has %d placeholders for %d args", placeholders, len(args))
+		}
+		for i, arg := range args {
+			if arg != value {
+				t.Fatalf("arg %d = %#v, want %#v", i, arg, value)
+			}
+		}
+		if value != "" && !strings.Contains(want, value) && strings.Contains(query, value) {
+			t.Fatalf("query %q contains the raw value %q", query, value)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package query
+
+import "strings"
+
+// CaseExpr is a SQL expression that can be selected like a column
+type CaseExpr interface {
+	SQL() string
+	Args() []interface{}
+}
+
+// CaseWhen builds a CASE WHEN ... THEN ... ELSE ... END expression
+type CaseWhen struct {
+	branches []caseBranch
+	elseCase *caseBranch
+	alias    string
+}
+
+// caseBranch is a single WHEN condition and its result
+type caseBranch struct {
+	condition string
+	result    string
+	args      []interface{}
+}
+
+// NewCaseWhen creates an empty CASE expression
+func NewCaseWhen() *CaseWhen {
+	return &CaseWhen{}
+}
+
+// When adds a WHEN condition THEN result branch. The args fill the
+// placeholders in the condition and result, in that order.
+func (c *CaseWhen) When(condition, result string, args ...interface{}) *CaseWhen {
+	c.branches = append(c.branches, caseBranch{condition: condition, result: result, args: args})
+	return c
+}
+
+// Else sets the result used when no branch matches
+func (c *CaseWhen) Else(result string, args ...interface{}) *CaseWhen {
+	c.elseCase = &caseBranch{result: result, args: args}
+	return c
+}
+
+// As sets the alias of the expression in the SELECT list
+func (c *CaseWhen) As(alias string) *CaseWhen {
+	c.alias = alias
+	return c
+}
+
+// SQL returns the CASE expression
+func (c *CaseWhen) SQL() string {
+	var sql strings.Builder
+	sql.WriteString("CASE")
+	for _, branch := range c.branches {
+		sql.WriteString(" WHEN ")
+		sql.WriteString(branch.condition)
+		sql.WriteString(" THEN ")
+		sql.WriteString(branch.result)
+	}
+	if c.elseCase != nil {
+		sql.WriteString(" ELSE ")
+		sql.WriteString(c.elseCase.result)
+	}
+	sql.WriteString(" END")
+	if c.alias != "" {
+		sql.WriteString(" AS ")
+		sql.WriteString(c.alias)
+	}
+	return sql.String()
+}
+
+// Args returns the arguments of all branches in the order they appear
+func (c *CaseWhen) Args() []interface{} {
+	var args []interface{}
+	for _, branch := range c.branches {
+		args = append(args, branch.args...)
+	}
+	if c.elseCase != nil {
+		args = append(args, c.elseCase.args...)
+	}
+	return args
+}
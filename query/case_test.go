@@ -0,0 +1,69 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCaseWhen(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     *CaseWhen
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:    "single branch with else",
+			expr:    NewCaseWhen().When("status = 'active'", "'Active'").Else("'Unknown'").As("status_label"),
+			wantSQL: "CASE WHEN status = 'active' THEN 'Active' ELSE 'Unknown' END AS status_label",
+		},
+		{
+			name: "several branches",
+			expr: NewCaseWhen().
+				When("status = 'active'", "'Active'").
+				When("status = 'inactive'", "'Inactive'").
+				Else("'Unknown'").
+				As("status_label"),
+			wantSQL: "CASE WHEN status = 'active' THEN 'Active' WHEN status = 'inactive' THEN 'Inactive' ELSE 'Unknown' END AS status_label",
+		},
+		{
+			name:     "args in order of appearance",
+			expr:     NewCaseWhen().Else("?", "other").When("age < ?", "?", 18, "minor"),
+			wantSQL:  "CASE WHEN age < ? THEN ? ELSE ? END",
+			wantArgs: []interface{}{18, "minor", "other"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.expr.SQL(); got != tt.wantSQL {
+				t.Errorf("CaseWhen.SQL() = %v, want %v", got, tt.wantSQL)
+			}
+			if got := tt.expr.Args(); !reflect.DeepEqual(got, tt.wantArgs) {
+				t.Errorf("CaseWhen.Args() = %v, want %v", got, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestBuilder_SelectExpr(t *testing.T) {
+	label := NewCaseWhen().
+		When("age < ?", "'minor'", 18).
+		Else("'adult'").
+		As("age_group")
+
+	gotQuery, gotArgs := NewBuilder("users").
+		Select("id", "name").
+		SelectExpr(label).
+		Where("status = ?", "active").
+		Build()
+
+	wantQuery := "SELECT id, name, CASE WHEN age < ? THEN 'minor' ELSE 'adult' END AS age_group FROM users WHERE status = ?"
+	if gotQuery != wantQuery {
+		t.Errorf("Builder.Build() gotQuery = %v, want %v", gotQuery, wantQuery)
+	}
+	wantArgs := []interface{}{18, "active"}
+	if !reflect.DeepEqual(gotArgs, wantArgs) {
+		t.Errorf("Builder.Build() gotArgs = %v, want %v", gotArgs, wantArgs)
+	}
+}
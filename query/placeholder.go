@@ -0,0 +1,40 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Rebind rewrites the ? placeholders of sql as the numbered $1, $2, ...
+// placeholders PostgreSQL drivers expect. Question marks inside quoted
+// strings and identifiers are left alone.
+func Rebind(sql string) string {
+	if !strings.Contains(sql, "?") {
+		return sql
+	}
+
+	var out strings.Builder
+	out.Grow(len(sql) + 8)
+	n := 0
+	var quote byte
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0:
+			// A doubled quote is an escaped quote, which the next iteration
+			// treats as reopening the string
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			out.WriteByte('$')
+			out.Write(strconv.AppendInt(nil, int64(n), 10))
+			continue
+		}
+		out.WriteByte(c)
+	}
+	return out.String()
+}
@@ -0,0 +1,26 @@
+package query
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{"no placeholders", "SELECT * FROM users", "SELECT * FROM users"},
+		{"insert", "INSERT INTO users (name, email) VALUES (?, ?)", "INSERT INTO users (name, email) VALUES ($1, $2)"},
+		{"where", "SELECT id FROM users WHERE (age > ?) AND (status IN (?, ?))", "SELECT id FROM users WHERE (age > $1) AND (status IN ($2, $3))"},
+		{"quoted", "SELECT '?', \"what?\" FROM t WHERE a = ?", "SELECT '?', \"what?\" FROM t WHERE a = $1"},
+		{"escaped quote", "SELECT 'it''s?' FROM t WHERE a = ? AND b = ?", "SELECT 'it''s?' FROM t WHERE a = $1 AND b = $2"},
+		{"many", "VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", "VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Rebind(tt.sql); got != tt.want {
+				t.Errorf("Rebind() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
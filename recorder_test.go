@@ -0,0 +1,213 @@
+package theory
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+)
+
+// recorderDriver is a fake database/sql driver that records executed
+// statements. It is registered under the names of drivers that are not
+// available in tests, so dialect-specific code paths can be exercised.
+type recorderDriver struct{}
+
+var (
+	recordersMu sync.Mutex
+	recorders   = make(map[string]*recorder)
+)
+
+func init() {
+	sql.Register("postgres", recorderDriver{})
+	sql.Register("mysql", recorderDriver{})
+}
+
+// recorder holds the statements executed against one fake database
+type recorder struct {
+	mu      sync.Mutex
+	queries []string
+	args    [][]interface{}
+
+	// result optionally supplies rows for queries
+	result func(query string) ([]string, [][]driver.Value)
+
+	// stmtsClosed counts the prepared statements closed
+	stmtsClosed int
+
+	// failOpens makes the next connection attempts fail; opens counts them
+	failOpens int
+	opens     int
+}
+
+// newRecorder registers a recorder and returns it with its DSN. The DSN
+// passes Config.Validate for both postgres and mysql.
+func newRecorder(t *testing.T) (*recorder, string) {
+	rec := &recorder{}
+	dsn := fmt.Sprintf("postgres://recorder/%s", t.Name())
+
+	recordersMu.Lock()
+	recorders[dsn] = rec
+	recordersMu.Unlock()
+
+	t.Cleanup(func() {
+		recordersMu.Lock()
+		delete(recorders, dsn)
+		recordersMu.Unlock()
+	})
+
+	return rec, dsn
+}
+
+// Queries returns the recorded statements
+func (r *recorder) Queries() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.queries...)
+}
+
+// StmtsClosed returns the number of prepared statements closed
+func (r *recorder) StmtsClosed() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stmtsClosed
+}
+
+// LastQuery returns the most recent statement and its arguments
+func (r *recorder) LastQuery() (string, []interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.queries) == 0 {
+		return "", nil
+	}
+	return r.queries[len(r.queries)-1], r.args[len(r.args)-1]
+}
+
+func (r *recorder) record(query string, args []driver.NamedValue) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	r.queries = append(r.queries, query)
+	r.args = append(r.args, values)
+}
+
+func (recorderDriver) Open(dsn string) (driver.Conn, error) {
+	recordersMu.Lock()
+	rec, ok := recorders[dsn]
+	recordersMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown recorder %q", dsn)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.opens++
+	if rec.failOpens > 0 {
+		rec.failOpens--
+		return nil, errors.New("connection refused")
+	}
+	return &recorderConn{rec: rec}, nil
+}
+
+type recorderConn struct {
+	rec *recorder
+}
+
+func (c *recorderConn) Prepare(query string) (driver.Stmt, error) {
+	return &recorderStmt{conn: c, query: query}, nil
+}
+
+func (c *recorderConn) Close() error {
+	return nil
+}
+
+func (c *recorderConn) Begin() (driver.Tx, error) {
+	return recorderTx{}, nil
+}
+
+func (c *recorderConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.rec.record(query, args)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *recorderConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.rec.record(query, args)
+
+	rows := &recorderRows{}
+	if c.rec.result != nil {
+		rows.columns, rows.values = c.rec.result(query)
+	}
+	return rows, nil
+}
+
+type recorderStmt struct {
+	conn  *recorderConn
+	query string
+}
+
+func (s *recorderStmt) Close() error {
+	s.conn.rec.mu.Lock()
+	defer s.conn.rec.mu.Unlock()
+	s.conn.rec.stmtsClosed++
+	return nil
+}
+
+func (s *recorderStmt) NumInput() int {
+	return -1
+}
+
+func (s *recorderStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, namedValues(args))
+}
+
+func (s *recorderStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, namedValues(args))
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+type recorderTx struct{}
+
+func (recorderTx) Commit() error {
+	return nil
+}
+
+func (recorderTx) Rollback() error {
+	return nil
+}
+
+type recorderRows struct {
+	columns []string
+	values  [][]driver.Value
+	pos     int
+}
+
+func (r *recorderRows) Columns() []string {
+	return r.columns
+}
+
+func (r *recorderRows) Close() error {
+	return nil
+}
+
+func (r *recorderRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.pos])
+	r.pos++
+	return nil
+}
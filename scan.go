@@ -0,0 +1,104 @@
+package theory
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"github.com/wilburhimself/theory/model"
+)
+
+// destination describes where query results are scanned into: a single
+// struct, or a slice of structs or struct pointers
+type destination struct {
+	value    reflect.Value
+	elemType reflect.Type
+	isSlice  bool
+	isPtr    bool
+}
+
+// parseDest validates dest and returns its destination
+func parseDest(dest interface{}) (*destination, error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil, fmt.Errorf("destination must be a pointer")
+	}
+
+	d := &destination{value: v.Elem(), elemType: v.Elem().Type()}
+	if d.elemType.Kind() == reflect.Slice {
+		d.isSlice = true
+		d.elemType = d.elemType.Elem()
+		if d.elemType.Kind() == reflect.Ptr {
+			d.isPtr = true
+			d.elemType = d.elemType.Elem()
+		}
+	}
+
+	if d.elemType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("destination must point to a struct or a slice of structs, got %s", v.Type())
+	}
+
+	return d, nil
+}
+
+// metadata returns the model metadata of the destination's element type,
+// named with the given strategy
+func (d *destination) metadata(naming NamingStrategy) (*model.Metadata, error) {
+	return model.ExtractMetadataWith(reflect.New(d.elemType).Interface(), naming)
+}
+
+// scan reads rows into the destination, matching columns to fields by their
+// database name. Columns without a matching field are skipped. For a single
+// struct only the first row is read. It reports whether any row was found.
+func (d *destination) scan(rows *sql.Rows, fields []model.Field) (bool, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return false, err
+	}
+
+	byColumn := make(map[string]*model.Field, len(fields))
+	for i := range fields {
+		byColumn[fields[i].DBName] = &fields[i]
+	}
+
+	if d.isSlice {
+		d.value.Set(reflect.MakeSlice(d.value.Type(), 0, 0))
+	}
+
+	found := false
+	for rows.Next() {
+		found = true
+		instance := reflect.New(d.elemType)
+
+		scanDest := make([]interface{}, len(columns))
+		for i, column := range columns {
+			field, ok := byColumn[column]
+			if !ok {
+				scanDest[i] = new(interface{})
+				continue
+			}
+			fv := instance.Elem().FieldByName(field.Name)
+			if field.IsJSON() {
+				scanDest[i] = jsonScanner{field: fv}
+				continue
+			}
+			scanDest[i] = fv.Addr().Interface()
+		}
+
+		if err := rows.Scan(scanDest...); err != nil {
+			return found, err
+		}
+
+		if !d.isSlice {
+			d.value.Set(instance.Elem())
+			break
+		}
+		if d.isPtr {
+			d.value.Set(reflect.Append(d.value, instance))
+		} else {
+			d.value.Set(reflect.Append(d.value, instance.Elem()))
+		}
+	}
+
+	return found, rows.Err()
+}
@@ -0,0 +1,157 @@
+package theory
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/wilburhimself/theory/migration"
+)
+
+// GetColumns returns the columns of a table as they exist in the database.
+// On SQLite the declared types and primary keys are reported; on other
+// databases IsPK is not set and types use the database's own names.
+func (db *DB) GetColumns(ctx context.Context, table string) ([]migration.Column, error) {
+	db = db.inContextTx(ctx)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var sql string
+	switch {
+	case db.isSQLite():
+		sql = "SELECT name, type, pk > 0, \"notnull\" = 0 AND pk = 0 FROM pragma_table_info(?) ORDER BY cid"
+	case db.driver == "mysql":
+		sql = "SELECT column_name, column_type, false, is_nullable = 'YES' FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? ORDER BY ordinal_position"
+	default:
+		sql = "SELECT column_name, data_type, false, is_nullable = 'YES' FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? ORDER BY ordinal_position"
+	}
+
+	rows, release, err := db.query(ctx, db.Primary(), sql, table)
+	if err != nil {
+		return nil, wrapError("get columns", table, err)
+	}
+	defer release()
+	defer rows.Close()
+
+	var columns []migration.Column
+	for rows.Next() {
+		var col migration.Column
+		if err := rows.Scan(&col.Name, &col.Type, &col.IsPK, &col.IsNull); err != nil {
+			return nil, wrapError("get columns", table, err)
+		}
+		columns = append(columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapError("get columns", table, err)
+	}
+	return columns, nil
+}
+
+// ColumnTypes returns the result columns of a query without reading any
+// rows: the query runs as a subquery limited to zero rows. The reported
+// details depend on the driver; SQLite, for one, reports every column as
+// nullable.
+func (db *DB) ColumnTypes(ctx context.Context, query string, args ...interface{}) ([]*sql.ColumnType, error) {
+	db = db.inContextTx(ctx)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query = "SELECT * FROM (" + query + ") AS q LIMIT 0"
+	if db.dryRun {
+		db.logDryRun(query, args)
+		return nil, nil
+	}
+
+	rows, release, err := db.query(ctx, db.Primary(), query, args...)
+	if err != nil {
+		return nil, wrapError("column types", "", err)
+	}
+	defer release()
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, wrapError("column types", "", err)
+	}
+	return columnTypes, nil
+}
+
+// baseType returns a column type without parameters, in upper case, so
+// VARCHAR(100) and varchar compare equal
+func baseType(sqlType string) string {
+	if i := strings.Index(sqlType, "("); i >= 0 {
+		sqlType = sqlType[:i]
+	}
+	return strings.ToUpper(strings.TrimSpace(sqlType))
+}
+
+// tableExists reports whether the table exists in the database
+func (db *DB) tableExists(ctx context.Context, table string) (bool, error) {
+	var sql string
+	switch {
+	case db.isSQLite():
+		sql = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	case db.driver == "mysql":
+		sql = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+	default:
+		sql = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+	}
+
+	var count int
+	if err := db.queryRow(ctx, sql, []interface{}{table}, &count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// indexNames returns the names of the indexes created on a table. Indexes
+// backing primary keys and inline unique constraints are not included.
+func (db *DB) indexNames(ctx context.Context, table string) (map[string]bool, error) {
+	var sql string
+	switch {
+	case db.isSQLite():
+		sql = "SELECT name FROM pragma_index_list(?) WHERE origin = 'c'"
+	case db.driver == "mysql":
+		sql = "SELECT DISTINCT index_name FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name <> 'PRIMARY'"
+	default:
+		sql = "SELECT i.relname FROM pg_index x JOIN pg_class i ON i.oid = x.indexrelid JOIN pg_class t ON t.oid = x.indrelid WHERE t.relname = ? AND NOT x.indisprimary AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = x.indexrelid)"
+	}
+
+	rows, release, err := db.query(ctx, db.Primary(), sql, table)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	defer rows.Close()
+
+	names := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names[name] = true
+	}
+	return names, rows.Err()
+}
+
+// queryRow runs a query on the primary and scans its first row into dest
+func (db *DB) queryRow(ctx context.Context, query string, args []interface{}, dest ...interface{}) error {
+	rows, release, err := db.query(ctx, db.Primary(), query, args...)
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return ErrRecordNotFound
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return err
+	}
+	return rows.Close()
+}
@@ -0,0 +1,469 @@
+package theory
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/wilburhimself/theory/model"
+	"github.com/wilburhimself/theory/query"
+)
+
+// Scope collects settings for a single operation, such as the model and
+// table to use. Scopes are created with DB.Model and are not meant to be
+// reused across operations.
+type Scope struct {
+	db       *DB
+	model    interface{}
+	table    string
+	columns  []string
+	omit     map[string]bool
+	where    []condition
+	order    string
+	limit    int
+	offset   int
+	unscoped bool
+}
+
+// condition is a WHERE condition and its arguments
+type condition struct {
+	sql  string
+	args []interface{}
+}
+
+// Model starts a scope for operations on the given model type. The model's
+// table is used unless overridden with Table.
+func (db *DB) Model(m interface{}) *Scope {
+	return &Scope{db: db, model: m}
+}
+
+// scope starts an empty scope, taking the table from each operation's model
+func (db *DB) scope() *Scope {
+	return &Scope{db: db}
+}
+
+// Table overrides the table name, so models can be read from and written to
+// tables with the same layout, such as archive tables
+func (s *Scope) Table(name string) *Scope {
+	s.table = name
+	return s
+}
+
+// Select limits the columns read by Find. Fields of unselected columns are
+// left at their zero value.
+func (s *Scope) Select(columns ...string) *Scope {
+	s.columns = columns
+	return s
+}
+
+// Omit excludes columns from the INSERT and UPDATE statements of Create and
+// Update
+func (s *Scope) Omit(columns ...string) *Scope {
+	if s.omit == nil {
+		s.omit = make(map[string]bool, len(columns))
+	}
+	for _, column := range columns {
+		s.omit[column] = true
+	}
+	return s
+}
+
+// Omit starts a scope that excludes columns from Create and Update
+func (db *DB) Omit(columns ...string) *Scope {
+	return db.scope().Omit(columns...)
+}
+
+// Unscoped disables soft deletes for the scope: Find includes soft-deleted
+// records and Delete removes records for good
+func (s *Scope) Unscoped() *Scope {
+	s.unscoped = true
+	return s
+}
+
+// Unscoped starts a scope with soft deletes disabled
+func (db *DB) Unscoped() *Scope {
+	return db.scope().Unscoped()
+}
+
+// Where adds a condition to the scope
+func (s *Scope) Where(query string, args ...interface{}) *Scope {
+	s.where = append(s.where, condition{sql: query, args: args})
+	return s
+}
+
+// Where starts a scope with a condition. The table is taken from each
+// operation's model, or for Count from Table.
+func (db *DB) Where(query string, args ...interface{}) *Scope {
+	return db.scope().Where(query, args...)
+}
+
+// Limit caps the number of records read by Find. Count ignores it.
+func (s *Scope) Limit(n int) *Scope {
+	s.limit = n
+	return s
+}
+
+// tableName returns the table the scope operates on: the Table override,
+// the scope model's table or the table of the operation's model
+func (s *Scope) tableName(metadata *model.Metadata) (string, error) {
+	if s.table != "" {
+		return s.table, nil
+	}
+	if s.model != nil {
+		scopeMetadata, err := s.db.metadata(s.model)
+		if err != nil {
+			return "", err
+		}
+		return scopeMetadata.TableName, nil
+	}
+	return metadata.TableName, nil
+}
+
+// applyWhere adds the scope's conditions to builder, followed by the soft
+// delete filter when metadata has a soft delete field and the scope is not
+// Unscoped
+func (s *Scope) applyWhere(builder *query.Builder, metadata *model.Metadata) {
+	var softDelete *model.Field
+	if metadata != nil && !s.unscoped {
+		softDelete = metadata.SoftDeleteField()
+	}
+
+	combined := len(s.where) > 1 || len(s.where) == 1 && softDelete != nil
+	for _, c := range s.where {
+		if combined {
+			builder.Where(parenthesize(c.sql), c.args...)
+		} else {
+			builder.Where(c.sql, c.args...)
+		}
+	}
+	if softDelete != nil {
+		builder.Where(fmt.Sprintf("%s IS NULL", softDelete.DBName))
+	}
+}
+
+// parenthesize wraps a condition combined with others in parentheses, so an
+// OR in it does not take the others with it
+func parenthesize(condition string) string {
+	return "(" + condition + ")"
+}
+
+// Create inserts a new record
+func (s *Scope) Create(ctx context.Context, m interface{}) error {
+	db := s.db.inContextTx(ctx)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	metadata, err := db.metadata(m)
+	if err != nil {
+		return err
+	}
+	table, err := s.tableName(metadata)
+	if err != nil {
+		return err
+	}
+
+	if err := db.runHook(ctx, m, "BeforeCreate"); err != nil {
+		return err
+	}
+
+	// Build query
+	var columns []string
+	var values []interface{}
+
+	v := reflect.ValueOf(m)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	for i := range metadata.Fields {
+		field := &metadata.Fields[i]
+		if field.UsesPKStrategy() && !s.omit[field.DBName] {
+			if err := db.generatePK(v, field); err != nil {
+				return wrapError("create", table, err)
+			}
+		}
+		if (!field.IsAuto || field.UsesPKStrategy()) && !field.IsGenerated() && !s.omit[field.DBName] {
+			value, err := columnValue(v, field)
+			if err != nil {
+				return wrapError("create", table, err)
+			}
+			columns = append(columns, field.DBName)
+			values = append(values, value)
+		}
+	}
+
+	sql, args := query.NewBuilder(table).Insert(columns, values).Build()
+
+	var autoField *model.Field
+	for i := range metadata.Fields {
+		if metadata.Fields[i].IsAuto && !metadata.Fields[i].UsesPKStrategy() {
+			autoField = &metadata.Fields[i]
+			break
+		}
+	}
+
+	if autoField != nil && db.isPostgres() {
+		// PostgreSQL drivers do not support LastInsertId, so the generated
+		// key is read back with RETURNING instead
+		sql += " RETURNING " + autoField.DBName
+		if db.dryRun {
+			db.logDryRun(sql, args)
+		} else if err := db.queryRow(ctx, sql, args, v.FieldByName(autoField.Name).Addr().Interface()); err != nil {
+			return wrapError("create", table, err)
+		}
+	} else {
+		// Execute query
+		result, err := db.exec(ctx, sql, args...)
+		if err != nil {
+			return wrapError("create", table, err)
+		}
+
+		// Get last insert ID if available
+		if autoField != nil {
+			if id, err := result.LastInsertId(); err == nil {
+				v.FieldByName(autoField.Name).SetInt(id)
+			}
+		}
+	}
+
+	return db.runHook(ctx, m, "AfterCreate")
+}
+
+// Find retrieves the records matching the scope's conditions
+func (s *Scope) Find(ctx context.Context, dest interface{}) error {
+	db := s.db.inContextTx(ctx)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	d, err := parseDest(dest)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := d.metadata(db.naming)
+	if err != nil {
+		return err
+	}
+	table, err := s.tableName(metadata)
+	if err != nil {
+		return err
+	}
+
+	// Build query
+	builder := query.NewBuilder(table).Select(s.columns...)
+	s.applyWhere(builder, metadata)
+	if s.order != "" {
+		builder.OrderBy(s.order)
+	}
+	if s.limit > 0 {
+		builder.Limit(s.limit)
+	}
+	if s.offset > 0 {
+		builder.Offset(s.offset)
+	}
+	sql, args := builder.Build()
+
+	if db.dryRun {
+		db.logDryRun(sql, args)
+		return nil
+	}
+
+	// Execute query
+	rows, release, err := db.query(ctx, db.Replica(), sql, args...)
+	if err != nil {
+		return wrapError("find", table, err)
+	}
+	defer release()
+	defer rows.Close()
+
+	found, err := d.scan(rows, metadata.Fields)
+	if err != nil {
+		return wrapError("find", table, err)
+	}
+
+	if !d.isSlice && !found {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Count returns the number of records matching the scope's conditions,
+// ignoring any limit or offset. The table is the Table override or the
+// scope model's table; soft-deleted records of the model are not counted
+// unless the scope is Unscoped.
+func (s *Scope) Count(ctx context.Context) (int64, error) {
+	db := s.db.inContextTx(ctx)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	table := s.table
+	var metadata *model.Metadata
+	if s.model != nil {
+		var err error
+		metadata, err = db.metadata(s.model)
+		if err != nil {
+			return 0, err
+		}
+		if table == "" {
+			table = metadata.TableName
+		}
+	}
+	if table == "" {
+		return 0, fmt.Errorf("count requires a table: use Model or Table")
+	}
+
+	builder := query.NewBuilder(table).SelectCount("*")
+	s.applyWhere(builder, metadata)
+	sql, args := builder.Build()
+
+	if db.dryRun {
+		db.logDryRun(sql, args)
+		return 0, nil
+	}
+
+	rows, release, err := db.query(ctx, db.Replica(), sql, args...)
+	if err != nil {
+		return 0, wrapError("count", table, err)
+	}
+	defer release()
+	defer rows.Close()
+
+	var count int64
+	if rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, wrapError("count", table, err)
+		}
+	}
+	return count, wrapError("count", table, rows.Err())
+}
+
+// Update updates a record by primary key
+func (s *Scope) Update(ctx context.Context, m interface{}) error {
+	db := s.db.inContextTx(ctx)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	metadata, err := db.metadata(m)
+	if err != nil {
+		return err
+	}
+	table, err := s.tableName(metadata)
+	if err != nil {
+		return err
+	}
+
+	if err := db.runHook(ctx, m, "BeforeUpdate"); err != nil {
+		return err
+	}
+
+	// Build query
+	var columns []string
+	var values []interface{}
+	var pkField *model.Field
+	var pkValue interface{}
+
+	v := reflect.ValueOf(m)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	for i := range metadata.Fields {
+		field := &metadata.Fields[i]
+		if field.IsPK {
+			pkField = field
+			pkValue = v.FieldByName(field.Name).Interface()
+		} else if !field.IsGenerated() && !s.omit[field.DBName] {
+			value, err := columnValue(v, field)
+			if err != nil {
+				return wrapError("update", table, err)
+			}
+			columns = append(columns, field.DBName)
+			values = append(values, value)
+		}
+	}
+
+	if pkField == nil {
+		return fmt.Errorf("no primary key field found")
+	}
+
+	sql, args := query.NewBuilder(table).
+		Update(columns, values).
+		Where(fmt.Sprintf("%s = ?", pkField.DBName), pkValue).
+		Build()
+
+	// Execute query
+	if _, err := db.exec(ctx, sql, args...); err != nil {
+		return wrapError("update", table, err)
+	}
+
+	return db.runHook(ctx, m, "AfterUpdate")
+}
+
+// Delete deletes a record by primary key. Models with a soft delete field
+// are only marked as deleted unless the scope is unscoped.
+func (s *Scope) Delete(ctx context.Context, m interface{}) error {
+	db := s.db.inContextTx(ctx)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	metadata, err := db.metadata(m)
+	if err != nil {
+		return err
+	}
+	table, err := s.tableName(metadata)
+	if err != nil {
+		return err
+	}
+
+	if err := db.runHook(ctx, m, "BeforeDelete"); err != nil {
+		return err
+	}
+
+	// Find primary key
+	var pkField *model.Field
+	var pkValue interface{}
+
+	v := reflect.ValueOf(m)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	for i := range metadata.Fields {
+		field := &metadata.Fields[i]
+		if field.IsPK {
+			pkField = field
+			pkValue = v.FieldByName(field.Name).Interface()
+			break
+		}
+	}
+
+	if pkField == nil {
+		return fmt.Errorf("no primary key field found")
+	}
+
+	builder := query.NewBuilder(table)
+	softDelete := metadata.SoftDeleteField()
+	var deletedAt time.Time
+	if softDelete != nil && !s.unscoped {
+		deletedAt = time.Now()
+		builder.Update([]string{softDelete.DBName}, []interface{}{deletedAt})
+	} else {
+		builder.Delete()
+	}
+	sql, args := builder.
+		Where(fmt.Sprintf("%s = ?", pkField.DBName), pkValue).
+		Build()
+
+	// Execute query
+	if _, err := db.exec(ctx, sql, args...); err != nil {
+		return wrapError("delete", table, err)
+	}
+
+	if !deletedAt.IsZero() {
+		v.FieldByName(softDelete.Name).Set(reflect.ValueOf(&deletedAt))
+	}
+
+	return db.runHook(ctx, m, "AfterDelete")
+}
@@ -0,0 +1,296 @@
+package theory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wilburhimself/theory/migration"
+)
+
+func TestModelTable(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	createTable, err := migration.CreateTableFromModel(&TestUser{})
+	if err != nil {
+		t.Fatalf("failed to build table: %v", err)
+	}
+	createTable.Name = "archived_users"
+	if _, err := db.Primary().ExecContext(ctx, createTable.SQL()); err != nil {
+		t.Fatalf("failed to create archive table: %v", err)
+	}
+
+	archived := &TestUser{Name: "Archived", Email: "archived@example.com"}
+	if err := db.Model(&TestUser{}).Table("archived_users").Create(ctx, archived); err != nil {
+		t.Fatalf("failed to create archived user: %v", err)
+	}
+	if err := db.Create(ctx, &TestUser{Name: "Active"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	var users []TestUser
+	if err := db.Model(&TestUser{}).Table("archived_users").Find(ctx, &users); err != nil {
+		t.Fatalf("failed to find archived users: %v", err)
+	}
+	if len(users) != 1 || users[0].Name != "Archived" {
+		t.Errorf("expected only the archived user, got %+v", users)
+	}
+
+	logger := &captureLogger{}
+	dry := db.Session(SessionOptions{Logger: logger, DryRun: true})
+	err = dry.Model(&TestUser{}).Table("archived_users").Where("name = ?", "Archived").Find(ctx, &users)
+	if err != nil {
+		t.Fatalf("dry run find failed: %v", err)
+	}
+	if err := dry.Model(&TestUser{}).Table("archived_users").Delete(ctx, archived); err != nil {
+		t.Fatalf("dry run delete failed: %v", err)
+	}
+
+	want := []string{
+		"[dry run] SELECT * FROM archived_users WHERE name = ? [Archived]",
+		"[dry run] DELETE FROM archived_users WHERE id = ? [1]",
+	}
+	lines := logger.Lines()
+	if len(lines) != len(want) {
+		t.Fatalf("logged %q, want %q", lines, want)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("logged %q, want %q", lines[i], want[i])
+		}
+	}
+}
+
+func TestScopeSelect(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := db.Create(ctx, &TestUser{Name: "Selected", Email: "selected@example.com"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	logger := &captureLogger{}
+	session := db.Session(SessionOptions{Logger: logger})
+
+	var users []TestUser
+	if err := session.Model(&TestUser{}).Select("id", "name").Find(ctx, &users); err != nil {
+		t.Fatalf("failed to find users: %v", err)
+	}
+
+	if len(users) != 1 {
+		t.Fatalf("expected 1 user, got %d", len(users))
+	}
+	if users[0].ID != 1 || users[0].Name != "Selected" {
+		t.Errorf("expected selected fields to be populated, got %+v", users[0])
+	}
+	if users[0].Email != "" {
+		t.Errorf("expected unselected email to be empty, got %q", users[0].Email)
+	}
+
+	lines := logger.Lines()
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "SELECT id, name FROM test_user []") {
+		t.Errorf("unexpected log %q", lines)
+	}
+}
+
+type TestAccount struct {
+	ID           int    `db:"id,pk,auto"`
+	Name         string `db:"name"`
+	PasswordHash string `db:"password_hash,null"`
+}
+
+func TestOmit(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := db.AutoMigrate(ctx, &TestAccount{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	logger := &captureLogger{}
+	session := db.Session(SessionOptions{Logger: logger})
+
+	account := &TestAccount{Name: "alice", PasswordHash: "secret"}
+	if err := session.Omit("password_hash").Create(ctx, account); err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+
+	account.Name = "alice2"
+	account.PasswordHash = "changed"
+	if err := session.Omit("password_hash").Update(ctx, account); err != nil {
+		t.Fatalf("failed to update account: %v", err)
+	}
+
+	for _, line := range logger.Lines() {
+		if strings.Contains(line, "password_hash") {
+			t.Errorf("expected omitted column in neither statement, got %q", line)
+		}
+	}
+
+	var name string
+	var hash *string
+	row := db.Primary().QueryRowContext(ctx, "SELECT name, password_hash FROM test_account WHERE id = ?", account.ID)
+	if err := row.Scan(&name, &hash); err != nil {
+		t.Fatalf("failed to read account: %v", err)
+	}
+	if name != "alice2" {
+		t.Errorf("expected name to be updated, got %q", name)
+	}
+	if hash != nil {
+		t.Errorf("expected omitted password_hash to stay NULL, got %q", *hash)
+	}
+}
+
+type TestDocument struct {
+	ID        int        `db:"id,pk,auto"`
+	Title     string     `db:"title"`
+	DeletedAt *time.Time `db:"deleted_at"`
+}
+
+func TestUnscoped(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := db.AutoMigrate(ctx, &TestDocument{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	doc := &TestDocument{Title: "Draft"}
+	if err := db.Create(ctx, doc); err != nil {
+		t.Fatalf("failed to create document: %v", err)
+	}
+
+	if err := db.Delete(ctx, doc); err != nil {
+		t.Fatalf("failed to soft delete document: %v", err)
+	}
+	if doc.DeletedAt == nil {
+		t.Error("expected DeletedAt to be set on the model")
+	}
+
+	var docs []TestDocument
+	if err := db.Find(ctx, &docs, ""); err != nil {
+		t.Fatalf("failed to find documents: %v", err)
+	}
+	if len(docs) != 0 {
+		t.Errorf("expected soft-deleted document to be filtered, got %+v", docs)
+	}
+
+	if err := db.Model(&TestDocument{}).Unscoped().Find(ctx, &docs); err != nil {
+		t.Fatalf("failed to find documents: %v", err)
+	}
+	if len(docs) != 1 || docs[0].DeletedAt == nil {
+		t.Fatalf("expected the soft-deleted document, got %+v", docs)
+	}
+
+	if err := db.Model(&TestDocument{}).Unscoped().Delete(ctx, doc); err != nil {
+		t.Fatalf("failed to delete document: %v", err)
+	}
+
+	var count int
+	if err := db.Primary().QueryRowContext(ctx, "SELECT COUNT(*) FROM test_document").Scan(&count); err != nil {
+		t.Fatalf("failed to count documents: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("expected document to be removed, %d rows left", count)
+	}
+}
+
+func TestScopeCount(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := db.AutoMigrate(ctx, &TestMember{}, &TestDocument{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := db.Create(ctx, &TestMember{Code: fmt.Sprintf("m%d", i), Active: i < 7}); err != nil {
+			t.Fatalf("failed to create member: %v", err)
+		}
+	}
+
+	count, err := db.Where("active = ?", true).Table("test_member").Count(ctx)
+	if err != nil || count != 7 {
+		t.Errorf("Count() = %d, %v, want 7", count, err)
+	}
+
+	// LIMIT would apply to the single COUNT row, so it is left out
+	count, err = db.Where("active = ?", true).Limit(5).Table("test_member").Count(ctx)
+	if err != nil || count != 7 {
+		t.Errorf("Count() with Limit = %d, %v, want 7", count, err)
+	}
+	var members []TestMember
+	if err := db.Where("active = ?", true).Limit(5).Find(ctx, &members); err != nil || len(members) != 5 {
+		t.Errorf("Find() with Limit = %d members, %v, want 5", len(members), err)
+	}
+
+	count, err = db.Model(&TestMember{}).Where("active = ?", true).Where("code <> ?", "m0").Count(ctx)
+	if err != nil || count != 6 {
+		t.Errorf("Count() with two conditions = %d, %v, want 6", count, err)
+	}
+
+	if _, err := db.Where("active = ?", true).Count(ctx); err == nil {
+		t.Error("expected error counting without a table")
+	}
+
+	doc := &TestDocument{Title: "Draft"}
+	if err := db.Create(ctx, doc); err != nil {
+		t.Fatalf("failed to create document: %v", err)
+	}
+	if err := db.Delete(ctx, doc); err != nil {
+		t.Fatalf("failed to soft delete document: %v", err)
+	}
+	if count, err := db.Model(&TestDocument{}).Count(ctx); err != nil || count != 0 {
+		t.Errorf("Count() = %d, %v, want soft-deleted documents left out", count, err)
+	}
+	if count, err := db.Model(&TestDocument{}).Unscoped().Count(ctx); err != nil || count != 1 {
+		t.Errorf("Unscoped().Count() = %d, %v, want 1", count, err)
+	}
+}
+
+func TestSoftDeleteOrCondition(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := db.AutoMigrate(ctx, &TestDocument{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	for _, title := range []string{"a", "b", "c"} {
+		if err := db.Create(ctx, &TestDocument{Title: title}); err != nil {
+			t.Fatalf("failed to create document: %v", err)
+		}
+	}
+	deleted := &TestDocument{ID: 1}
+	if err := db.Delete(ctx, deleted); err != nil {
+		t.Fatalf("failed to soft delete document: %v", err)
+	}
+
+	// The soft delete filter must apply to both sides of the OR
+	const where = "title = ? OR title = ?"
+	var docs []TestDocument
+	if err := db.Find(ctx, &docs, where, "a", "b"); err != nil || len(docs) != 1 || docs[0].Title != "b" {
+		t.Errorf("Find() = %+v, %v, want only b", docs, err)
+	}
+	if count, err := db.Model(&TestDocument{}).Where(where, "a", "b").Count(ctx); err != nil || count != 1 {
+		t.Errorf("Count() = %d, %v, want 1", count, err)
+	}
+	if count, err := db.Model(&TestDocument{}).Where(where, "a", "b").Where("title <> ?", "b").Count(ctx); err != nil || count != 0 {
+		t.Errorf("Count() with chained conditions = %d, %v, want 0", count, err)
+	}
+
+	var out strings.Builder
+	if n, err := db.CopyTo(ctx, &out, &TestDocument{}, where, "a", "b"); err != nil || n != 1 {
+		t.Errorf("CopyTo() = %d, %v, want 1 row:\n%s", n, err, out.String())
+	}
+	if n, err := db.DeleteWhere(ctx, &TestDocument{}, where, "a", "b"); err != nil || n != 1 {
+		t.Errorf("DeleteWhere() = %d, %v, want only b deleted", n, err)
+	}
+}
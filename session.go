@@ -0,0 +1,211 @@
+package theory
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"time"
+
+	"github.com/wilburhimself/theory/migration"
+	"github.com/wilburhimself/theory/query"
+)
+
+// Logger receives the SQL statements run by a DB. *log.Logger satisfies it.
+// It is the interface migrators log with, so a logger can be passed to
+// Migrator.WithLogger as well.
+type Logger = migration.Logger
+
+// SessionOptions holds the settings of a session
+type SessionOptions struct {
+	// Logger receives every statement run by the session
+	Logger Logger
+	// DryRun builds statements and logs them without executing them
+	DryRun bool
+	// PrepareStmt prepares statements once and reuses them
+	PrepareStmt bool
+	// SkipHooks disables model hooks such as BeforeCreate
+	SkipHooks bool
+}
+
+// Session returns a copy of the DB that uses the given settings. The copy
+// shares the connection pools with the original, and its settings do not
+// affect other users of the original DB.
+func (db *DB) Session(opts SessionOptions) *DB {
+	session := *db
+	if opts.Logger != nil {
+		session.logger = opts.Logger
+	}
+	session.dryRun = opts.DryRun
+	session.prepareStmt = opts.PrepareStmt
+	session.skipHooks = opts.SkipHooks
+	return &session
+}
+
+// stmtCache holds prepared statements, keyed by pool and query
+type stmtCache struct {
+	mu    sync.Mutex
+	stmts map[stmtKey]*sql.Stmt
+}
+
+type stmtKey struct {
+	pool  *sql.DB
+	query string
+}
+
+func newStmtCache() *stmtCache {
+	return &stmtCache{stmts: make(map[stmtKey]*sql.Stmt)}
+}
+
+// get returns the prepared statement for query on pool, preparing it on
+// first use
+func (c *stmtCache) get(ctx context.Context, pool *sql.DB, query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := stmtKey{pool: pool, query: query}
+	if stmt, ok := c.stmts[key]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := pool.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.stmts[key] = stmt
+	return stmt, nil
+}
+
+// close closes and forgets all cached statements, returning the first error
+func (c *stmtCache) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	for key, stmt := range c.stmts {
+		if cerr := stmt.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(c.stmts, key)
+	}
+	return err
+}
+
+// stmt returns the cached prepared statement to run query with, or nil when
+// statements are not prepared for this executor
+func (db *DB) stmt(ctx context.Context, exec executor, pool *sql.DB, query string) (*sql.Stmt, error) {
+	if !db.prepareStmt {
+		return nil, nil
+	}
+
+	switch e := exec.(type) {
+	case *sql.DB:
+		return db.stmts.get(ctx, e, query)
+	case *sql.Tx:
+		// The transaction runs on the primary even when pool is a replica,
+		// and can only use statements prepared on its own database
+		stmt, err := db.stmts.get(ctx, db.Primary(), query)
+		if err != nil {
+			return nil, err
+		}
+		return e.StmtContext(ctx, stmt), nil
+	}
+
+	// Validated connections are checked out one at a time, so statements
+	// prepared on them could not be reused
+	return nil, nil
+}
+
+// rebind rewrites the ? placeholders of a statement for the database's
+// driver
+func (db *DB) rebind(statement string) string {
+	if db.isPostgres() {
+		return query.Rebind(statement)
+	}
+	return statement
+}
+
+// exec runs a statement that returns no rows on the primary. In dry-run
+// mode the statement is only logged.
+func (db *DB) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query = db.rebind(query)
+	if db.dryRun {
+		db.logDryRun(query, args)
+		return driver.RowsAffected(0), nil
+	}
+
+	pool := db.Primary()
+	exec, release, err := db.acquire(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	start := time.Now()
+	stmt, err := db.stmt(ctx, exec, pool, query)
+	var result sql.Result
+	if err == nil {
+		if stmt != nil {
+			result, err = stmt.ExecContext(ctx, args...)
+		} else {
+			result, err = exec.ExecContext(ctx, query, args...)
+		}
+	}
+	db.logQuery(query, args, time.Since(start), err)
+
+	return result, err
+}
+
+// query runs a statement that returns rows on the given pool. The returned
+// function must be called once the rows are closed.
+func (db *DB) query(ctx context.Context, pool *sql.DB, query string, args ...interface{}) (*sql.Rows, func(), error) {
+	query = db.rebind(query)
+	exec, release, err := db.acquire(ctx, pool)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start := time.Now()
+	stmt, err := db.stmt(ctx, exec, pool, query)
+	var rows *sql.Rows
+	if err == nil {
+		if stmt != nil {
+			rows, err = stmt.QueryContext(ctx, args...)
+		} else {
+			rows, err = exec.QueryContext(ctx, query, args...)
+		}
+	}
+	db.logQuery(query, args, time.Since(start), err)
+
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return rows, release, nil
+}
+
+// logQuery logs an executed statement
+func (db *DB) logQuery(query string, args []interface{}, elapsed time.Duration, err error) {
+	if db.logger == nil {
+		return
+	}
+	if err != nil {
+		db.logger.Printf("%s %v [%s] error: %v", query, args, elapsed, err)
+		return
+	}
+	db.logger.Printf("%s %v [%s]", query, args, elapsed)
+}
+
+// logf logs a message when a logger is set
+func (db *DB) logf(format string, v ...interface{}) {
+	if db.logger != nil {
+		db.logger.Printf(format, v...)
+	}
+}
+
+// logDryRun logs a statement that was not executed
+func (db *DB) logDryRun(query string, args []interface{}) {
+	if db.logger != nil {
+		db.logger.Printf("[dry run] %s %v", query, args)
+	}
+}
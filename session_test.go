@@ -0,0 +1,291 @@
+package theory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// captureLogger records logged lines
+type captureLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *captureLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *captureLogger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+// Contains reports whether line was logged
+func (l *captureLogger) Contains(line string) bool {
+	for _, logged := range l.Lines() {
+		if logged == line {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSessionDryRun(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	logger := &captureLogger{}
+	session := db.Session(SessionOptions{Logger: logger, DryRun: true})
+
+	if err := session.Create(ctx, &TestUser{Name: "Dry", Email: "dry@example.com"}); err != nil {
+		t.Fatalf("dry run create failed: %v", err)
+	}
+
+	lines := logger.Lines()
+	want := "[dry run] INSERT INTO test_user (name, email) VALUES (?, ?) [Dry dry@example.com]"
+	if len(lines) != 1 || lines[0] != want {
+		t.Errorf("logged %q, want [%q]", lines, want)
+	}
+
+	var users []TestUser
+	if err := db.Find(ctx, &users, ""); err != nil {
+		t.Fatalf("failed to find users: %v", err)
+	}
+	if len(users) != 0 {
+		t.Errorf("expected dry run not to insert, found %d users", len(users))
+	}
+}
+
+func TestSessionLogger(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	logger := &captureLogger{}
+	session := db.Session(SessionOptions{Logger: logger})
+
+	if err := db.Create(ctx, &TestUser{Name: "Outside"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := session.Create(ctx, &TestUser{Name: "Inside"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	lines := logger.Lines()
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 logged statement, got %q", lines)
+	}
+	if !strings.HasPrefix(lines[0], "INSERT INTO test_user (name, email) VALUES (?, ?) [Inside ]") {
+		t.Errorf("unexpected log line %q", lines[0])
+	}
+}
+
+func TestSessionPrepareStmt(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	session := db.Session(SessionOptions{PrepareStmt: true})
+
+	for i := 0; i < 3; i++ {
+		if err := session.Create(ctx, &TestUser{Name: fmt.Sprintf("User %d", i)}); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	var users []TestUser
+	if err := session.Find(ctx, &users, "name LIKE ?", "User%"); err != nil {
+		t.Fatalf("failed to find users: %v", err)
+	}
+	if len(users) != 3 {
+		t.Errorf("expected 3 users, got %d", len(users))
+	}
+
+	db.stmts.mu.Lock()
+	cached := len(db.stmts.stmts)
+	db.stmts.mu.Unlock()
+	if cached != 2 {
+		t.Errorf("expected 2 cached statements, got %d", cached)
+	}
+}
+
+func TestPrepareStmtTransactionWithReplica(t *testing.T) {
+	db, err := Connect(Config{
+		Driver:        "sqlite3",
+		DSN:           filepath.Join(t.TempDir(), "primary.db"),
+		ReplicaConfig: []Config{{Driver: "sqlite3", DSN: ":memory:"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := db.AutoMigrate(ctx, &TestUser{}); err != nil {
+		t.Fatalf("failed to create tables: %v", err)
+	}
+
+	// Reads inside the transaction run on the primary, where the replica's
+	// statements cannot be used
+	session := db.Session(SessionOptions{PrepareStmt: true})
+	tx, err := session.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tx.Create(ctx, &TestUser{Name: "Alice"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	var users []TestUser
+	if err := tx.Find(ctx, &users, "name = ?", "Alice"); err != nil {
+		t.Fatalf("failed to find users: %v", err)
+	}
+	if len(users) != 1 {
+		t.Errorf("expected the transaction to see 1 user, got %d", len(users))
+	}
+}
+
+func TestCloseStatements(t *testing.T) {
+	rec, dsn := newRecorder(t)
+	db, err := Connect(Config{Driver: "postgres", DSN: dsn})
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+
+	ctx := context.Background()
+	session := db.Session(SessionOptions{PrepareStmt: true})
+	for _, name := range []string{"Alice", "Bob"} {
+		if _, err := session.UpdateWhere(ctx, &TestUser{}, map[string]interface{}{"email": ""}, "name = ?", name); err != nil {
+			t.Fatalf("failed to update users: %v", err)
+		}
+	}
+	if _, err := session.DeleteWhere(ctx, &TestUser{}, "name = ?", "Carol"); err != nil {
+		t.Fatalf("failed to delete users: %v", err)
+	}
+
+	if closed := rec.StmtsClosed(); closed != 0 {
+		t.Fatalf("expected cached statements to stay open, %d closed", closed)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("failed to close database: %v", err)
+	}
+	if closed := rec.StmtsClosed(); closed != 2 {
+		t.Errorf("expected 2 statements closed, got %d", closed)
+	}
+	if n := len(db.stmts.stmts); n != 0 {
+		t.Errorf("expected the statement cache to be empty, got %d", n)
+	}
+}
+
+var errHookRejected = errors.New("rejected by hook")
+
+// TestHookedUser rejects users without a name
+type TestHookedUser struct {
+	ID   int    `db:"id,pk,auto"`
+	Name string `db:"name"`
+}
+
+func (u *TestHookedUser) BeforeCreate(ctx context.Context) error {
+	if u.Name == "" {
+		return errHookRejected
+	}
+	return nil
+}
+
+func TestSessionSkipHooks(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := db.AutoMigrate(ctx, &TestHookedUser{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	if err := db.Create(ctx, &TestHookedUser{}); !errors.Is(err, errHookRejected) {
+		t.Errorf("expected hook error, got %v", err)
+	}
+
+	if err := db.Session(SessionOptions{SkipHooks: true}).Create(ctx, &TestHookedUser{}); err != nil {
+		t.Errorf("expected hooks to be skipped, got %v", err)
+	}
+}
+
+func TestDryRunCRUD(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	user := &TestUser{Name: "Existing", Email: "existing@example.com"}
+	if err := db.Create(ctx, user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	logger := &captureLogger{}
+	dry := db.Session(SessionOptions{Logger: logger, DryRun: true})
+
+	changed := *user
+	changed.Name = "Changed"
+
+	var users []TestUser
+	operations := []struct {
+		name string
+		run  func() error
+		want string
+	}{
+		{
+			name: "create",
+			run:  func() error { return dry.Create(ctx, &TestUser{Name: "New", Email: "new@example.com"}) },
+			want: "[dry run] INSERT INTO test_user (name, email) VALUES (?, ?) [New new@example.com]",
+		},
+		{
+			name: "find",
+			run:  func() error { return dry.Find(ctx, &users, "name = ?", "Existing") },
+			want: "[dry run] SELECT * FROM test_user WHERE name = ? [Existing]",
+		},
+		{
+			name: "update",
+			run:  func() error { return dry.Update(ctx, &changed) },
+			want: "[dry run] UPDATE test_user SET name = ?, email = ? WHERE id = ? [Changed existing@example.com 1]",
+		},
+		{
+			name: "delete",
+			run:  func() error { return dry.Delete(ctx, user) },
+			want: "[dry run] DELETE FROM test_user WHERE id = ? [1]",
+		},
+	}
+
+	for i, op := range operations {
+		t.Run(op.name, func(t *testing.T) {
+			if err := op.run(); err != nil {
+				t.Fatalf("dry run %s failed: %v", op.name, err)
+			}
+			lines := logger.Lines()
+			if len(lines) != i+1 || lines[i] != op.want {
+				t.Errorf("logged %q, want %q", lines, op.want)
+			}
+		})
+	}
+
+	if users != nil {
+		t.Errorf("expected dry run find to leave dest untouched, got %v", users)
+	}
+
+	// Nothing was written
+	if err := db.Find(ctx, &users, ""); err != nil {
+		t.Fatalf("failed to find users: %v", err)
+	}
+	if len(users) != 1 || users[0].Name != "Existing" {
+		t.Errorf("expected only the existing user, got %+v", users)
+	}
+}
@@ -0,0 +1,39 @@
+package theory
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Stats returns the connection pool statistics of the primary
+func (db *DB) Stats() sql.DBStats {
+	return db.Primary().Stats()
+}
+
+// PrintStats writes the connection pool statistics of the primary to w as a
+// table, one statistic per line. A WaitCount that keeps growing, or InUse
+// staying at MaxOpenConnections, means the pool is exhausted.
+func (db *DB) PrintStats(w io.Writer) {
+	stats := db.Stats()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, row := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"MaxOpenConnections", stats.MaxOpenConnections},
+		{"OpenConnections", stats.OpenConnections},
+		{"InUse", stats.InUse},
+		{"Idle", stats.Idle},
+		{"WaitCount", stats.WaitCount},
+		{"WaitDuration", stats.WaitDuration},
+		{"MaxIdleClosed", stats.MaxIdleClosed},
+		{"MaxIdleTimeClosed", stats.MaxIdleTimeClosed},
+		{"MaxLifetimeClosed", stats.MaxLifetimeClosed},
+	} {
+		fmt.Fprintf(tw, "%s\t%v\n", row.name, row.value)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,43 @@
+package theory
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	db.Primary().SetMaxOpenConns(2)
+
+	// Each open result set holds its connection until closed
+	for i := 0; i < 2; i++ {
+		rows, err := db.Primary().Query("SELECT 1")
+		if err != nil {
+			t.Fatalf("failed to query: %v", err)
+		}
+		defer rows.Close()
+	}
+
+	stats := db.Stats()
+	if stats.MaxOpenConnections != 2 {
+		t.Errorf("MaxOpenConnections = %d, want 2", stats.MaxOpenConnections)
+	}
+	if stats.OpenConnections != 2 || stats.InUse != 2 {
+		t.Errorf("OpenConnections = %d, InUse = %d, want 2 and 2", stats.OpenConnections, stats.InUse)
+	}
+
+	var buf bytes.Buffer
+	db.PrintStats(&buf)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 9 {
+		t.Fatalf("expected 9 lines, got %d:\n%s", len(lines), buf.String())
+	}
+	for _, want := range []string{"MaxOpenConnections  2", "OpenConnections     2", "InUse               2", "Idle                0"} {
+		if !strings.Contains(buf.String(), want+"\n") {
+			t.Errorf("expected output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
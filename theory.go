@@ -3,359 +3,983 @@ package theory
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"os"
 	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/wilburhimself/theory/migration"
 	"github.com/wilburhimself/theory/model"
+	"github.com/wilburhimself/theory/query"
 )
 
 // DB represents a Theory database instance
 type DB struct {
-	conn     *sql.DB
-	driver   string
-	migrator *migration.Migrator
+	primary      *primaryPool
+	replicas     []*sql.DB
+	nextReplica  uint32
+	driver       string
+	migrator     *migration.Migrator
+	validator    func(ctx context.Context, conn *sql.Conn) error
+	timeout      time.Duration
+	strict       bool
+	naming       NamingStrategy
+	tx           *sql.Tx
+	stmts        *stmtCache
+	pkStrategies *pkStrategies
+
+	// Session settings
+	logger      Logger
+	dryRun      bool
+	prepareStmt bool
+	skipHooks   bool
 }
 
+// primaryPool holds the primary connection pool. Copies of a DB, such as
+// sessions, share it, so SetDB applies to all of them.
+type primaryPool struct {
+	mu   sync.RWMutex
+	conn *sql.DB
+}
+
+// executor is the common query interface of *sql.DB, *sql.Conn and *sql.Tx
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// maxValidationAttempts is the number of connections tried before giving up
+const maxValidationAttempts = 3
+
 // Config holds database connection configuration
 type Config struct {
 	Driver string
 	DSN    string
+
+	// DSNTemplate is used instead of DSN to keep credentials out of source
+	// code. Its ${VAR} placeholders are replaced with environment variables
+	// when connecting; see ExpandDSN.
+	DSNTemplate string
+
+	// Logger receives executed statements and warnings, such as schema
+	// differences found by AutoMigrate
+	Logger Logger
+
+	// StrictTyping makes AutoMigrate fail with ErrColumnTypeMismatch when a
+	// live column's type differs from the model. Otherwise a warning is
+	// logged.
+	StrictTyping bool
+
+	// NamingStrategy derives table and column names from Go names for this
+	// database. When nil, the process-wide strategy set with
+	// model.SetNamingStrategy is used.
+	NamingStrategy NamingStrategy
+
+	// RetryCount is the number of times Connect retries a failed ping,
+	// waiting RetryDelay before the first retry and doubling the wait after
+	// each one, up to RetryMaxDelay when set. This gives databases that are
+	// still starting, as in containerized environments, time to come up.
+	RetryCount    int
+	RetryDelay    time.Duration
+	RetryMaxDelay time.Duration
+
+	// ReplicaConfig lists read replicas. When set, read operations are
+	// routed to the replicas while writes go to the primary.
+	ReplicaConfig []Config
 }
 
+// NamingStrategy derives table and column names from Go type and field names
+type NamingStrategy = model.NamingStrategy
+
 // ErrRecordNotFound is returned when a record is not found
 var ErrRecordNotFound = fmt.Errorf("record not found")
 
+// Validate checks that the driver and DSN are set and, for well-known
+// drivers, that the DSN has the expected format. Replica configurations are
+// validated too. Errors wrap ErrInvalidConfig.
+func (cfg Config) Validate() error {
+	if cfg.Driver == "" {
+		return fmt.Errorf("%w: driver is required", ErrInvalidConfig)
+	}
+	dsn, err := cfg.ExpandDSN()
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(dsn) == "" {
+		return fmt.Errorf("%w: DSN is required", ErrInvalidConfig)
+	}
+
+	switch cfg.Driver {
+	case "postgres", "pgx":
+		if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") &&
+			!strings.HasPrefix(dsn, "host=") {
+			return fmt.Errorf("%w: %s DSN must be a postgres:// URL or start with host=", ErrInvalidConfig, cfg.Driver)
+		}
+	case "mysql":
+		// The database name always follows a slash: [user[:pass]@][net[(addr)]]/dbname
+		if !strings.Contains(dsn, "/") {
+			return fmt.Errorf("%w: mysql DSN must contain /dbname", ErrInvalidConfig)
+		}
+	}
+
+	if cfg.RetryCount < 0 || cfg.RetryDelay < 0 || cfg.RetryMaxDelay < 0 {
+		return fmt.Errorf("%w: retry settings must not be negative", ErrInvalidConfig)
+	}
+
+	for i, replica := range cfg.ReplicaConfig {
+		if err := replica.Validate(); err != nil {
+			return fmt.Errorf("replica %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// dsnVariable matches the ${VAR} placeholders of a DSN template
+var dsnVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandDSN returns the DSN to connect with. Without a DSNTemplate that is
+// DSN; otherwise each ${VAR} in the template is replaced with the value of
+// the environment variable VAR. Other $ characters are kept as they are.
+// Undefined variables are an error wrapping ErrInvalidConfig, so a missing
+// password is not silently replaced with "".
+func (cfg Config) ExpandDSN() (string, error) {
+	if cfg.DSNTemplate == "" {
+		return cfg.DSN, nil
+	}
+	if cfg.DSN != "" {
+		return "", fmt.Errorf("%w: DSN and DSNTemplate are mutually exclusive", ErrInvalidConfig)
+	}
+
+	var missing []string
+	dsn := dsnVariable.ReplaceAllStringFunc(cfg.DSNTemplate, func(placeholder string) string {
+		name := dsnVariable.FindStringSubmatch(placeholder)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%w: undefined DSN variables: %s", ErrInvalidConfig, strings.Join(missing, ", "))
+	}
+	return dsn, nil
+}
+
 // Connect establishes a database connection
 func Connect(cfg Config) (*DB, error) {
-	conn, err := sql.Open(cfg.Driver, cfg.DSN)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
 
-	// Test connection
-	err = conn.Ping()
+	conn, err := open(cfg)
 	if err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		return nil, err
 	}
 
 	db := &DB{
-		conn:   conn,
-		driver: cfg.Driver,
+		primary:      &primaryPool{conn: conn},
+		driver:       cfg.Driver,
+		stmts:        newStmtCache(),
+		logger:       cfg.Logger,
+		pkStrategies: newPKStrategies(),
+		strict:       cfg.StrictTyping,
+		naming:       cfg.NamingStrategy,
+	}
+
+	// Connect to read replicas
+	for i, replicaCfg := range cfg.ReplicaConfig {
+		replica, err := open(replicaCfg)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+		db.replicas = append(db.replicas, replica)
 	}
 
 	// Initialize migrator
 	db.migrator = migration.NewMigrator(conn)
-	err = db.migrator.Initialize()
+	db.migrator.SetDialect(migration.DialectFromDriver(cfg.Driver))
+	err = db.migrator.Initialize(context.Background())
 	if err != nil {
-		conn.Close()
+		db.Close()
 		return nil, fmt.Errorf("failed to initialize migrator: %w", err)
 	}
 
 	return db, nil
 }
 
-// Close closes the database connection
-func (db *DB) Close() error {
-	return db.conn.Close()
+// Migrate connects to the database and runs AutoMigrate for the given
+// models, returning the ready-to-use DB. The connection is closed if the
+// migration fails.
+func Migrate(cfg Config, models ...interface{}) (*DB, error) {
+	db, err := Connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.AutoMigrate(context.Background(), models...); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
-// Migrator returns the database migrator
-func (db *DB) Migrator() *migration.Migrator {
-	return db.migrator
+// open opens and pings a single database connection pool
+func open(cfg Config) (*sql.DB, error) {
+	dsn, err := cfg.ExpandDSN()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open(cfg.Driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Test connection
+	if err := ping(conn, cfg); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return conn, nil
 }
 
-// AutoMigrate creates or updates database tables based on the given models
-func (db *DB) AutoMigrate(models ...interface{}) error {
-	for _, m := range models {
-		// Create migration
-		metadata, err := model.ExtractMetadata(m)
-		if err != nil {
+// ping pings conn, retrying up to cfg.RetryCount times with exponential
+// backoff. The last error is returned if every attempt fails.
+func ping(conn *sql.DB, cfg Config) error {
+	delay := cfg.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err := conn.Ping()
+		if err == nil || attempt >= cfg.RetryCount {
 			return err
 		}
 
-		// Create table operation
-		createTable := &migration.CreateTable{
-			Name:    metadata.TableName,
-			Columns: make([]migration.Column, 0),
+		time.Sleep(delay)
+		delay *= 2
+		if cfg.RetryMaxDelay > 0 && delay > cfg.RetryMaxDelay {
+			delay = cfg.RetryMaxDelay
 		}
+	}
+}
 
-		// Convert model fields to columns
-		for _, field := range metadata.Fields {
-			col := migration.Column{
-				Name:   field.DBName,
-				Type:   migration.SqlType(field.Type),
-				IsPK:   field.IsPK,
-				IsAuto: field.IsAuto,
-				IsNull: field.IsNull,
-			}
-			createTable.Columns = append(createTable.Columns, col)
+// Close closes the cached prepared statements, then the primary and all
+// replica connections
+func (db *DB) Close() error {
+	err := db.closeStatements()
+	if cerr := db.Primary().Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	for _, replica := range db.replicas {
+		if rerr := replica.Close(); rerr != nil && err == nil {
+			err = rerr
 		}
+	}
+	return err
+}
 
-		// Create migration
-		mig := migration.NewMigration(fmt.Sprintf("create_%s", metadata.TableName))
-		mig.Up = []migration.Operation{createTable}
-		mig.Down = []migration.Operation{
-			&migration.DropTable{Name: metadata.TableName},
-		}
+// closeStatements closes the prepared statements cached for PrepareStmt
+// sessions
+func (db *DB) closeStatements() error {
+	if db.stmts == nil {
+		return nil
+	}
+	return db.stmts.close()
+}
+
+// Primary returns the connection pool used for writes
+func (db *DB) Primary() *sql.DB {
+	db.primary.mu.RLock()
+	defer db.primary.mu.RUnlock()
+	return db.primary.conn
+}
+
+// SetDB replaces the primary connection pool, letting applications reconnect
+// without restarting, for example after rotating credentials. Operations and
+// transactions already running finish on the old pool, which is not closed;
+// new operations, including those of existing sessions, use newConn. The
+// migrator is switched over as well.
+func (db *DB) SetDB(newConn *sql.DB) {
+	db.primary.mu.Lock()
+	db.primary.conn = newConn
+	db.primary.mu.Unlock()
+
+	db.migrator.SetDB(newConn)
+}
+
+// Replica returns a read replica using round-robin selection. If no replicas
+// are configured, the primary is returned.
+func (db *DB) Replica() *sql.DB {
+	if len(db.replicas) == 0 {
+		return db.Primary()
+	}
+	n := atomic.AddUint32(&db.nextReplica, 1)
+	return db.replicas[(n-1)%uint32(len(db.replicas))]
+}
+
+// isSQLite reports whether the database uses a SQLite driver
+func (db *DB) isSQLite() bool {
+	return db.driver == "sqlite3" || db.driver == "sqlite"
+}
+
+// isPostgres reports whether the database uses a PostgreSQL driver
+func (db *DB) isPostgres() bool {
+	return db.driver == "postgres" || db.driver == "pgx"
+}
+
+// WithTimeout returns a shallow copy of the DB that bounds every operation
+// with the given timeout. The copy shares the connection pools with the
+// original, so closing either closes both.
+func (db *DB) WithTimeout(d time.Duration) *DB {
+	clone := *db
+	clone.timeout = d
+	return &clone
+}
+
+// withTimeout derives the context for a single operation, applying the
+// per-query timeout when one is set
+func (db *DB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, db.timeout)
+}
+
+// SetConnValidator sets a function that validates each connection before it is
+// used for an operation. Connections failing validation are discarded and
+// another connection is checked out from the pool.
+func (db *DB) SetConnValidator(v func(ctx context.Context, conn *sql.Conn) error) {
+	db.validator = v
+}
+
+// acquire returns the executor to use for a single operation on the given
+// pool and a function that must be called once the operation, including
+// reading rows, is done
+func (db *DB) acquire(ctx context.Context, pool *sql.DB) (executor, func(), error) {
+	// Inside a transaction every operation runs on the transaction itself
+	if db.tx != nil {
+		return db.tx, func() {}, nil
+	}
 
-		// Add and run migration
-		db.migrator.Add(mig)
-		err = db.migrator.Up()
+	if db.validator == nil {
+		return pool, func() {}, nil
+	}
+
+	var lastErr error
+	for i := 0; i < maxValidationAttempts; i++ {
+		conn, err := pool.Conn(ctx)
 		if err != nil {
-			return err
+			return nil, nil, err
+		}
+
+		lastErr = db.validator(ctx, conn)
+		if lastErr == nil {
+			return conn, func() { conn.Close() }, nil
+		}
+
+		// Returning ErrBadConn makes database/sql drop the connection
+		// instead of putting it back into the pool
+		conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		conn.Close()
+	}
+
+	return nil, nil, fmt.Errorf("failed to validate connection: %w", lastErr)
+}
+
+// Migrator returns the database migrator
+func (db *DB) Migrator() *migration.Migrator {
+	return db.migrator
+}
+
+// AutoMigrate creates or updates database tables based on the given models.
+// Missing tables are created through the migrator. For existing tables,
+// column types are compared with the model, and indexes declared on the
+// model but missing from the table are created; indexes found only on the
+// table are logged, not dropped.
+//
+// Column types are never changed: SQLite can only change a column's type by
+// rebuilding the table, which AutoMigrate does not do. Mismatches are logged,
+// or returned as ErrColumnTypeMismatch with Config.StrictTyping.
+//
+// A failing model does not stop the others from being migrated. The
+// failures are returned together as an AutoMigrateError.
+func (db *DB) AutoMigrate(ctx context.Context, models ...interface{}) error {
+	return db.AutoMigrateWith(ctx, db.migrator, models...)
+}
+
+// AutoMigrateWith is like AutoMigrate, but creates missing tables through
+// the given migrator, so its table name, logger, output and hooks apply.
+// The migrator should run against the DB's primary database.
+func (db *DB) AutoMigrateWith(ctx context.Context, migrator *migration.Migrator, models ...interface{}) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var errs AutoMigrateError
+	for _, m := range models {
+		if err := db.autoMigrate(ctx, migrator, m); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
-// Create inserts a new record into the database
-func (db *DB) Create(ctx context.Context, m interface{}) error {
-	metadata, err := model.ExtractMetadata(m)
+// autoMigrate migrates the table of a single model
+func (db *DB) autoMigrate(ctx context.Context, migrator *migration.Migrator, m interface{}) error {
+	metadata, err := db.metadata(m)
 	if err != nil {
 		return err
 	}
 
-	// Build query
-	var columns []string
-	var placeholders []string
-	var values []interface{}
+	// Create table and index operations, the indexes being declared via
+	// struct tags
+	createTable := migration.CreateTableFromMetadata(metadata)
+	createIndexes := migration.IndexesFromMetadata(metadata)
 
-	v := reflect.ValueOf(m)
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
+	exists, err := db.tableExists(ctx, createTable.Name)
+	if err != nil {
+		return wrapError("auto migrate", createTable.Name, err)
 	}
-
-	for _, field := range metadata.Fields {
-		if !field.IsAuto {
-			columns = append(columns, field.DBName)
-			placeholders = append(placeholders, "?")
-			values = append(values, v.FieldByName(field.Name).Interface())
+	if exists {
+		if err := db.checkColumnTypes(ctx, createTable); err != nil {
+			return err
 		}
+		return db.migrateIndexes(ctx, createTable.Name, createIndexes)
+	}
+
+	// Create migration
+	mig := migration.NewMigration(fmt.Sprintf("create_%s", createTable.Name))
+	mig.Up = []migration.Operation{createTable}
+	for _, op := range createIndexes {
+		mig.Up = append(mig.Up, op)
+	}
+	mig.Down = []migration.Operation{
+		&migration.DropTable{Name: createTable.Name},
 	}
 
-	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
-		metadata.TableName,
-		strings.Join(columns, ", "),
-		strings.Join(placeholders, ", "),
-	)
+	// Run the migration on its own, so a failing model is not retried with
+	// the next one, and register it once it is applied
+	if _, err := migrator.Apply(ctx, mig); err != nil {
+		// Surfaces unique violations when constraints are added to existing data
+		return translateError(err)
+	}
+	return nil
+}
 
-	// Execute query
-	result, err := db.conn.ExecContext(ctx, sql, values...)
+// checkColumnTypes compares the live column types of an existing table with
+// the types mapped from the model
+func (db *DB) checkColumnTypes(ctx context.Context, createTable *migration.CreateTable) error {
+	live, err := db.GetColumns(ctx, createTable.Name)
 	if err != nil {
 		return err
 	}
 
-	// Get last insert ID if available
-	if id, err := result.LastInsertId(); err == nil {
-		for _, field := range metadata.Fields {
-			if field.IsAuto {
-				v.FieldByName(field.Name).SetInt(id)
-				break
-			}
+	liveTypes := make(map[string]string, len(live))
+	for _, col := range live {
+		liveTypes[col.Name] = col.Type
+	}
+
+	for _, col := range createTable.Columns {
+		liveType, ok := liveTypes[col.Name]
+		if !ok || baseType(liveType) == baseType(col.Type) {
+			continue
 		}
+
+		if db.strict {
+			return wrapError("auto migrate", createTable.Name,
+				fmt.Errorf("%w: column %s is %s, model maps to %s", ErrColumnTypeMismatch, col.Name, liveType, col.Type))
+		}
+		db.logf("theory: column %s.%s is %s, model maps to %s", createTable.Name, col.Name, liveType, col.Type)
+	}
+	return nil
+}
+
+// migrateIndexes creates the declared indexes missing from an existing table
+// and logs the indexes that exist only on the table
+func (db *DB) migrateIndexes(ctx context.Context, table string, declared []*migration.CreateIndex) error {
+	existing, err := db.indexNames(ctx, table)
+	if err != nil {
+		return wrapError("auto migrate", table, err)
 	}
 
+	for _, op := range declared {
+		if existing[op.Index.Name] {
+			delete(existing, op.Index.Name)
+			continue
+		}
+		if err := db.CreateIndex(ctx, op); err != nil {
+			return err
+		}
+	}
+
+	undeclared := make([]string, 0, len(existing))
+	for name := range existing {
+		undeclared = append(undeclared, name)
+	}
+	sort.Strings(undeclared)
+	for _, name := range undeclared {
+		db.logf("theory: index %s on table %s is not declared on the model", name, table)
+	}
 	return nil
 }
 
+// metadata extracts the metadata of a model, naming it with the database's
+// naming strategy
+func (db *DB) metadata(m interface{}) (*model.Metadata, error) {
+	return model.ExtractMetadataWith(m, db.naming)
+}
+
+// Create inserts a new record into the database
+func (db *DB) Create(ctx context.Context, m interface{}) error {
+	return db.scope().Create(ctx, m)
+}
+
 // Find retrieves records from the database
 func (db *DB) Find(ctx context.Context, dest interface{}, where string, args ...interface{}) error {
-	// Get metadata from destination type
-	destType := reflect.TypeOf(dest)
-	if destType.Kind() != reflect.Ptr {
-		return fmt.Errorf("destination must be a pointer")
+	scope := db.scope()
+	if where != "" {
+		scope.Where(where, args...)
 	}
+	return scope.Find(ctx, dest)
+}
 
-	elemType := destType.Elem()
-	isSlice := elemType.Kind() == reflect.Slice
-	if isSlice {
-		elemType = elemType.Elem()
+// First retrieves the first record matching the given ID
+func (db *DB) First(ctx context.Context, dest interface{}, id interface{}) error {
+	metadata, err := db.metadata(dest)
+	if err != nil {
+		return err
 	}
 
-	if elemType.Kind() == reflect.Ptr {
-		elemType = elemType.Elem()
+	// Find primary key field
+	var pkField *model.Field
+	for i := range metadata.Fields {
+		if metadata.Fields[i].IsPK {
+			pkField = &metadata.Fields[i]
+			break
+		}
+	}
+
+	if pkField == nil {
+		return fmt.Errorf("no primary key field found")
 	}
 
-	metadata, err := model.ExtractMetadata(reflect.New(elemType).Interface())
+	err = db.Find(ctx, dest, fmt.Sprintf("%s = ?", pkField.DBName), id)
+	if err == ErrRecordNotFound {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+// FirstWhere retrieves the record with the lowest primary key among those
+// matching the given condition. ErrRecordNotFound is returned when no record
+// matches.
+func (db *DB) FirstWhere(ctx context.Context, dest interface{}, where string, args ...interface{}) error {
+	metadata, err := db.metadata(dest)
 	if err != nil {
 		return err
 	}
 
-	// Build query
-	sql := fmt.Sprintf("SELECT * FROM %s", metadata.TableName)
+	pkField := metadata.PrimaryKey()
+	if pkField == nil {
+		return fmt.Errorf("no primary key field found")
+	}
+
+	scope := db.scope()
 	if where != "" {
-		sql += " WHERE " + where
+		scope.Where(where, args...)
 	}
+	scope.order = pkField.DBName + " ASC"
+	scope.limit = 1
+	return scope.Find(ctx, dest)
+}
 
-	// Execute query
-	rows, err := db.conn.QueryContext(ctx, sql, args...)
+// FindInBatches retrieves the records matching the condition in pages of
+// batchSize records, ordered by primary key, and calls fn with dest after
+// each page is read into it. dest must be a pointer to a slice of structs.
+// Iteration stops at the first error returned by fn, which is returned.
+func (db *DB) FindInBatches(ctx context.Context, dest interface{}, batchSize int, where string, fn func(batch interface{}) error, args ...interface{}) error {
+	if batchSize <= 0 {
+		return fmt.Errorf("batch size must be positive, got %d", batchSize)
+	}
+
+	d, err := parseDest(dest)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
+	if !d.isSlice {
+		return fmt.Errorf("destination must point to a slice of structs, got %T", dest)
+	}
 
-	var results reflect.Value
-	if isSlice {
-		results = reflect.MakeSlice(reflect.SliceOf(elemType), 0, 0)
+	metadata, err := d.metadata(db.naming)
+	if err != nil {
+		return err
 	}
 
-	found := false
-	for rows.Next() {
-		found = true
-		// Create a new instance of the model
-		modelInstance := reflect.New(elemType)
-		if modelInstance.Kind() == reflect.Ptr {
-			modelInstance = modelInstance.Elem()
+	for offset := 0; ; offset += batchSize {
+		scope := db.scope()
+		if where != "" {
+			scope.Where(where, args...)
 		}
-
-		// Create a slice of pointers to scan into
-		var scanDest []interface{}
-		for _, field := range metadata.Fields {
-			scanDest = append(scanDest, modelInstance.FieldByName(field.Name).Addr().Interface())
+		if pkField := metadata.PrimaryKey(); pkField != nil {
+			scope.order = pkField.DBName + " ASC"
 		}
+		scope.limit = batchSize
+		scope.offset = offset
 
-		// Scan row into model
-		err := rows.Scan(scanDest...)
-		if err != nil {
+		// Nothing is read in dry run mode, so start each page empty
+		d.value.Set(reflect.MakeSlice(d.value.Type(), 0, 0))
+		if err := scope.Find(ctx, dest); err != nil {
 			return err
 		}
 
-		if isSlice {
-			results = reflect.Append(results, modelInstance)
-		} else {
-			reflect.ValueOf(dest).Elem().Set(modelInstance)
-			break
+		n := d.value.Len()
+		if n == 0 {
+			return nil
+		}
+		if err := fn(dest); err != nil {
+			return err
+		}
+		if n < batchSize {
+			return nil
 		}
 	}
+}
 
-	if err := rows.Err(); err != nil {
+// FirstOrInit retrieves the first record matching conditions into dest. When
+// none matches, dest is filled with the conditions instead, without saving
+// it. Conditions are either a map of column names to values or a struct
+// whose non-zero fields are matched.
+func (db *DB) FirstOrInit(ctx context.Context, dest interface{}, conditions interface{}) error {
+	_, err := db.firstOrInit(ctx, dest, conditions)
+	return err
+}
+
+// FirstOrCreate retrieves the first record matching conditions into dest.
+// When none matches, dest is filled with the conditions and created.
+// Conditions take the same forms as in FirstOrInit.
+func (db *DB) FirstOrCreate(ctx context.Context, dest interface{}, conditions interface{}) error {
+	found, err := db.firstOrInit(ctx, dest, conditions)
+	if err != nil || found {
 		return err
 	}
+	return db.Create(ctx, dest)
+}
 
-	if !isSlice && !found {
-		return ErrRecordNotFound
+// firstOrInit implements FirstOrInit and reports whether a record was found
+func (db *DB) firstOrInit(ctx context.Context, dest interface{}, conditions interface{}) (bool, error) {
+	values, err := db.conditionValues(conditions)
+	if err != nil {
+		return false, err
 	}
 
-	if isSlice {
-		reflect.ValueOf(dest).Elem().Set(results)
+	columns := make([]string, 0, len(values))
+	for column := range values {
+		columns = append(columns, column)
 	}
+	sort.Strings(columns)
 
-	return nil
+	where := make([]string, 0, len(columns))
+	args := make([]interface{}, 0, len(columns))
+	for _, column := range columns {
+		if values[column] == nil {
+			where = append(where, column+" IS NULL")
+			continue
+		}
+		where = append(where, column+" = ?")
+		args = append(args, values[column])
+	}
+
+	err = db.FirstWhere(ctx, dest, strings.Join(where, " AND "), args...)
+	if err != ErrRecordNotFound {
+		return err == nil, err
+	}
+
+	metadata, err := db.metadata(dest)
+	if err != nil {
+		return false, err
+	}
+	v := reflect.Indirect(reflect.ValueOf(dest))
+	for _, field := range metadata.Fields {
+		value, ok := values[field.DBName]
+		if !ok || value == nil {
+			continue
+		}
+		if err := setField(v.FieldByName(field.Name), value); err != nil {
+			return false, fmt.Errorf("condition %s: %w", field.DBName, err)
+		}
+	}
+	return false, nil
 }
 
-// First retrieves the first record matching the given ID
-func (db *DB) First(ctx context.Context, dest interface{}, id interface{}) error {
-	metadata, err := model.ExtractMetadata(dest)
+// conditionValues returns the column values of a conditions map, or of the
+// non-zero fields of a conditions struct
+func (db *DB) conditionValues(conditions interface{}) (map[string]interface{}, error) {
+	if values, ok := conditions.(map[string]interface{}); ok {
+		return values, nil
+	}
+
+	metadata, err := db.metadata(conditions)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("conditions must be a map or a struct: %w", err)
 	}
 
-	// Find primary key field
-	var pkField *model.Field
-	for i := range metadata.Fields {
-		if metadata.Fields[i].IsPK {
-			pkField = &metadata.Fields[i]
-			break
+	v := reflect.Indirect(reflect.ValueOf(conditions))
+	values := make(map[string]interface{})
+	for _, field := range metadata.Fields {
+		fv := v.FieldByName(field.Name)
+		if fv.IsZero() {
+			continue
 		}
+		values[field.DBName] = reflect.Indirect(fv).Interface()
 	}
+	return values, nil
+}
 
-	if pkField == nil {
-		return fmt.Errorf("no primary key field found")
+// Raw runs a raw SQL query on the primary and scans the results into dest,
+// which must be a pointer to a struct or to a slice of structs. Columns are
+// matched to fields by their database name. ErrRecordNotFound is returned
+// when dest is a single struct and the query returns no rows.
+func (db *DB) Raw(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	db = db.inContextTx(ctx)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	d, err := parseDest(dest)
+	if err != nil {
+		return err
 	}
 
-	err = db.Find(ctx, dest, fmt.Sprintf("%s = ?", pkField.DBName), id)
-	if err == ErrRecordNotFound {
+	metadata, err := d.metadata(db.naming)
+	if err != nil {
+		return err
+	}
+
+	if db.dryRun {
+		db.logDryRun(query, args)
+		return nil
+	}
+
+	rows, release, err := db.query(ctx, db.Primary(), query, args...)
+	if err != nil {
+		return wrapError("raw", "", err)
+	}
+	defer release()
+	defer rows.Close()
+
+	found, err := d.scan(rows, metadata.Fields)
+	if err != nil {
+		return wrapError("raw", "", err)
+	}
+
+	if !d.isSlice && !found {
 		return ErrRecordNotFound
 	}
-	return err
+
+	return nil
 }
 
-// Update updates a record in the database
-func (db *DB) Update(ctx context.Context, m interface{}) error {
-	metadata, err := model.ExtractMetadata(m)
+// QueryRow runs a raw SQL query expected to return a single row, such as an
+// aggregate, and scans it into dest, which must be a pointer to a struct.
+// Columns are matched to fields by their database name. ErrRecordNotFound is
+// returned when the query returns no rows.
+func (db *DB) QueryRow(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	d, err := parseDest(dest)
 	if err != nil {
 		return err
 	}
+	if d.isSlice {
+		return fmt.Errorf("destination must point to a struct, got %T", dest)
+	}
+	return db.Raw(ctx, dest, query, args...)
+}
 
-	// Build query
-	var setColumns []string
-	var values []interface{}
-	var pkField *model.Field
-	var pkValue interface{}
+// ScanMaps runs a raw SQL query on the primary and returns each row as a map
+// keyed by column name, for queries whose result columns are not known in
+// advance. Text columns that the driver returns as bytes are converted to
+// strings.
+func (db *DB) ScanMaps(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	db = db.inContextTx(ctx)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
 
-	v := reflect.ValueOf(m)
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
+	if db.dryRun {
+		db.logDryRun(query, args)
+		return nil, nil
 	}
 
-	for i := range metadata.Fields {
-		field := &metadata.Fields[i]
-		if field.IsPK {
-			pkField = field
-			pkValue = v.FieldByName(field.Name).Interface()
-		} else {
-			setColumns = append(setColumns, fmt.Sprintf("%s = ?", field.DBName))
-			values = append(values, v.FieldByName(field.Name).Interface())
+	rows, release, err := db.query(ctx, db.Primary(), query, args...)
+	if err != nil {
+		return nil, wrapError("scan maps", "", err)
+	}
+	defer release()
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, wrapError("scan maps", "", err)
+	}
+
+	var results []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(columnTypes))
+		scanDest := make([]interface{}, len(columnTypes))
+		for i := range values {
+			scanDest[i] = &values[i]
+		}
+		if err := rows.Scan(scanDest...); err != nil {
+			return nil, wrapError("scan maps", "", err)
+		}
+
+		row := make(map[string]interface{}, len(columnTypes))
+		for i, columnType := range columnTypes {
+			value := values[i]
+			if b, ok := value.([]byte); ok && !isBinaryType(columnType.DatabaseTypeName()) {
+				value = string(b)
+			}
+			row[columnType.Name()] = value
 		}
+		results = append(results, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapError("scan maps", "", err)
 	}
 
-	if pkField == nil {
-		return fmt.Errorf("no primary key field found")
+	return results, nil
+}
+
+// isBinaryType reports whether a database type name holds binary data
+func isBinaryType(typeName string) bool {
+	switch strings.ToUpper(typeName) {
+	case "BLOB", "BYTEA", "BINARY", "VARBINARY", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB":
+		return true
 	}
+	return false
+}
+
+// Update updates a record in the database
+func (db *DB) Update(ctx context.Context, m interface{}) error {
+	return db.scope().Update(ctx, m)
+}
 
-	// Add primary key value to values
-	values = append(values, pkValue)
+// Save inserts the record when its primary key is the zero value, or nil
+// for pointer keys, and updates it otherwise
+func (db *DB) Save(ctx context.Context, m interface{}) error {
+	metadata, err := db.metadata(m)
+	if err != nil {
+		return err
+	}
 
-	sql := fmt.Sprintf("UPDATE %s SET %s WHERE %s = ?",
-		metadata.TableName,
-		strings.Join(setColumns, ", "),
-		pkField.DBName,
-	)
+	pkField := metadata.PrimaryKey()
+	if pkField == nil {
+		return fmt.Errorf("no primary key field found")
+	}
 
-	// Execute query
-	_, err = db.conn.ExecContext(ctx, sql, values...)
-	return err
+	if reflect.Indirect(reflect.ValueOf(m)).FieldByName(pkField.Name).IsZero() {
+		return db.Create(ctx, m)
+	}
+	return db.Update(ctx, m)
 }
 
 // Delete deletes a record from the database
 func (db *DB) Delete(ctx context.Context, m interface{}) error {
-	metadata, err := model.ExtractMetadata(m)
+	return db.scope().Delete(ctx, m)
+}
+
+// UpdateWhere sets the given columns on every record of the model's table
+// matching the condition and returns the number of rows affected. An empty
+// condition updates every record. Hooks are not run.
+func (db *DB) UpdateWhere(ctx context.Context, m interface{}, values map[string]interface{}, where string, args ...interface{}) (int64, error) {
+	db = db.inContextTx(ctx)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	metadata, err := db.metadata(m)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	table := metadata.TableName
 
-	// Find primary key
-	var pkField *model.Field
-	var pkValue interface{}
+	if len(values) == 0 {
+		return 0, wrapError("update", table, fmt.Errorf("no columns to update"))
+	}
 
-	v := reflect.ValueOf(m)
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
+	// Sort columns so the same values always produce the same statement
+	columns := make([]string, 0, len(values))
+	for column := range values {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	columnValues := make([]interface{}, len(columns))
+	for i, column := range columns {
+		columnValues[i] = values[column]
 	}
 
-	for i := range metadata.Fields {
-		field := &metadata.Fields[i]
-		if field.IsPK {
-			pkField = field
-			pkValue = v.FieldByName(field.Name).Interface()
-			break
-		}
+	builder := query.NewBuilder(table).Update(columns, columnValues)
+	if where != "" {
+		builder.Where(where, args...)
 	}
+	sql, sqlArgs := builder.Build()
 
-	if pkField == nil {
-		return fmt.Errorf("no primary key field found")
+	result, err := db.exec(ctx, sql, sqlArgs...)
+	if err != nil {
+		return 0, wrapError("update", table, err)
 	}
 
-	sql := fmt.Sprintf("DELETE FROM %s WHERE %s = ?",
-		metadata.TableName,
-		pkField.DBName,
-	)
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, wrapError("update", table, err)
+	}
+	return affected, nil
+}
 
-	// Execute query
-	_, err = db.conn.ExecContext(ctx, sql, pkValue)
-	return err
+// DeleteWhere deletes every record of the model's table matching the
+// condition and returns the number of rows affected. For models with a soft
+// delete field, the matching records that are not yet deleted are marked as
+// deleted instead. An empty condition matches every record. Hooks are not
+// run.
+func (db *DB) DeleteWhere(ctx context.Context, m interface{}, where string, args ...interface{}) (int64, error) {
+	db = db.inContextTx(ctx)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	metadata, err := db.metadata(m)
+	if err != nil {
+		return 0, err
+	}
+	table := metadata.TableName
+
+	builder := query.NewBuilder(table)
+	field := metadata.SoftDeleteField()
+	if field != nil {
+		builder.Update([]string{field.DBName}, []interface{}{time.Now()}).
+			Where(fmt.Sprintf("%s IS NULL", field.DBName))
+	} else {
+		builder.Delete()
+	}
+	if where != "" && field != nil {
+		builder.Where(parenthesize(where), args...)
+	} else if where != "" {
+		builder.Where(where, args...)
+	}
+	sql, sqlArgs := builder.Build()
+
+	result, err := db.exec(ctx, sql, sqlArgs...)
+	if err != nil {
+		return 0, wrapError("delete", table, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, wrapError("delete", table, err)
+	}
+	return affected, nil
 }
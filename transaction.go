@@ -0,0 +1,322 @@
+package theory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// TxOptions holds the isolation level and read-only flag of a transaction
+type TxOptions = sql.TxOptions
+
+// Transaction is a database transaction. Nested transactions started with
+// Transaction.Begin are implemented with savepoints on the same underlying
+// *sql.Tx.
+type Transaction struct {
+	db        *DB
+	tx        *sql.Tx
+	parent    *Transaction
+	savepoint string
+
+	// undoneBy is the savepoint RollbackTo rolled back to, removing this
+	// transaction's savepoint
+	undoneBy string
+
+	// Callbacks registered with OnCommit and OnRollback
+	onCommit   []func()
+	onRollback []func()
+}
+
+// savepointName matches the savepoint names accepted by BeginNamed
+var savepointName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Begin starts a new transaction on the primary
+func (db *DB) Begin(ctx context.Context, opts *TxOptions) (*Transaction, error) {
+	conn := db.Primary()
+	tx, err := conn.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, wrapError("begin", "", err)
+	}
+
+	// The transaction keeps the pool it began on, even if SetDB is called
+	txDB := *db
+	txDB.primary = &primaryPool{conn: conn}
+	txDB.tx = tx
+	return &Transaction{db: &txDB, tx: tx}, nil
+}
+
+// WithTransaction runs fn in a transaction on the primary. The transaction is
+// committed if fn returns nil and rolled back if it returns an error or
+// panics. The transaction is bound to ctx: once ctx is done it is rolled
+// back, and ctx's error is returned.
+func (db *DB) WithTransaction(ctx context.Context, fn func(tx *Transaction) error) error {
+	tx, err := db.Begin(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback(ctx)
+			panic(p)
+		}
+	}()
+
+	err = fn(tx)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		// Errors of fn are then usually a consequence of the rollback
+		tx.Rollback(ctx)
+		return wrapError("transaction", "", ctxErr)
+	}
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// txContextKey is the context key of the transaction stored by
+// ContextWithTx
+type txContextKey struct{}
+
+// ContextWithTx returns a copy of ctx carrying tx. Operations of a DB
+// called with the returned context, such as Create, Find, Raw and
+// UpdateWhere, run within tx, so a transaction begun by request middleware
+// applies to the handlers below it. tx must have been begun on the DB the
+// operations are called on. Operations of another Transaction keep running
+// within that transaction.
+func ContextWithTx(ctx context.Context, tx *Transaction) context.Context {
+	return context.WithValue(ctx, txContextKey{}, tx)
+}
+
+// TxFromContext returns the transaction stored in ctx by ContextWithTx
+func TxFromContext(ctx context.Context) (*Transaction, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(*Transaction)
+	return tx, ok && tx != nil
+}
+
+// inContextTx returns the DB to run an operation with ctx on: db within the
+// transaction stored in ctx, or db itself when ctx has none or db is already
+// in a transaction. Session settings of db, such as its logger, are kept.
+func (db *DB) inContextTx(ctx context.Context) *DB {
+	tx, ok := TxFromContext(ctx)
+	if !ok || db.tx != nil {
+		return db
+	}
+
+	txDB := *db
+	txDB.primary = tx.db.primary
+	txDB.tx = tx.tx
+	return &txDB
+}
+
+// WithTransactionTimeout runs fn in a transaction like WithTransaction, rolling
+// it back if it takes longer than timeout. The error then wraps
+// context.DeadlineExceeded.
+func (db *DB) WithTransactionTimeout(ctx context.Context, timeout time.Duration, fn func(tx *Transaction) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return db.WithTransaction(ctx, fn)
+}
+
+// Begin starts a nested transaction using a savepoint with a generated name.
+// The options are ignored, as savepoints share the outer transaction's
+// settings.
+func (t *Transaction) Begin(ctx context.Context, opts *TxOptions) (*Transaction, error) {
+	nested := &Transaction{db: t.db, tx: t.tx, parent: t}
+	nested.savepoint = fmt.Sprintf("sp_%p", nested)
+	return nested, nested.createSavepoint(ctx)
+}
+
+// BeginNamed starts a nested transaction using a savepoint with the given
+// name, which may only contain letters, digits and underscores
+func (t *Transaction) BeginNamed(ctx context.Context, name string, opts *TxOptions) (*Transaction, error) {
+	if !savepointName.MatchString(name) {
+		return nil, fmt.Errorf("invalid savepoint name %q: only letters, digits and underscores are allowed", name)
+	}
+
+	nested := &Transaction{db: t.db, tx: t.tx, parent: t, savepoint: name}
+	return nested, nested.createSavepoint(ctx)
+}
+
+// createSavepoint issues the SAVEPOINT statement of a nested transaction
+func (t *Transaction) createSavepoint(ctx context.Context) error {
+	_, err := t.tx.ExecContext(ctx, "SAVEPOINT "+t.savepoint)
+	return wrapError("savepoint", "", err)
+}
+
+// Commit commits the transaction. For a nested transaction the savepoint is
+// released, leaving the changes to be committed by the outer transaction.
+func (t *Transaction) Commit(ctx context.Context) error {
+	if err := t.checkUndone(); err != nil {
+		return wrapError("commit", "", err)
+	}
+	if t.parent == nil {
+		err := t.tx.Commit()
+		if err != nil {
+			t.finish(t.onRollback)
+		} else {
+			t.finish(t.onCommit)
+		}
+		return wrapError("commit", "", err)
+	}
+
+	_, err := t.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+t.savepoint)
+	if err != nil {
+		return wrapError("commit", "", err)
+	}
+	// The outcome is decided by the outer transaction
+	t.parent.onCommit = append(t.parent.onCommit, t.onCommit...)
+	t.parent.onRollback = append(t.parent.onRollback, t.onRollback...)
+	t.onCommit, t.onRollback = nil, nil
+	return nil
+}
+
+// Rollback rolls back the transaction. For a nested transaction only the
+// changes made since its savepoint are undone.
+func (t *Transaction) Rollback(ctx context.Context) error {
+	if err := t.checkUndone(); err != nil {
+		return wrapError("rollback", "", err)
+	}
+	if t.parent == nil {
+		err := t.tx.Rollback()
+		t.finish(t.onRollback)
+		return wrapError("rollback", "", err)
+	}
+
+	_, err := t.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+t.savepoint)
+	if err != nil {
+		return wrapError("rollback", "", err)
+	}
+	t.finish(t.onRollback)
+	_, err = t.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+t.savepoint)
+	return wrapError("rollback", "", err)
+}
+
+// checkUndone returns an error wrapping sql.ErrTxDone once RollbackTo has
+// removed the transaction's savepoint
+func (t *Transaction) checkUndone() error {
+	if t.undoneBy == "" {
+		return nil
+	}
+	return fmt.Errorf("savepoint %s was removed by rolling back to %s: %w", t.savepoint, t.undoneBy, sql.ErrTxDone)
+}
+
+// OnCommit registers fn to be called after the transaction commits, such as
+// to clear a cache. Callbacks of a nested transaction are called only when
+// the outermost transaction commits, and not at all if the nested
+// transaction or one of its parents rolls back.
+func (t *Transaction) OnCommit(fn func()) {
+	t.onCommit = append(t.onCommit, fn)
+}
+
+// OnRollback registers fn to be called after the transaction's changes are
+// rolled back: when it rolls back, or, once a nested transaction has
+// committed, when one of its parents rolls back. A failed commit of the
+// outermost transaction counts as a rollback.
+func (t *Transaction) OnRollback(fn func()) {
+	t.onRollback = append(t.onRollback, fn)
+}
+
+// finish discards the transaction's callbacks and calls the given ones, so
+// each callback is called at most once
+func (t *Transaction) finish(callbacks []func()) {
+	t.onCommit, t.onRollback = nil, nil
+	for _, fn := range callbacks {
+		fn()
+	}
+}
+
+// ListSavepoints returns the savepoints from the outermost transaction down
+// to this one. The outermost transaction, which has no savepoint, is listed
+// as "ROOT".
+func (t *Transaction) ListSavepoints() []string {
+	var savepoints []string
+	for cur := t; cur != nil; cur = cur.parent {
+		name := cur.savepoint
+		if cur.parent == nil {
+			name = "ROOT"
+		}
+		savepoints = append([]string{name}, savepoints...)
+	}
+	return savepoints
+}
+
+// RollbackTo rolls back to the named savepoint, which must be this
+// transaction's savepoint or one of its ancestors'. Changes made after the
+// savepoint, including those of nested transactions, are undone; the
+// savepoint itself stays active. The transactions below the savepoint's,
+// down to this one, are finished: their Commit and Rollback return an error
+// wrapping sql.ErrTxDone. The OnRollback callbacks of the transactions from
+// the savepoint's down to this one are called, including those of nested
+// transactions that committed into them, and their OnCommit callbacks are
+// discarded.
+func (t *Transaction) RollbackTo(ctx context.Context, name string) error {
+	if err := t.checkUndone(); err != nil {
+		return wrapError("rollback", "", err)
+	}
+
+	savepoints := t.ListSavepoints()
+	found := false
+	for _, sp := range savepoints[1:] { // The root has no savepoint
+		if sp == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("savepoint %q is not active in this transaction", name)
+	}
+
+	_, err := t.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+	if err != nil {
+		return wrapError("rollback", "", err)
+	}
+
+	// The nearest savepoint with the name is the one rolled back to; those
+	// created after it are gone
+	var undone []*Transaction
+	for cur := t; cur != nil; cur = cur.parent {
+		undone = append(undone, cur)
+		if cur.savepoint == name {
+			break
+		}
+		cur.undoneBy = name
+	}
+	for i := len(undone) - 1; i >= 0; i-- {
+		undone[i].finish(undone[i].onRollback)
+	}
+	return nil
+}
+
+// Create inserts a new record within the transaction
+func (t *Transaction) Create(ctx context.Context, m interface{}) error {
+	return t.db.Create(ctx, m)
+}
+
+// Find retrieves records within the transaction
+func (t *Transaction) Find(ctx context.Context, dest interface{}, where string, args ...interface{}) error {
+	return t.db.Find(ctx, dest, where, args...)
+}
+
+// First retrieves the record with the given ID within the transaction
+func (t *Transaction) First(ctx context.Context, dest interface{}, id interface{}) error {
+	return t.db.First(ctx, dest, id)
+}
+
+// Update updates a record within the transaction
+func (t *Transaction) Update(ctx context.Context, m interface{}) error {
+	return t.db.Update(ctx, m)
+}
+
+// Delete deletes a record within the transaction
+func (t *Transaction) Delete(ctx context.Context, m interface{}) error {
+	return t.db.Delete(ctx, m)
+}
+
+// Raw runs a raw SQL query within the transaction
+func (t *Transaction) Raw(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return t.db.Raw(ctx, dest, query, args...)
+}
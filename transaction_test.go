@@ -0,0 +1,521 @@
+package theory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// userNames returns the names of all test users, ordered by ID
+func userNames(t *testing.T, find func(ctx context.Context, dest interface{}, where string, args ...interface{}) error) []string {
+	t.Helper()
+
+	var users []TestUser
+	if err := find(context.Background(), &users, "1 = 1 ORDER BY id"); err != nil {
+		t.Fatalf("failed to find users: %v", err)
+	}
+
+	var names []string
+	for _, u := range users {
+		names = append(names, u.Name)
+	}
+	return names
+}
+
+func TestTransaction(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	if err := tx.Create(ctx, &TestUser{Name: "Rolled back"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatalf("failed to roll back: %v", err)
+	}
+
+	tx, err = db.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	if err := tx.Create(ctx, &TestUser{Name: "Committed"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	if names := userNames(t, db.Find); len(names) != 1 || names[0] != "Committed" {
+		t.Errorf("expected only the committed user, got %v", names)
+	}
+}
+
+func TestNestedTransaction(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	if err := tx.Create(ctx, &TestUser{Name: "Outer"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	nested, err := tx.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin nested transaction: %v", err)
+	}
+	if err := nested.Create(ctx, &TestUser{Name: "Inner"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := nested.Rollback(ctx); err != nil {
+		t.Fatalf("failed to roll back nested transaction: %v", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	if names := userNames(t, db.Find); len(names) != 1 || names[0] != "Outer" {
+		t.Errorf("expected only the outer user, got %v", names)
+	}
+}
+
+func TestBeginNamed(t *testing.T) {
+	rec, dsn := newRecorder(t)
+	db, err := Connect(Config{Driver: "postgres", DSN: dsn})
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	tx, err := db.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	nested, err := tx.BeginNamed(ctx, "import_users", nil)
+	if err != nil {
+		t.Fatalf("failed to begin named transaction: %v", err)
+	}
+	if query, _ := rec.LastQuery(); query != "SAVEPOINT import_users" {
+		t.Errorf("executed %q, want %q", query, "SAVEPOINT import_users")
+	}
+
+	if err := nested.Commit(ctx); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if query, _ := rec.LastQuery(); query != "RELEASE SAVEPOINT import_users" {
+		t.Errorf("executed %q, want %q", query, "RELEASE SAVEPOINT import_users")
+	}
+
+	for _, name := range []string{"", "sp-1", "sp 1", "sp;DROP TABLE users"} {
+		if _, err := tx.BeginNamed(ctx, name, nil); err == nil {
+			t.Errorf("expected error for savepoint name %q", name)
+		}
+	}
+	for _, query := range rec.Queries() {
+		if strings.Contains(query, "DROP") {
+			t.Errorf("invalid savepoint name reached the database: %q", query)
+		}
+	}
+}
+
+func TestListSavepoints(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	tx, err := db.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sp1, err := tx.BeginNamed(ctx, "sp1", nil)
+	if err != nil {
+		t.Fatalf("failed to begin sp1: %v", err)
+	}
+	sp2, err := sp1.BeginNamed(ctx, "sp2", nil)
+	if err != nil {
+		t.Fatalf("failed to begin sp2: %v", err)
+	}
+
+	want := []string{"ROOT", "sp1", "sp2"}
+	if got := sp2.ListSavepoints(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ListSavepoints() = %v, want %v", got, want)
+	}
+	if got := tx.ListSavepoints(); !reflect.DeepEqual(got, []string{"ROOT"}) {
+		t.Errorf("ListSavepoints() = %v, want [ROOT]", got)
+	}
+}
+
+func TestRollbackTo(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	tx, err := db.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tx.Create(ctx, &TestUser{Name: "Root"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	sp1, err := tx.BeginNamed(ctx, "sp1", nil)
+	if err != nil {
+		t.Fatalf("failed to begin sp1: %v", err)
+	}
+	if err := sp1.Create(ctx, &TestUser{Name: "Level 1"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	sp2, err := sp1.BeginNamed(ctx, "sp2", nil)
+	if err != nil {
+		t.Fatalf("failed to begin sp2: %v", err)
+	}
+	if err := sp2.Create(ctx, &TestUser{Name: "Level 2"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	if err := sp2.RollbackTo(ctx, "missing"); err == nil {
+		t.Error("expected error for savepoint outside the chain")
+	}
+	if err := sp2.RollbackTo(ctx, "ROOT"); err == nil {
+		t.Error("expected error for ROOT, which is not a savepoint")
+	}
+
+	if err := sp2.RollbackTo(ctx, "sp1"); err != nil {
+		t.Fatalf("failed to roll back to sp1: %v", err)
+	}
+
+	// sp2's savepoint is gone, while sp1's stays active
+	if err := sp2.Commit(ctx); !errors.Is(err, sql.ErrTxDone) {
+		t.Errorf("sp2.Commit() error = %v, want %v", err, sql.ErrTxDone)
+	}
+	if err := sp2.Rollback(ctx); !errors.Is(err, sql.ErrTxDone) {
+		t.Errorf("sp2.Rollback() error = %v, want %v", err, sql.ErrTxDone)
+	}
+	if err := sp1.Commit(ctx); err != nil {
+		t.Fatalf("failed to commit sp1: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	if names := userNames(t, db.Find); !reflect.DeepEqual(names, []string{"Root"}) {
+		t.Errorf("expected only the root user, got %v", names)
+	}
+}
+
+func TestRollbackToCallbacks(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	var events []string
+	record := func(event string) func() {
+		return func() { events = append(events, event) }
+	}
+
+	tx, err := db.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	tx.OnCommit(record("root commit"))
+	tx.OnRollback(record("root rollback"))
+
+	sp1, err := tx.BeginNamed(ctx, "sp1", nil)
+	if err != nil {
+		t.Fatalf("failed to begin sp1: %v", err)
+	}
+	sp1.OnCommit(record("sp1 commit"))
+	sp1.OnRollback(record("sp1 rollback"))
+
+	// Callbacks of a committed nested transaction are merged into sp1
+	committed, err := sp1.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin nested transaction: %v", err)
+	}
+	committed.OnCommit(record("nested commit"))
+	committed.OnRollback(record("nested rollback"))
+	if err := committed.Commit(ctx); err != nil {
+		t.Fatalf("failed to commit nested transaction: %v", err)
+	}
+
+	sp2, err := sp1.BeginNamed(ctx, "sp2", nil)
+	if err != nil {
+		t.Fatalf("failed to begin sp2: %v", err)
+	}
+	sp2.OnCommit(record("sp2 commit"))
+	sp2.OnRollback(record("sp2 rollback"))
+
+	if err := sp2.RollbackTo(ctx, "sp1"); err != nil {
+		t.Fatalf("failed to roll back to sp1: %v", err)
+	}
+	want := []string{"sp1 rollback", "nested rollback", "sp2 rollback"}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("expected callbacks %v, got %v", want, events)
+	}
+
+	// Only the root's callbacks are left for the commit
+	if err := sp1.Commit(ctx); err != nil {
+		t.Fatalf("failed to commit sp1: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	want = append(want, "root commit")
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("expected callbacks %v, got %v", want, events)
+	}
+}
+
+func TestTransactionCallbacks(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	var events []string
+	record := func(event string) func() {
+		return func() { events = append(events, event) }
+	}
+
+	tx, err := db.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	tx.OnCommit(record("outer commit"))
+	tx.OnRollback(record("outer rollback"))
+
+	committed, err := tx.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin nested transaction: %v", err)
+	}
+	committed.OnCommit(record("nested commit"))
+	if err := committed.Commit(ctx); err != nil {
+		t.Fatalf("failed to commit nested transaction: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no callbacks before the outer commit, got %v", events)
+	}
+
+	rolledBack, err := tx.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin nested transaction: %v", err)
+	}
+	rolledBack.OnCommit(record("discarded commit"))
+	rolledBack.OnRollback(record("nested rollback"))
+	if err := rolledBack.Rollback(ctx); err != nil {
+		t.Fatalf("failed to roll back nested transaction: %v", err)
+	}
+	if !reflect.DeepEqual(events, []string{"nested rollback"}) {
+		t.Fatalf("expected the nested rollback callback, got %v", events)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	tx.Rollback(ctx)
+	want := []string{"nested rollback", "outer commit", "nested commit"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("expected callbacks %v, got %v", want, events)
+	}
+
+	events = nil
+	tx, err = db.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	tx.OnCommit(record("outer commit"))
+	tx.OnRollback(record("outer rollback"))
+	nested, err := tx.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin nested transaction: %v", err)
+	}
+	nested.OnCommit(record("nested commit"))
+	nested.OnRollback(record("nested rollback"))
+	if err := nested.Commit(ctx); err != nil {
+		t.Fatalf("failed to commit nested transaction: %v", err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatalf("failed to roll back: %v", err)
+	}
+	if err := tx.Commit(ctx); err == nil {
+		t.Error("expected commit after rollback to fail")
+	}
+	want = []string{"outer rollback", "nested rollback"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("expected callbacks %v, got %v", want, events)
+	}
+}
+
+func TestWithTransaction(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	err := db.WithTransaction(ctx, func(tx *Transaction) error {
+		return tx.Create(ctx, &TestUser{Name: "Committed"})
+	})
+	if err != nil {
+		t.Fatalf("WithTransaction() error = %v", err)
+	}
+
+	errRejected := errors.New("rejected")
+	err = db.WithTransaction(ctx, func(tx *Transaction) error {
+		if err := tx.Create(ctx, &TestUser{Name: "Rejected"}); err != nil {
+			return err
+		}
+		return errRejected
+	})
+	if err != errRejected {
+		t.Errorf("WithTransaction() error = %v, want %v", err, errRejected)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected the panic to be propagated")
+			}
+		}()
+		db.WithTransaction(ctx, func(tx *Transaction) error {
+			tx.Create(ctx, &TestUser{Name: "Panicked"})
+			panic("boom")
+		})
+	}()
+
+	if names := userNames(t, db.Find); !reflect.DeepEqual(names, []string{"Committed"}) {
+		t.Errorf("expected only the committed user, got %v", names)
+	}
+}
+
+func TestWithTransactionTimeout(t *testing.T) {
+	// A file database, as the connection of a timed out transaction may be
+	// discarded, which would lose an in-memory database
+	db, err := Migrate(Config{Driver: "sqlite3", DSN: filepath.Join(t.TempDir(), "timeout.db")}, &TestUser{})
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	err = db.WithTransactionTimeout(ctx, 20*time.Millisecond, func(tx *Transaction) error {
+		if err := tx.Create(ctx, &TestUser{Name: "Slow"}); err != nil {
+			return err
+		}
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WithTransactionTimeout() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if names := userNames(t, db.Find); len(names) != 0 {
+		t.Errorf("expected the transaction to be rolled back, got %v", names)
+	}
+	if inUse := db.Stats().InUse; inUse != 0 {
+		t.Errorf("expected no connections in use, got %d", inUse)
+	}
+
+	err = db.WithTransactionTimeout(ctx, time.Second, func(tx *Transaction) error {
+		return tx.Create(ctx, &TestUser{Name: "Fast"})
+	})
+	if err != nil {
+		t.Fatalf("WithTransactionTimeout() error = %v", err)
+	}
+	if names := userNames(t, db.Find); !reflect.DeepEqual(names, []string{"Fast"}) {
+		t.Errorf("expected the fast user to be committed, got %v", names)
+	}
+}
+
+func TestTransactionFromContext(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if _, ok := TxFromContext(ctx); ok {
+		t.Error("expected no transaction in a plain context")
+	}
+
+	tx, err := db.Begin(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	txCtx := ContextWithTx(ctx, tx)
+	if got, ok := TxFromContext(txCtx); !ok || got != tx {
+		t.Errorf("TxFromContext() = %v, %v, want the stored transaction", got, ok)
+	}
+
+	// The DB's own methods pick the transaction up from the context
+	user := &TestUser{Name: "Pending", Email: "pending@example.com"}
+	if err := db.Create(txCtx, user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	user.Name = "Updated"
+	if err := db.Update(txCtx, user); err != nil {
+		t.Fatalf("failed to update user: %v", err)
+	}
+	other := &TestUser{Name: "Deleted"}
+	if err := db.Create(txCtx, other); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := db.Delete(txCtx, other); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+
+	var found TestUser
+	if err := db.First(txCtx, &found, user.ID); err != nil || found.Name != "Updated" {
+		t.Errorf("expected the updated user within the transaction, got %+v (%v)", found, err)
+	}
+
+	// So do the operations not going through DB.Create and the like
+	if _, err := db.UpdateWhere(txCtx, &TestUser{}, map[string]interface{}{"email": "bulk@example.com"}, "id = ?", user.ID); err != nil {
+		t.Fatalf("failed to update users: %v", err)
+	}
+	var raw []TestUser
+	if err := db.Raw(txCtx, &raw, "SELECT * FROM test_user WHERE email = ?", "bulk@example.com"); err != nil || len(raw) != 1 {
+		t.Errorf("expected Raw to see the updated user, got %+v (%v)", raw, err)
+	}
+	if err := db.FirstOrCreate(txCtx, &TestUser{}, map[string]interface{}{"name": "Created"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if n, err := db.Model(&TestUser{}).Where("name = ?", "Created").Count(txCtx); err != nil || n != 1 {
+		t.Errorf("Count() = %d, %v, want 1", n, err)
+	}
+	if n, err := db.DeleteWhere(txCtx, &TestUser{}, "name = ?", "Created"); err != nil || n != 1 {
+		t.Errorf("DeleteWhere() = %d, %v, want 1", n, err)
+	}
+
+	// Session settings apply within the transaction
+	logger := &captureLogger{}
+	if err := db.Session(SessionOptions{Logger: logger}).Create(txCtx, &TestUser{Name: "Logged"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if lines := logger.Lines(); len(lines) != 1 {
+		t.Errorf("expected 1 logged statement, got %q", lines)
+	}
+
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatalf("failed to roll back: %v", err)
+	}
+	if names := userNames(t, db.Find); len(names) != 0 {
+		t.Errorf("expected no users after rollback, got %v", names)
+	}
+}